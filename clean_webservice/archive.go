@@ -0,0 +1,305 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"wb/metrics"
+	db "wb/postgresql"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultRetentionInterval = 24 * time.Hour
+	archiveBatchSize         = 500
+	// defaultDedupRetention retention.ms топика кафки по умолчанию
+	defaultDedupRetention = 7 * 24 * time.Hour
+)
+
+// retentionConfig настройки хранения заказов: RETENTION_AGE (например 365d, пусто или -1 — хранить все),
+// RETENTION_INTERVAL период обслуживания (по умолчанию 24h), ARCHIVE_DIR каталог архивных файлов,
+// без него архив пишется в схему archive базы; DEDUP_RETENTION сколько хранить id обработанных сообщений
+// (по умолчанию 7d, как retention топика; -1 — не удалять)
+type retentionConfig struct {
+	age      time.Duration
+	interval time.Duration
+	dir      string
+	dedupAge time.Duration
+}
+
+func retentionFromEnv() (retentionConfig, error) {
+	cfg := retentionConfig{
+		interval: envDuration("RETENTION_INTERVAL", defaultRetentionInterval),
+		dir:      os.Getenv("ARCHIVE_DIR"),
+	}
+	if cfg.interval == 0 {
+		cfg.interval = defaultRetentionInterval
+	}
+	cfg.dedupAge = defaultDedupRetention
+	if v := os.Getenv("DEDUP_RETENTION"); v != "" {
+		age, err := parseRetention(v)
+		if err != nil {
+			return cfg, fmt.Errorf("DEDUP_RETENTION: %w", err)
+		}
+		cfg.dedupAge = max(age, 0)
+	}
+	if v := os.Getenv("RETENTION_AGE"); v != "" {
+		age, err := parseRetention(v)
+		if err != nil {
+			return cfg, fmt.Errorf("RETENTION_AGE: %w", err)
+		}
+		if age > 0 {
+			cfg.age = age
+		}
+	}
+	return cfg, nil
+}
+
+// files файловое хранилище архива или nil, если архив хранится в базе
+func (cfg retentionConfig) files() *archiveDir {
+	if cfg.dir == "" {
+		return nil
+	}
+	return &archiveDir{dir: cfg.dir}
+}
+
+// archiveFiles то же для чтения из репозитория: nil интерфейс, а не nil указатель
+func (cfg retentionConfig) archiveFiles() db.ArchiveFiles {
+	if files := cfg.files(); files != nil {
+		return files
+	}
+	return nil
+}
+
+// runRetention обслуживает секции и архив: сразу при старте и дальше раз в interval
+func runRetention(ctx context.Context, cfg retentionConfig) {
+	ticker := time.NewTicker(cfg.interval)
+	defer ticker.Stop()
+	for {
+		if err := maintainOrders(ctx, cfg); err != nil {
+			log.Printf("Retention error: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			log.Println("Retention stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// maintainOrders заводит секции на следующие месяцы, чистит таблицу дедупликации, архивирует заказы
+// старше RETENTION_AGE и удаляет опустевшие секции
+func maintainOrders(ctx context.Context, cfg retentionConfig) error {
+	if err := db.EnsurePartitions(ctx, time.Now()); err != nil {
+		return err
+	}
+	if cfg.dedupAge > 0 {
+		n, err := db.PurgeProcessedMessages(ctx, time.Now().Add(-cfg.dedupAge))
+		if err != nil {
+			return err
+		}
+		metrics.Add(`processed_messages_purged_total`, n)
+	}
+	if cfg.age == 0 {
+		return nil
+	}
+	before := time.Now().Add(-cfg.age)
+	start := time.Now()
+	var files db.ArchiveFiles
+	dir := cfg.files()
+	if dir != nil {
+		files = dir
+		defer dir.Close()
+	}
+	n, err := db.ArchiveOrders(ctx, before, archiveBatchSize, files)
+	metrics.Add(`orders_archived_total`, int64(n))
+	if err != nil {
+		return fmt.Errorf("archived %d orders: %w", n, err)
+	}
+	if n > 0 {
+		log.Printf("Retention: archived %d orders created before %s in %s", n,
+			before.Format(time.RFC3339), time.Since(start).Round(time.Millisecond))
+	}
+	dropped, err := db.DropPartitionsBefore(ctx, before)
+	if len(dropped) > 0 {
+		log.Printf("Retention: dropped partitions %v", dropped)
+	}
+	return err
+}
+
+// archiveDir архив в gzip ndjson файлах: файл на запуск архивации, заказ на строку
+type archiveDir struct {
+	dir string
+
+	mu   sync.Mutex
+	name string
+	f    *os.File
+	gz   *gzip.Writer
+}
+
+// Append дописывает пачку и сбрасывает ее на диск до того, как заказы удалятся из базы
+func (a *archiveDir) Append(orders []db.ArchivedOrder) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.f == nil {
+		if err := os.MkdirAll(a.dir, 0o755); err != nil {
+			return "", err
+		}
+		name := "orders-" + time.Now().UTC().Format("20060102T150405Z") + ".ndjson.gz"
+		f, err := os.OpenFile(filepath.Join(a.dir, name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o640)
+		if err != nil {
+			return "", err
+		}
+		a.name, a.f, a.gz = name, f, gzip.NewWriter(f)
+	}
+	enc := json.NewEncoder(a.gz)
+	for _, o := range orders {
+		if err := enc.Encode(o); err != nil {
+			return "", err
+		}
+	}
+	if err := a.gz.Flush(); err != nil {
+		return "", err
+	}
+	if err := a.f.Sync(); err != nil {
+		return "", err
+	}
+	return a.name, nil
+}
+
+// Close дописывает конец gzip потока
+func (a *archiveDir) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.f == nil {
+		return nil
+	}
+	err := a.gz.Close()
+	if cerr := a.f.Close(); err == nil {
+		err = cerr
+	}
+	a.f, a.gz = nil, nil
+	return err
+}
+
+// Read ищет заказ в архивном файле; файл без конца gzip потока (архивация прервалась) читается до обрыва
+func (a *archiveDir) Read(file, orderUID string) (*db.ArchivedOrder, error) {
+	f, err := os.Open(filepath.Join(a.dir, filepath.Base(file)))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(gz)
+	for {
+		var o db.ArchivedOrder
+		err := dec.Decode(&o)
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, fmt.Errorf("order %s not found in %s", orderUID, file)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if o.Order != nil && o.Order.Orders.OrderUID == orderUID {
+			return &o, nil
+		}
+	}
+}
+
+// registerArchiveRoutes запись архива о заказе и восстановление заказа из архива, в пределах арендатора
+func registerArchiveRoutes(router *gin.Engine, cache *Cache, files db.ArchiveFiles) {
+	router.GET("/admin/archive/orders/:order_uid", func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), dbTimeout)
+		defer cancel()
+		entry, err := db.GetArchiveEntry(ctx, requestTenant(c), c.Param("order_uid"))
+		if errors.Is(err, db.ErrNotArchived) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order is not archived"})
+			return
+		}
+		if err != nil {
+			log.Printf("get archive entry: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load archive"})
+			return
+		}
+		c.JSON(http.StatusOK, entry)
+	})
+	router.POST("/admin/archive/orders/:order_uid/restore", func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), dbTimeout)
+		defer cancel()
+		order, err := db.RestoreOrder(ctx, requestTenant(c), c.Param("order_uid"), files)
+		switch {
+		case errors.Is(err, db.ErrNotArchived):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Order is not archived"})
+			return
+		case errors.Is(err, db.ErrOrderExists):
+			c.JSON(http.StatusConflict, gin.H{"error": "Order already restored"})
+			return
+		case err != nil:
+			log.Printf("restore order: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore order"})
+			return
+		}
+		metrics.Inc(`orders_restored_total`)
+		cache.Set(order.Orders.OrderUID, order)
+		c.JSON(http.StatusOK, mapFullOrderToResponse(order, canSeePII(c)))
+	})
+}
+
+// runArchiveCommand cli: ./main archive run — один проход архивации по RETENTION_AGE,
+// ./main archive restore -tenant t <order_uid> — вернуть заказ из архива
+func runArchiveCommand(args []string) error {
+	const usage = "usage: archive run | restore [-tenant t] <order_uid>"
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+	fs := flag.NewFlagSet("archive "+args[0], flag.ExitOnError)
+	tenant := fs.String("tenant", "", "арендатор заказа")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	cfg, err := retentionFromEnv()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if err := connectDB(ctx); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	switch args[0] {
+	case "run":
+		if cfg.age == 0 {
+			return errors.New("RETENTION_AGE is not set")
+		}
+		return maintainOrders(ctx, cfg)
+	case "restore":
+		if fs.NArg() != 1 {
+			return errors.New(usage)
+		}
+		order, err := db.RestoreOrder(ctx, *tenant, fs.Arg(0), cfg.archiveFiles())
+		if err != nil {
+			return err
+		}
+		log.Printf("Restored order %s (created %s)", order.Orders.OrderUID, order.Orders.DateCreated.Format(time.RFC3339))
+		return nil
+	}
+	return errors.New(usage)
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"wb/auth"
+	"wb/metrics"
+	db "wb/postgresql"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	roleSupport = "support"
+	roleFinance = "finance"
+	roleAdmin   = "admin"
+
+	auditBufferSize    = 10000
+	auditBatchSize     = 100
+	auditFlushInterval = time.Second
+)
+
+// defaultRouteRoles доступ по умолчанию: заказы — поддержке и выше, выгрузки и отчеты — финансам,
+// админка и все, что не описано, — только admin
+var defaultRouteRoles = []auth.Rule{
+	{Prefix: "/", Roles: []string{roleAdmin}},
+	{Prefix: "/order/", Roles: []string{roleSupport, roleFinance, roleAdmin}},
+	{Prefix: "/orders/export", Roles: []string{roleFinance, roleAdmin}},
+	{Prefix: "/reports/", Roles: []string{roleFinance, roleAdmin}},
+	{Prefix: "/stats", Roles: []string{roleFinance, roleAdmin}},
+	{Prefix: "/admin/", Roles: []string{roleAdmin}},
+	{Prefix: "/metrics", Roles: []string{auth.Public}},
+	{Prefix: "/ready", Roles: []string{auth.Public}},
+	{Prefix: "/rates", Roles: []string{auth.Public}},
+	{Prefix: "/static/", Roles: []string{auth.Public}},
+}
+
+// authConfig аутентификаторы и политика доступа:
+// API_KEYS ключи, JWKS_FILE и JWT_* проверка токенов, ROUTE_ROLES переопределение ролей маршрутов,
+// AUTH_DISABLED=true отключает проверку доступа (только для локальной разработки)
+type authConfig struct {
+	authenticators []auth.Authenticator
+	policy         *auth.Policy
+	disabled       bool
+}
+
+func authFromEnv() (authConfig, error) {
+	cfg := authConfig{
+		policy:   auth.NewPolicy(defaultRouteRoles...),
+		disabled: os.Getenv("AUTH_DISABLED") == "true",
+	}
+	keys, err := auth.ParseAPIKeys(os.Getenv("API_KEYS"))
+	if err != nil {
+		return cfg, err
+	}
+	if keys.Len() > 0 {
+		cfg.authenticators = append(cfg.authenticators, keys)
+	}
+	if file := os.Getenv("JWKS_FILE"); file != "" {
+		jwt, err := auth.NewJWT(auth.JWTConfig{
+			JWKSFile:    file,
+			Issuer:      os.Getenv("JWT_ISSUER"),
+			Audience:    os.Getenv("JWT_AUDIENCE"),
+			RolesClaim:  os.Getenv("JWT_ROLES_CLAIM"),
+			TenantClaim: os.Getenv("JWT_TENANT_CLAIM"),
+		})
+		if err != nil {
+			return cfg, err
+		}
+		cfg.authenticators = append(cfg.authenticators, jwt)
+	}
+	rules, err := parseRouteRoles(os.Getenv("ROUTE_ROLES"))
+	if err != nil {
+		return cfg, err
+	}
+	for _, r := range rules {
+		cfg.policy.Set(r)
+	}
+	return cfg, nil
+}
+
+// parseRouteRoles правила из ROUTE_ROLES: "/stats=admin;/reports/=finance,admin;/metrics=*"
+func parseRouteRoles(v string) ([]auth.Rule, error) {
+	var rules []auth.Rule
+	for _, part := range strings.Split(v, ";") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		prefix, roles, ok := strings.Cut(part, "=")
+		prefix = strings.TrimSpace(prefix)
+		if !ok || !strings.HasPrefix(prefix, "/") || strings.TrimSpace(roles) == "" {
+			return nil, fmt.Errorf("ROUTE_ROLES: expected /prefix=role,role, got %q", part)
+		}
+		rule := auth.Rule{Prefix: prefix}
+		for _, r := range strings.Split(roles, ",") {
+			if r = strings.TrimSpace(r); r != "" {
+				rule.Roles = append(rule.Roles, r)
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// authenticate подключает определение вызывающего, authorize — проверку доступа;
+// обе вызываются до регистрации маршрутов
+func (cfg authConfig) authenticate(router *gin.Engine) {
+	router.Use(auth.Middleware(cfg.authenticators...))
+}
+
+func (cfg authConfig) authorize(router *gin.Engine) {
+	if cfg.disabled {
+		log.Println("Warning: AUTH_DISABLED=true, every route is open")
+		return
+	}
+	if len(cfg.authenticators) == 0 {
+		log.Println("Warning: neither API_KEYS nor JWKS_FILE is set, only public routes are reachable")
+	}
+	for _, r := range cfg.policy.Rules() {
+		log.Printf("Auth: %s -> %s", r.Prefix, strings.Join(r.Roles, ","))
+	}
+	router.Use(cfg.policy.Authorize())
+}
+
+// scopeTenant определяет арендатора запроса только по вызывающему: арендатор ключа или токена, admin
+// (и AUTH_DISABLED) выбирает его заголовком X-Tenant. Заголовок не расширяет доступ: если заказы разделены
+// по арендаторам, вызывающий без арендатора и без роли admin получает 403 на любом закрытом маршруте
+func (cfg authConfig) scopeTenant(router *gin.Engine) {
+	multiTenant := tenants.enabled()
+	router.Use(func(c *gin.Context) {
+		p := auth.FromContext(c)
+		switch {
+		case p != nil && p.Tenant != "":
+			c.Set(tenantContextKey, p.Tenant)
+		case cfg.disabled || p.HasRole(roleAdmin):
+			c.Set(tenantContextKey, strings.TrimSpace(c.GetHeader(tenantRequestHeader)))
+		case p == nil || !multiTenant || c.FullPath() == "" || cfg.policy.Public(c.FullPath()):
+			// анонимный вызов проходит авторизацию только на публичные маршруты, им арендатор не нужен
+		default:
+			log.Printf("Auth: %s has no tenant, forbidden %s %s", p.Subject, c.Request.Method, c.Request.URL.Path)
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Caller is not bound to a tenant"})
+			return
+		}
+		c.Next()
+	})
+}
+
+// auditLog журнал доступа к заказам: строка в лог сразу, запись в audit_log пачками в фоне,
+// при переполнении буфера запись в базу теряется, строка в логе остается
+type auditLog struct {
+	records chan db.AuditRecord
+}
+
+var audit = &auditLog{records: make(chan db.AuditRecord, auditBufferSize)}
+
+// auditActions маршруты, доступ к которым пишется в журнал, и их действия
+var auditActions = map[string]string{
+	"GET /order/:order_uid":                         "order.get",
+	"GET /order/:order_uid/history":                 "order.history",
+	"GET /orders/export":                            "orders.export",
+	"GET /admin/archive/orders/:order_uid":          "archive.get",
+	"POST /admin/archive/orders/:order_uid/restore": "archive.restore",
+}
+
+// middleware подключается до аутентификации и после ответа записывает запросы к маршрутам auditActions,
+// в том числе отклоненные с 401 и 403
+func (a *auditLog) middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		if action, ok := auditActions[c.Request.Method+" "+c.FullPath()]; ok {
+			a.record(c, action)
+		}
+	}
+}
+
+func (a *auditLog) record(c *gin.Context, action string) {
+	r := db.AuditRecord{
+		At:      time.Now().UTC(),
+		Subject: "anonymous",
+		Action:  action,
+		Tenant:  requestTenant(c),
+		Status:  c.Writer.Status(),
+		IP:      c.ClientIP(),
+	}
+	if p := auth.FromContext(c); p != nil {
+		r.Subject, r.Roles, r.Method = p.Subject, strings.Join(p.Roles, ","), p.Method
+	}
+	if uid := c.Param("order_uid"); uid != "" {
+		r.OrderUID = &uid
+	}
+	log.Printf("Audit: %s %s order=%s tenant=%q status=%d ip=%s", r.Subject, action, c.Param("order_uid"),
+		r.Tenant, r.Status, r.IP)
+	select {
+	case a.records <- r:
+	default:
+		metrics.Inc(`audit_dropped_total`)
+	}
+}
+
+// Run пишет накопленные записи в базу пачками до отмены ctx
+func (a *auditLog) Run(ctx context.Context) {
+	ticker := time.NewTicker(auditFlushInterval)
+	defer ticker.Stop()
+	batch := make([]db.AuditRecord, 0, auditBatchSize)
+	flush := func(ctx context.Context) {
+		if len(batch) == 0 {
+			return
+		}
+		fctx, cancel := context.WithTimeout(ctx, dbTimeout)
+		defer cancel()
+		if err := db.InsertAudit(fctx, batch); err != nil {
+			log.Printf("Audit write error: %v", err)
+			metrics.Add(`audit_dropped_total`, int64(len(batch)))
+		} else {
+			metrics.Add(`audit_records_total`, int64(len(batch)))
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			for {
+				select {
+				case r := <-a.records:
+					if batch = append(batch, r); len(batch) >= auditBatchSize {
+						flush(context.Background())
+					}
+				default:
+					flush(context.Background())
+					return
+				}
+			}
+		case r := <-a.records:
+			if batch = append(batch, r); len(batch) >= auditBatchSize {
+				flush(ctx)
+			}
+		case <-ticker.C:
+			flush(ctx)
+		}
+	}
+}
+
+// registerAuditRoutes GET /admin/audit?order_uid=&subject=&limit= последние записи журнала доступа
+func registerAuditRoutes(router *gin.Engine) {
+	router.GET("/admin/audit", func(c *gin.Context) {
+		f := db.AuditFilter{OrderUID: c.Query("order_uid"), Subject: c.Query("subject")}
+		if v := c.Query("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 || n > 1000 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be 1..1000"})
+				return
+			}
+			f.Limit = n
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), dbTimeout)
+		defer cancel()
+		records, err := db.ListAudit(ctx, f)
+		if err != nil {
+			log.Printf("list audit: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load audit log"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"records": records})
+	})
+}
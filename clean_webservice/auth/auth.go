@@ -0,0 +1,163 @@
+// Package auth аутентификация и авторизация http api: аутентификаторы (API ключи, JWT) определяют,
+// кто вызывает сервис, политика по маршрутам решает, каким ролям маршрут доступен
+package auth
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrUnauthorized учетные данные переданы, но не подошли
+var ErrUnauthorized = errors.New("unauthorized")
+
+const contextKey = "auth.principal"
+
+// Principal вызывающий
+type Principal struct {
+	Subject string   `json:"subject"`
+	Roles   []string `json:"roles"`
+	// арендатор, к которому привязан вызывающий; пусто — admin выбирает его заголовком X-Tenant
+	Tenant string `json:"tenant,omitempty"`
+	Method string `json:"method"` // api_key или jwt
+}
+
+// HasRole есть ли у вызывающего хотя бы одна из ролей
+func (p *Principal) HasRole(roles ...string) bool {
+	if p == nil {
+		return false
+	}
+	for _, r := range roles {
+		if slices.Contains(p.Roles, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticator определяет вызывающего по запросу
+// (nil, nil) — в запросе нет учетных данных этого вида, ошибка — данные есть, но не прошли проверку
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// Middleware пробует аутентификаторы по очереди и кладет вызывающего в контекст;
+// запрос без учетных данных проходит анонимным, решение о доступе принимает Policy
+func Middleware(authenticators ...Authenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, a := range authenticators {
+			p, err := a.Authenticate(c.Request)
+			if err != nil {
+				log.Printf("Auth: %s %s from %s: %v", c.Request.Method, c.Request.URL.Path, c.ClientIP(), err)
+				c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+				return
+			}
+			if p != nil {
+				c.Set(contextKey, p)
+				break
+			}
+		}
+		c.Next()
+	}
+}
+
+// FromContext вызывающий запроса, nil — анонимный
+func FromContext(c *gin.Context) *Principal {
+	if v, ok := c.Get(contextKey); ok {
+		p, _ := v.(*Principal)
+		return p
+	}
+	return nil
+}
+
+// Public роль правила, открывающего маршрут без аутентификации
+const Public = "*"
+
+// Rule роли, которым доступны маршруты с префиксом Prefix
+type Rule struct {
+	Prefix string
+	Roles  []string
+}
+
+// Policy правила доступа по маршрутам; действует правило с самым длинным подходящим префиксом,
+// маршрут без правила закрыт
+type Policy struct {
+	rules []Rule
+}
+
+func NewPolicy(rules ...Rule) *Policy {
+	p := &Policy{}
+	for _, r := range rules {
+		p.Set(r)
+	}
+	return p
+}
+
+// Set добавляет правило или заменяет правило с тем же префиксом
+func (p *Policy) Set(rule Rule) {
+	for i, r := range p.rules {
+		if r.Prefix == rule.Prefix {
+			p.rules[i] = rule
+			return
+		}
+	}
+	p.rules = append(p.rules, rule)
+}
+
+// Roles роли маршрута; ok false — ни одно правило не подошло
+func (p *Policy) Roles(path string) (roles []string, ok bool) {
+	best := -1
+	for _, r := range p.rules {
+		if strings.HasPrefix(path, r.Prefix) && len(r.Prefix) > best {
+			roles, best = r.Roles, len(r.Prefix)
+		}
+	}
+	return roles, best >= 0
+}
+
+// Public открыт ли маршрут без аутентификации
+func (p *Policy) Public(path string) bool {
+	roles, _ := p.Roles(path)
+	return slices.Contains(roles, Public)
+}
+
+// Rules правила политики, для вывода в лог и админку
+func (p *Policy) Rules() []Rule {
+	return slices.Clone(p.rules)
+}
+
+// Authorize пропускает запрос, если маршрут публичный или у вызывающего есть роль маршрута:
+// анонимному — 401, вызывающему без нужной роли — 403
+func (p *Policy) Authorize() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := c.FullPath()
+		if path == "" {
+			// маршрут не найден, gin ответит 404
+			c.Next()
+			return
+		}
+		if p.Public(path) {
+			c.Next()
+			return
+		}
+		roles, _ := p.Roles(path)
+		principal := FromContext(c)
+		if principal == nil {
+			c.Header("WWW-Authenticate", `Bearer`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		if !principal.HasRole(roles...) {
+			log.Printf("Auth: %s (%s) forbidden %s %s", principal.Subject, strings.Join(principal.Roles, ","),
+				c.Request.Method, c.Request.URL.Path)
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
+			return
+		}
+		c.Next()
+	}
+}
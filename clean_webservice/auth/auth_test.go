@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPolicyRoles(t *testing.T) {
+	p := NewPolicy(
+		Rule{Prefix: "/", Roles: []string{"admin"}},
+		Rule{Prefix: "/order/", Roles: []string{"support", "admin"}},
+		Rule{Prefix: "/order/:order_uid/history", Roles: []string{"admin"}},
+		Rule{Prefix: "/metrics", Roles: []string{Public}},
+	)
+	p.Set(Rule{Prefix: "/metrics", Roles: []string{"admin"}}) // замена правила, а не второе правило
+
+	tests := []struct {
+		path   string
+		want   []string
+		public bool
+	}{
+		{"/order/:order_uid", []string{"support", "admin"}, false},
+		{"/order/:order_uid/history", []string{"admin"}, false},
+		{"/orders/export", []string{"admin"}, false},
+		{"/metrics", []string{"admin"}, false},
+		{"/static/*filepath", []string{"admin"}, false},
+	}
+	for _, tt := range tests {
+		got, ok := p.Roles(tt.path)
+		if !ok || !slices.Equal(got, tt.want) {
+			t.Errorf("Roles(%q) = %v, %v, want %v", tt.path, got, ok, tt.want)
+		}
+		if p.Public(tt.path) != tt.public {
+			t.Errorf("Public(%q) = %v, want %v", tt.path, !tt.public, tt.public)
+		}
+	}
+	if len(p.Rules()) != 4 {
+		t.Errorf("Rules() = %v, want 4 rules", p.Rules())
+	}
+
+	narrow := NewPolicy(Rule{Prefix: "/order/", Roles: []string{"support"}}, Rule{Prefix: "/rates", Roles: []string{Public}})
+	if roles, ok := narrow.Roles("/admin/audit"); ok || roles != nil {
+		t.Errorf("Roles without matching rule = %v, %v, want closed", roles, ok)
+	}
+	if !narrow.Public("/rates") {
+		t.Error("Public(/rates) = false, want true")
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	keys, err := ParseAPIKeys("sup=support, adm=admin|support, fin=finance@acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := NewPolicy(
+		Rule{Prefix: "/", Roles: []string{"admin"}},
+		Rule{Prefix: "/order/", Roles: []string{"support", "admin"}},
+		Rule{Prefix: "/metrics", Roles: []string{Public}},
+	)
+	router := gin.New()
+	router.Use(Middleware(keys), policy.Authorize())
+	ok := func(c *gin.Context) { c.String(http.StatusOK, FromContext(c).Subject) }
+	router.GET("/order/:order_uid", ok)
+	router.GET("/admin/audit", ok)
+	router.GET("/metrics", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tests := []struct {
+		name       string
+		path       string
+		key        string
+		wantStatus int
+	}{
+		{"role matches", "/order/1", "sup", http.StatusOK},
+		{"one of roles matches", "/admin/audit", "adm", http.StatusOK},
+		{"anonymous", "/order/1", "", http.StatusUnauthorized},
+		{"unknown key", "/order/1", "nope", http.StatusUnauthorized},
+		{"unknown key public route", "/metrics", "nope", http.StatusUnauthorized},
+		{"wrong role", "/admin/audit", "sup", http.StatusForbidden},
+		{"wrong role with tenant", "/order/1", "fin", http.StatusForbidden},
+		{"anonymous public route", "/metrics", "", http.StatusOK},
+		{"not found", "/missing", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.key != "" {
+				req.Header.Set(APIKeyHeader, tt.key)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 without WWW-Authenticate")
+			}
+		})
+	}
+}
+
+func TestParseAPIKeys(t *testing.T) {
+	keys, err := ParseAPIKeys(" a=support , b=finance|admin@acme,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys.Len() != 2 {
+		t.Fatalf("Len() = %d, want 2", keys.Len())
+	}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(APIKeyHeader, "b")
+	p, err := keys.Authenticate(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(p.Roles, []string{"finance", "admin"}) || p.Tenant != "acme" || p.Method != "api_key" ||
+		p.Subject == "" || p.Subject == "b" {
+		t.Errorf("principal = %+v", p)
+	}
+
+	for _, v := range []string{"a", "=admin", "a=", "a=@acme"} {
+		if _, err := ParseAPIKeys(v); err == nil {
+			t.Errorf("ParseAPIKeys(%q) succeeded", v)
+		}
+	}
+	req.Header.Set(APIKeyHeader, "c")
+	if _, err := keys.Authenticate(req); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Authenticate(unknown key) = %v, want ErrUnauthorized", err)
+	}
+}
@@ -0,0 +1,324 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// jwtLeeway допуск расхождения часов при проверке exp и nbf
+	jwtLeeway = time.Minute
+	// jwksCheckInterval как часто проверять, не сменился ли файл JWKS
+	jwksCheckInterval = time.Minute
+)
+
+// JWTConfig проверка токенов: подпись по ключам из локального JWKS файла,
+// Issuer и Audience проверяются, если заданы
+type JWTConfig struct {
+	JWKSFile    string
+	Issuer      string
+	Audience    string
+	RolesClaim  string // по умолчанию roles, строка или массив строк
+	TenantClaim string // по умолчанию tenant
+}
+
+// JWT аутентификация по заголовку Authorization: Bearer <token>, поддерживаются RS256 и ES256
+type JWT struct {
+	cfg JWTConfig
+	now func() time.Time
+
+	mu      sync.Mutex
+	keys    map[string]crypto.PublicKey
+	modTime time.Time
+	checked time.Time
+}
+
+// NewJWT загружает JWKS; файл перечитывается при изменении, так что ротация ключей не требует перезапуска
+func NewJWT(cfg JWTConfig) (*JWT, error) {
+	if cfg.RolesClaim == "" {
+		cfg.RolesClaim = "roles"
+	}
+	if cfg.TenantClaim == "" {
+		cfg.TenantClaim = "tenant"
+	}
+	j := &JWT{cfg: cfg, now: time.Now}
+	if err := j.reload(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// reload перечитывает JWKS, если файл изменился; при ошибке остаются прежние ключи
+func (j *JWT) reload() error {
+	info, err := os.Stat(j.cfg.JWKSFile)
+	if err != nil {
+		return fmt.Errorf("stat JWKS: %w", err)
+	}
+	if j.keys != nil && info.ModTime().Equal(j.modTime) {
+		return nil
+	}
+	data, err := os.ReadFile(j.cfg.JWKSFile)
+	if err != nil {
+		return fmt.Errorf("read JWKS: %w", err)
+	}
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return fmt.Errorf("parse JWKS %s: %w", j.cfg.JWKSFile, err)
+	}
+	j.keys, j.modTime = keys, info.ModTime()
+	return nil
+}
+
+// key ключ по kid; без kid подходит единственный ключ набора
+func (j *JWT) key(kid string) (crypto.PublicKey, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if now := j.now(); now.Sub(j.checked) > jwksCheckInterval {
+		j.checked = now
+		_ = j.reload()
+	}
+	if kid == "" && len(j.keys) == 1 {
+		for _, k := range j.keys {
+			return k, nil
+		}
+	}
+	k, ok := j.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	return k, nil
+}
+
+func (j *JWT) Authenticate(r *http.Request) (*Principal, error) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return nil, nil
+	}
+	claims, err := j.verify(strings.TrimSpace(token))
+	if err != nil {
+		return nil, fmt.Errorf("invalid token: %v: %w", err, ErrUnauthorized)
+	}
+	sub, _ := claims["sub"].(string)
+	if sub == "" {
+		return nil, fmt.Errorf("invalid token: no sub: %w", ErrUnauthorized)
+	}
+	tenant, _ := claims[j.cfg.TenantClaim].(string)
+	return &Principal{
+		Subject: sub,
+		Roles:   stringList(claims[j.cfg.RolesClaim]),
+		Tenant:  tenant,
+		Method:  "jwt",
+	}, nil
+}
+
+// verify проверяет подпись и сроки токена и возвращает его claims
+func (j *JWT) verify(token string) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("header: %w", err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("signature: %w", err)
+	}
+	key, err := j.key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	switch header.Alg {
+	case "RS256":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return nil, errors.New("RS256 token signed with non-RSA key")
+		}
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig); err != nil {
+			return nil, errors.New("bad signature")
+		}
+	case "ES256":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(sig) != 64 {
+			return nil, errors.New("ES256 token signed with non-EC key")
+		}
+		r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(pub, digest[:], r, s) {
+			return nil, errors.New("bad signature")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported alg %q", header.Alg)
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("claims: %w", err)
+	}
+	now := j.now()
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return nil, errors.New("no exp")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(jwtLeeway)) {
+		return nil, errors.New("token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(jwtLeeway).Before(time.Unix(int64(nbf), 0)) {
+		return nil, errors.New("token not yet valid")
+	}
+	if j.cfg.Issuer != "" && claims["iss"] != j.cfg.Issuer {
+		return nil, fmt.Errorf("unexpected iss %v", claims["iss"])
+	}
+	if j.cfg.Audience != "" {
+		found := false
+		for _, aud := range stringList(claims["aud"]) {
+			found = found || aud == j.cfg.Audience
+		}
+		if !found {
+			return nil, fmt.Errorf("unexpected aud %v", claims["aud"])
+		}
+	}
+	return claims, nil
+}
+
+func decodeSegment(seg string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// stringList claim строкой ("admin" или "admin support") или массивом строк
+func stringList(v any) []string {
+	switch v := v.(type) {
+	case string:
+		return strings.Fields(v)
+	case []any:
+		out := make([]string, 0, len(v))
+		for _, s := range v {
+			if s, ok := s.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// parseJWKS публичные ключи подписи из JWKS: RSA и EC P-256, ключи шифрования (use=enc) пропускаются
+func parseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range set.Keys {
+		if k.Use == "enc" {
+			continue
+		}
+		var (
+			key crypto.PublicKey
+			err error
+		)
+		switch k.Kty {
+		case "RSA":
+			key, err = rsaKey(k)
+		case "EC":
+			key, err = ecKey(k)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", k.Kid, err)
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no signing keys")
+	}
+	return keys, nil
+}
+
+func rsaKey(k jwk) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("n: %w", err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, fmt.Errorf("e: %w", err)
+	}
+	exp := new(big.Int).SetBytes(e)
+	if !exp.IsInt64() || exp.Int64() < 3 || exp.Int64() > 1<<31-1 {
+		return nil, errors.New("bad exponent")
+	}
+	key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}
+	if key.N.BitLen() < 2048 {
+		return nil, errors.New("RSA key shorter than 2048 bits")
+	}
+	return key, nil
+}
+
+func ecKey(k jwk) (*ecdsa.PublicKey, error) {
+	if k.Crv != "P-256" {
+		return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+	}
+	x, err := base64.RawURLEncoding.DecodeString(k.X)
+	if err != nil {
+		return nil, fmt.Errorf("x: %w", err)
+	}
+	y, err := base64.RawURLEncoding.DecodeString(k.Y)
+	if err != nil {
+		return nil, fmt.Errorf("y: %w", err)
+	}
+	if len(x) > 32 || len(y) > 32 {
+		return nil, errors.New("bad point size")
+	}
+	// несжатая точка 0x04||X||Y, ecdh проверяет, что она лежит на кривой
+	point := append([]byte{4}, append(leftPad(x, 32), leftPad(y, 32)...)...)
+	if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+		return nil, err
+	}
+	return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+}
+
+func leftPad(b []byte, size int) []byte {
+	if len(b) >= size {
+		return b
+	}
+	return append(make([]byte, size-len(b)), b...)
+}
@@ -0,0 +1,218 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+var testNow = time.Unix(1_700_000_000, 0)
+
+type jwtKeys struct {
+	rsa *rsa.PrivateKey
+	ec  *ecdsa.PrivateKey
+}
+
+// newTestJWT JWT с ключами rsa и ec в JWKS файле и часами, остановленными на testNow
+func newTestJWT(t *testing.T, cfg JWTConfig) (*JWT, jwtKeys) {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b64 := base64.RawURLEncoding.EncodeToString
+	set := map[string]any{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa", "use": "sig", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "EC", "kid": "ec", "crv": "P-256", "x": b64(ecKey.X.FillBytes(make([]byte, 32))),
+			"y": b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+	}}
+	data, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.JWKSFile = filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(cfg.JWKSFile, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	j, err := NewJWT(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.now = func() time.Time { return testNow }
+	return j, jwtKeys{rsa: rsaKey, ec: ecKey}
+}
+
+// sign собирает токен; alg в заголовке и ключ подписи задаются независимо, чтобы проверять подмену алгоритма
+func (k jwtKeys) sign(t *testing.T, alg, kid, signWith string, claims map[string]any) string {
+	t.Helper()
+	enc := func(v any) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	head := map[string]string{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		head["kid"] = kid
+	}
+	input := enc(head) + "." + enc(claims)
+	digest := sha256.Sum256([]byte(input))
+	var sig []byte
+	switch signWith {
+	case "rsa":
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, k.rsa, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	case "ec":
+		r, s, err := ecdsa.Sign(rand.Reader, k.ec, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	case "hmac":
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write([]byte(input))
+		sig = mac.Sum(nil)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func claimsAt(exp time.Duration, extra map[string]any) map[string]any {
+	c := map[string]any{"sub": "user-1", "exp": testNow.Add(exp).Unix()}
+	for k, v := range extra {
+		c[k] = v
+	}
+	return c
+}
+
+func TestJWTAuthenticate(t *testing.T) {
+	j, keys := newTestJWT(t, JWTConfig{Issuer: "https://idp", Audience: "orders"})
+	valid := map[string]any{"iss": "https://idp", "aud": "orders"}
+	with := func(k string, v any) map[string]any {
+		c := claimsAt(time.Hour, valid)
+		if v == nil {
+			delete(c, k)
+		} else {
+			c[k] = v
+		}
+		return c
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		ok    bool
+	}{
+		{"rs256", keys.sign(t, "RS256", "rsa", "rsa", claimsAt(time.Hour, valid)), true},
+		{"es256", keys.sign(t, "ES256", "ec", "ec", claimsAt(time.Hour, valid)), true},
+		{"alg none", keys.sign(t, "none", "rsa", "", claimsAt(time.Hour, valid)), false},
+		{"hs256", keys.sign(t, "HS256", "rsa", "hmac", claimsAt(time.Hour, valid)), false},
+		{"rs256 with ec key", keys.sign(t, "RS256", "ec", "rsa", claimsAt(time.Hour, valid)), false},
+		{"es256 with rsa key", keys.sign(t, "ES256", "rsa", "ec", claimsAt(time.Hour, valid)), false},
+		{"signed by other key", keys.sign(t, "RS256", "ec", "ec", claimsAt(time.Hour, valid)), false},
+		{"unknown kid", keys.sign(t, "RS256", "rsa-old", "rsa", claimsAt(time.Hour, valid)), false},
+		{"no kid with two keys", keys.sign(t, "RS256", "", "rsa", claimsAt(time.Hour, valid)), false},
+		{"expired within leeway", keys.sign(t, "RS256", "rsa", "rsa", claimsAt(-30*time.Second, valid)), true},
+		{"expired", keys.sign(t, "RS256", "rsa", "rsa", claimsAt(-2*time.Minute, valid)), false},
+		{"no exp", keys.sign(t, "RS256", "rsa", "rsa", with("exp", nil)), false},
+		{"nbf within leeway", keys.sign(t, "RS256", "rsa", "rsa", with("nbf", testNow.Add(30*time.Second).Unix())), true},
+		{"nbf in future", keys.sign(t, "RS256", "rsa", "rsa", with("nbf", testNow.Add(2*time.Minute).Unix())), false},
+		{"wrong iss", keys.sign(t, "RS256", "rsa", "rsa", with("iss", "https://other")), false},
+		{"no iss", keys.sign(t, "RS256", "rsa", "rsa", with("iss", nil)), false},
+		{"wrong aud", keys.sign(t, "RS256", "rsa", "rsa", with("aud", "billing")), false},
+		{"aud list", keys.sign(t, "RS256", "rsa", "rsa", with("aud", []string{"billing", "orders"})), true},
+		{"no sub", keys.sign(t, "RS256", "rsa", "rsa", with("sub", nil)), false},
+		{"malformed", "abc.def", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/order/1", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			p, err := j.Authenticate(req)
+			if tt.ok {
+				if err != nil || p == nil || p.Subject != "user-1" || p.Method != "jwt" {
+					t.Fatalf("Authenticate = %+v, %v, want user-1", p, err)
+				}
+				return
+			}
+			if p != nil || !errors.Is(err, ErrUnauthorized) {
+				t.Fatalf("Authenticate = %+v, %v, want ErrUnauthorized", p, err)
+			}
+		})
+	}
+}
+
+func TestJWTClaims(t *testing.T) {
+	j, keys := newTestJWT(t, JWTConfig{RolesClaim: "groups", TenantClaim: "org"})
+	tests := []struct {
+		name   string
+		claims map[string]any
+		roles  []string
+		tenant string
+	}{
+		{"array", claimsAt(time.Hour, map[string]any{"groups": []string{"support", "finance"}, "org": "acme"}),
+			[]string{"support", "finance"}, "acme"},
+		{"string", claimsAt(time.Hour, map[string]any{"groups": "admin support"}), []string{"admin", "support"}, ""},
+		{"missing", claimsAt(time.Hour, map[string]any{"roles": []string{"admin"}}), nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("Authorization", "Bearer "+keys.sign(t, "ES256", "ec", "ec", tt.claims))
+			p, err := j.Authenticate(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(p.Roles, tt.roles) || p.Tenant != tt.tenant {
+				t.Errorf("roles %v tenant %q, want %v %q", p.Roles, p.Tenant, tt.roles, tt.tenant)
+			}
+		})
+	}
+
+	// без Bearer токена JWT не решает, пускать ли запрос
+	if p, err := j.Authenticate(httptest.NewRequest("GET", "/", nil)); p != nil || err != nil {
+		t.Errorf("Authenticate without token = %+v, %v, want nil, nil", p, err)
+	}
+}
+
+func TestParseJWKS(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		ok   bool
+	}{
+		{"short rsa", `{"keys": [{"kty": "RSA", "kid": "a", "n": "` +
+			base64.RawURLEncoding.EncodeToString(make([]byte, 128)) + `", "e": "AQAB"}]}`, false},
+		{"other curve", `{"keys": [{"kty": "EC", "kid": "a", "crv": "P-384", "x": "AA", "y": "AA"}]}`, false},
+		{"point off curve", `{"keys": [{"kty": "EC", "kid": "a", "crv": "P-256", "x": "AQ", "y": "AQ"}]}`, false},
+		{"only enc keys", `{"keys": [{"kty": "RSA", "kid": "a", "use": "enc", "n": "AQ", "e": "AQAB"}]}`, false},
+		{"unknown kty only", `{"keys": [{"kty": "oct", "kid": "a"}]}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseJWKS([]byte(tt.data)); (err == nil) != tt.ok {
+				t.Errorf("parseJWKS error = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"wb/auth"
+	db "wb/postgresql"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAuditRecordsDenied(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	keys, err := auth.ParseAPIKeys("fin=finance,sup=support")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := authConfig{authenticators: []auth.Authenticator{keys}, policy: auth.NewPolicy(defaultRouteRoles...)}
+	a := &auditLog{records: make(chan db.AuditRecord, 10)}
+	router := gin.New()
+	router.Use(a.middleware())
+	cfg.authenticate(router)
+	cfg.authorize(router)
+	router.GET("/order/:order_uid", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/admin/archive/orders/:order_uid", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/metrics", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tests := []struct {
+		name        string
+		path        string
+		key         string
+		wantStatus  int
+		wantAction  string // пусто — маршрут не пишется в журнал
+		wantSubject string
+	}{
+		{name: "allowed", path: "/order/1", key: "sup", wantStatus: 200, wantAction: "order.get"},
+		{name: "anonymous", path: "/order/1", wantStatus: 401, wantAction: "order.get", wantSubject: "anonymous"},
+		{name: "bad key", path: "/order/1", key: "nope", wantStatus: 401, wantAction: "order.get",
+			wantSubject: "anonymous"},
+		{name: "forbidden", path: "/admin/archive/orders/1", key: "fin", wantStatus: 403, wantAction: "archive.get"},
+		{name: "not audited", path: "/metrics", key: "sup", wantStatus: 200},
+		{name: "not found", path: "/order/", key: "sup", wantStatus: 404},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.key != "" {
+				req.Header.Set(auth.APIKeyHeader, tt.key)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			select {
+			case r := <-a.records:
+				if tt.wantAction == "" {
+					t.Fatalf("unexpected audit record %+v", r)
+				}
+				if r.Action != tt.wantAction || r.Status != tt.wantStatus || r.OrderUID == nil || *r.OrderUID != "1" {
+					t.Errorf("audit record %+v, want %s with status %d", r, tt.wantAction, tt.wantStatus)
+				}
+				if tt.wantSubject != "" && r.Subject != tt.wantSubject {
+					t.Errorf("subject = %q, want %q", r.Subject, tt.wantSubject)
+				}
+			default:
+				if tt.wantAction != "" {
+					t.Fatal("no audit record")
+				}
+			}
+		})
+	}
+}
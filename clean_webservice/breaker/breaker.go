@@ -0,0 +1,180 @@
+package breaker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"wb/metrics"
+)
+
+// State состояние автомата
+type State string
+
+const (
+	// Closed зависимость работает, операции выполняются
+	Closed State = "closed"
+	// Open зависимость недоступна, операции не выполняются, идет периодическая проверка
+	Open State = "open"
+	// HalfOpen проверка прошла, первая же операция решает: Closed при успехе, Open при ошибке
+	HalfOpen State = "half_open"
+)
+
+func (s State) gauge() int64 {
+	switch s {
+	case HalfOpen:
+		return 1
+	case Open:
+		return 2
+	}
+	return 0
+}
+
+// Status состояние для readiness и админки
+type Status struct {
+	Name      string     `json:"name"`
+	State     State      `json:"state"`
+	Failures  int        `json:"failures"`
+	OpenedAt  *time.Time `json:"opened_at,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+}
+
+// Breaker размыкается после threshold ошибок подряд; пока он разомкнут, probe вызывается раз в interval,
+// успешная проверка переводит его в HalfOpen
+type Breaker struct {
+	name      string
+	threshold int
+	interval  time.Duration
+	probe     func(context.Context) error
+
+	mu        sync.Mutex
+	state     State
+	failures  int
+	openedAt  time.Time
+	lastError error
+	listeners []func(State)
+}
+
+func New(name string, threshold int, interval time.Duration, probe func(context.Context) error) *Breaker {
+	b := &Breaker{
+		name:      name,
+		threshold: max(threshold, 1),
+		interval:  interval,
+		probe:     probe,
+		state:     Closed,
+	}
+	metrics.Set(b.metric("state"), Closed.gauge())
+	return b
+}
+
+func (b *Breaker) metric(name string) string {
+	return fmt.Sprintf(`breaker_%s{name=%q}`, name, b.name)
+}
+
+// OnChange подписка на смену состояния; вызывается синхронно, вне блокировки автомата
+func (b *Breaker) OnChange(fn func(State)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.listeners = append(b.listeners, fn)
+}
+
+// Allow можно ли сейчас выполнять операцию
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state != Open
+}
+
+// Success операция прошла
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	b.failures = 0
+	if b.state != HalfOpen {
+		b.mu.Unlock()
+		return
+	}
+	b.setState(Closed)
+}
+
+// Failure операция не прошла из-за недоступности зависимости
+func (b *Breaker) Failure(err error) {
+	b.mu.Lock()
+	b.failures++
+	b.lastError = err
+	if b.state == Open || (b.state == Closed && b.failures < b.threshold) {
+		b.mu.Unlock()
+		return
+	}
+	b.openedAt = time.Now()
+	b.setState(Open)
+}
+
+// setState меняет состояние и оповещает подписчиков; вызывается под блокировкой и снимает ее
+func (b *Breaker) setState(s State) {
+	prev := b.state
+	b.state = s
+	listeners := b.listeners
+	lastErr := b.lastError
+	b.mu.Unlock()
+
+	if s == Open {
+		log.Printf("Breaker %s: %s -> %s: %v", b.name, prev, s, lastErr)
+	} else {
+		log.Printf("Breaker %s: %s -> %s", b.name, prev, s)
+	}
+	metrics.Set(b.metric("state"), s.gauge())
+	metrics.Inc(fmt.Sprintf(`breaker_transitions_total{name=%q,to=%q}`, b.name, s))
+	for _, fn := range listeners {
+		fn(s)
+	}
+}
+
+// Status текущее состояние
+func (b *Breaker) Status() Status {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := Status{Name: b.name, State: b.state, Failures: b.failures}
+	if b.state != Closed {
+		t := b.openedAt
+		s.OpenedAt = &t
+	}
+	if b.lastError != nil {
+		s.LastError = b.lastError.Error()
+	}
+	return s
+}
+
+// Run проверяет зависимость, пока автомат разомкнут; в замкнутом состоянии ждет размыкания
+func (b *Breaker) Run(ctx context.Context) {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		b.mu.Lock()
+		open := b.state == Open
+		b.mu.Unlock()
+		if !open {
+			continue
+		}
+
+		probeCtx, cancel := context.WithTimeout(ctx, b.interval)
+		err := b.probe(probeCtx)
+		cancel()
+		metrics.Inc(b.metric("probes_total"))
+		b.mu.Lock()
+		if err != nil || b.state != Open {
+			if err != nil {
+				b.lastError = err
+			}
+			b.mu.Unlock()
+			continue
+		}
+		b.setState(HalfOpen)
+	}
+}
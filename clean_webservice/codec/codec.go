@@ -0,0 +1,153 @@
+package codec
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	db "wb/postgresql"
+)
+
+const (
+	// HeaderContentType заголовок кафки, по которому выбирается формат сообщения
+	HeaderContentType   = "content-type"
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/vnd.confluent.protobuf"
+	// OrdersSubject subject схемы заказа по TopicNameStrategy
+	OrdersSubject = "orders-value"
+)
+
+// Format в каком формате пришло сообщение, нужен для логов и метрик
+type Format string
+
+const (
+	FormatJSON     Format = "json"
+	FormatProtobuf Format = "protobuf"
+)
+
+// Decoder разбирает заказ в зависимости от content-type, без заголовка формат определяется по magic byte
+// json остается fallback для старых продюсеров, для топиков из strictTopics json разбирается строго
+type Decoder struct {
+	registry     Registry
+	strictTopics map[string]bool
+}
+
+func NewDecoder(registry Registry, strictTopics []string) *Decoder {
+	d := &Decoder{registry: registry, strictTopics: make(map[string]bool)}
+	for _, t := range strictTopics {
+		d.strictTopics[t] = true
+	}
+	return d
+}
+
+// Strict включен ли строгий режим для топика
+func (d *Decoder) Strict(topic string) bool {
+	return d.strictTopics[topic]
+}
+
+// DecodeOrder возвращает заказ, формат и id схемы (0 для json)
+// ошибки разбора приходят как *DecodeError, подробности по полям достаются через FieldErrors
+// суммы в заказе сразу приводятся к минимальным единицам валюты платежа
+func (d *Decoder) DecodeOrder(ctx context.Context, topic string, headers map[string]string, value []byte) (*db.FullOrder, Format, int, error) {
+	order, format, schemaID, err := d.decodeOrder(ctx, topic, headers, value)
+	if err != nil {
+		return nil, format, schemaID, err
+	}
+	if err := order.ApplyCurrency(); err != nil {
+		return nil, format, schemaID, moneyDecodeError(err)
+	}
+	return order, format, schemaID, nil
+}
+
+func (d *Decoder) decodeOrder(ctx context.Context, topic string, headers map[string]string, value []byte) (*db.FullOrder, Format, int, error) {
+	contentType := strings.ToLower(headers[HeaderContentType])
+	switch {
+	case strings.HasPrefix(contentType, ContentTypeJSON):
+		order, err := d.decodeJSON(topic, value)
+		return order, FormatJSON, 0, err
+	case strings.Contains(contentType, "protobuf"):
+		return d.decodeProtobuf(ctx, value)
+	case contentType != "":
+		return nil, "", 0, fmt.Errorf("unsupported content-type %q", contentType)
+	case IsWireFormat(value):
+		return d.decodeProtobuf(ctx, value)
+	default:
+		order, err := d.decodeJSON(topic, value)
+		return order, FormatJSON, 0, err
+	}
+}
+
+func (d *Decoder) decodeJSON(topic string, value []byte) (*db.FullOrder, error) {
+	var order db.FullOrder
+	if err := DecodeJSON(value, &order, d.Strict(topic)); err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+func (d *Decoder) decodeProtobuf(ctx context.Context, value []byte) (*db.FullOrder, Format, int, error) {
+	schemaID, msgIndexes, payload, err := decodeWire(value)
+	if err != nil {
+		return nil, FormatProtobuf, 0, fmt.Errorf("decode protobuf: %w", err)
+	}
+	// по id схемы отличаем сообщение старого продюсера (схема есть в registry) от битого
+	schema, err := d.registry.SchemaByID(ctx, schemaID)
+	if err != nil {
+		return nil, FormatProtobuf, schemaID, fmt.Errorf("decode protobuf: %w", err)
+	}
+	if schema.SchemaType != SchemaTypeProtobuf {
+		return nil, FormatProtobuf, schemaID, fmt.Errorf("decode protobuf: schema %d has type %s", schemaID, schema.SchemaType)
+	}
+	if len(msgIndexes) != 1 || msgIndexes[0] != 0 {
+		return nil, FormatProtobuf, schemaID, fmt.Errorf("decode protobuf: unexpected message indexes %v", msgIndexes)
+	}
+	order, err := UnmarshalOrderProto(payload)
+	if err != nil {
+		return nil, FormatProtobuf, schemaID, err
+	}
+	return order, FormatProtobuf, schemaID, nil
+}
+
+// Encoder кодирует заказы для продюсеров, схема регистрируется при первой отправке
+type Encoder struct {
+	registry Registry
+	format   Format
+	once     sync.Once
+	schemaID int
+	err      error
+}
+
+func NewEncoder(registry Registry, format Format) *Encoder {
+	return &Encoder{registry: registry, format: format}
+}
+
+// EncodeOrder возвращает тело сообщения и заголовки кафки
+func (e *Encoder) EncodeOrder(ctx context.Context, order *db.FullOrder) ([]byte, map[string]string, error) {
+	if e.format != FormatProtobuf {
+		data, err := json.Marshal(order)
+		return data, map[string]string{HeaderContentType: ContentTypeJSON}, err
+	}
+	e.once.Do(func() {
+		e.schemaID, e.err = e.registry.Register(ctx, OrdersSubject, SchemaTypeProtobuf, OrderProtoSchema)
+	})
+	if e.err != nil {
+		return nil, nil, e.err
+	}
+	return encodeWire(e.schemaID, []int{0}, MarshalOrderProto(order)),
+		map[string]string{HeaderContentType: ContentTypeProtobuf}, nil
+}
+
+func moneyDecodeError(err error) error {
+	fe := FieldError{Kind: ErrKindInvalidValue, Message: err.Error()}
+	var me *db.MoneyError
+	if errors.As(err, &me) {
+		fe.Path, fe.Message = me.Path, me.Err.Error()
+	}
+	if errors.Is(err, db.ErrMoneyOverflow) || errors.Is(err, db.ErrMoneyScale) {
+		fe.Kind = ErrKindOutOfRange
+	}
+	return &DecodeError{Errors: []FieldError{fe}}
+}
@@ -0,0 +1,230 @@
+package codec
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	db "wb/postgresql"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func testOrder() *db.FullOrder {
+	sig, req := "", "req-1"
+	return &db.FullOrder{
+		Orders: db.Orders{
+			OrderUID:          "b563feb7b2b84b6test",
+			TrackNumber:       "WBILMTESTTRACK",
+			Entry:             "WBIL",
+			Locale:            "ru",
+			InternalSignature: &sig,
+			CustomerID:        "test",
+			DeliveryService:   "meest",
+			Shardkey:          "9",
+			SmID:              99,
+			DateCreated:       time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC),
+			OofShard:          "1",
+		},
+		Delivery: db.Delivery{Name: "Тест Тестов", Phone: "+9720000000", Zip: "2639809", City: "Kiryat Mozkin",
+			Address: "Ploshad Mira 15", Region: "Kraiot", Email: "test@gmail.com"},
+		Payment: db.Payment{
+			Transaction:  "b563feb7b2b84b6test",
+			RequestID:    &req,
+			Currency:     "USD",
+			Provider:     "wbpay",
+			Amount:       db.NewMoney(181750, "USD"),
+			PaymentDT:    1637907727,
+			Bank:         "alpha",
+			DeliveryCost: db.NewMoney(150000, "USD"),
+			GoodsTotal:   db.NewMoney(31750, "USD"),
+			CustomFee:    db.NewMoney(0, "USD"),
+		},
+		Items: []db.Item{
+			{ChrtID: 9934930, TrackNumber: "WBILMTESTTRACK", Price: db.NewMoney(45300, "USD"), Rid: "ab4219087a764ae0btest",
+				Name: "Mascaras", Sale: 30, Size: "0", TotalPrice: db.NewMoney(31710, "USD"), NmID: 2389212,
+				Brand: "Vivienne Sabo", Status: 202},
+			{ChrtID: -1, Price: db.NewMoney(-40, "USD"), TotalPrice: db.NewMoney(40, "USD")},
+		},
+	}
+}
+
+func TestProtobufRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	registry := NewMemoryRegistry()
+	enc := NewEncoder(registry, FormatProtobuf)
+	dec := NewDecoder(registry, nil)
+
+	order := testOrder()
+	data, headers, err := enc.EncodeOrder(ctx, order)
+	if err != nil {
+		t.Fatalf("EncodeOrder: %v", err)
+	}
+	if headers[HeaderContentType] != ContentTypeProtobuf {
+		t.Errorf("content-type = %q, want %q", headers[HeaderContentType], ContentTypeProtobuf)
+	}
+	// второе сообщение использует ту же схему, а не регистрирует новую версию
+	again, _, err := enc.EncodeOrder(ctx, order)
+	if err != nil {
+		t.Fatalf("EncodeOrder: %v", err)
+	}
+	firstID, _, _, _ := decodeWire(data)
+	secondID, _, _, _ := decodeWire(again)
+	if firstID != secondID {
+		t.Errorf("schema id changed: %d, %d", firstID, secondID)
+	}
+
+	for _, h := range []map[string]string{headers, nil} {
+		got, format, schemaID, err := dec.DecodeOrder(ctx, "orders", h, data)
+		if err != nil {
+			t.Fatalf("DecodeOrder(%v): %v", h, err)
+		}
+		if format != FormatProtobuf || schemaID != firstID {
+			t.Errorf("DecodeOrder(%v) format %s schema %d, want %s %d", h, format, schemaID, FormatProtobuf, firstID)
+		}
+		if !reflect.DeepEqual(got, order) {
+			t.Errorf("DecodeOrder(%v) =\n%+v\nwant\n%+v", h, got, order)
+		}
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	registry := NewMemoryRegistry()
+	order := testOrder()
+	data, headers, err := NewEncoder(registry, FormatJSON).EncodeOrder(ctx, order)
+	if err != nil {
+		t.Fatalf("EncodeOrder: %v", err)
+	}
+	for _, h := range []map[string]string{headers, nil} {
+		got, format, _, err := NewDecoder(registry, []string{"orders"}).DecodeOrder(ctx, "orders", h, data)
+		if err != nil {
+			t.Fatalf("DecodeOrder(%v): %v", h, err)
+		}
+		if format != FormatJSON || !reflect.DeepEqual(got, order) {
+			t.Errorf("DecodeOrder(%v) = %s %+v, want %+v", h, format, got, order)
+		}
+	}
+}
+
+func TestDecodeSchemaErrors(t *testing.T) {
+	ctx := context.Background()
+	registry := NewMemoryRegistry()
+	protoID, err := registry.Register(ctx, OrdersSubject, SchemaTypeProtobuf, OrderProtoSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	avroID, err := registry.Register(ctx, OrdersSubject, SchemaTypeAvro, `{"type":"record"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := MarshalOrderProto(testOrder())
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		data    []byte
+		want    string
+		wantErr error
+	}{
+		{"unknown schema id", nil, encodeWire(42, []int{0}, payload), "", ErrUnknownSchema},
+		{"avro schema", nil, encodeWire(avroID, []int{0}, payload), "has type AVRO", nil},
+		{"nested message index", nil, encodeWire(protoID, []int{1}, payload), "unexpected message indexes", nil},
+		{"protobuf header without framing", map[string]string{HeaderContentType: ContentTypeProtobuf}, payload, "", ErrNotWireFormat},
+		{"unsupported content-type", map[string]string{HeaderContentType: "application/avro"}, payload, "unsupported content-type", nil},
+		{"broken payload", nil, encodeWire(protoID, []int{0}, []byte{0x0a, 0x05, 0x01}), "unmarshal order proto", nil},
+	}
+	dec := NewDecoder(registry, nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, _, err := dec.DecodeOrder(ctx, "orders", tt.headers, tt.data)
+			if err == nil {
+				t.Fatal("DecodeOrder succeeded")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("DecodeOrder = %v, want %v", err, tt.wantErr)
+			}
+			if tt.want != "" && !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("DecodeOrder = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncoderRegistersSchemaOnce(t *testing.T) {
+	ctx := context.Background()
+	registry := NewMemoryRegistry()
+	if _, _, err := NewEncoder(registry, FormatProtobuf).EncodeOrder(ctx, testOrder()); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := NewEncoder(registry, FormatProtobuf).EncodeOrder(ctx, testOrder()); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(registry.bySubject[OrdersSubject]); got != 1 {
+		t.Errorf("%s has %d versions, want 1", OrdersSubject, got)
+	}
+}
+
+func TestUnmarshalLegacyMoneyFields(t *testing.T) {
+	varint := func(num protowire.Number, v int64) []byte {
+		return protowire.AppendVarint(protowire.AppendTag(nil, num, protowire.VarintType), uint64(v))
+	}
+	str := func(num protowire.Number, v string) []byte {
+		return protowire.AppendString(protowire.AppendTag(nil, num, protowire.BytesType), v)
+	}
+	payment := func(fields ...[]byte) []byte {
+		var p []byte
+		for _, f := range fields {
+			p = append(p, f...)
+		}
+		return appendMessage(nil, 3, p)
+	}
+	tests := []struct {
+		name string
+		data []byte
+		want db.Money
+	}{
+		{"int64 from old producer", payment(varint(6, 1817)), db.Money{Minor: 1817}},
+		{"string under old number", payment(str(6, "1817.50")), db.Money{Minor: 181750, Scale: 2}},
+		{"decimal field", payment(str(12, "1817.50")), db.Money{Minor: 181750, Scale: 2}},
+		{"decimal wins after legacy", payment(varint(6, 1817), str(12, "1817.50")), db.Money{Minor: 181750, Scale: 2}},
+		{"decimal wins before legacy", payment(str(12, "1817.50"), varint(6, 1817)), db.Money{Minor: 181750, Scale: 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o, err := UnmarshalOrderProto(tt.data)
+			if err != nil {
+				t.Fatalf("UnmarshalOrderProto: %v", err)
+			}
+			if o.Payment.Amount != tt.want {
+				t.Errorf("amount = %+v, want %+v", o.Payment.Amount, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarshalWritesLegacyMoneyFields(t *testing.T) {
+	fields := map[protowire.Number]any{}
+	b := marshalPayment(&db.Payment{Amount: db.NewMoney(181700, "USD"), GoodsTotal: db.NewMoney(31750, "USD")})
+	if err := walk(b, func(f field) error {
+		if f.typ == protowire.VarintType {
+			fields[f.num] = int64(f.varint)
+		} else {
+			fields[f.num] = string(f.bytes)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	want := map[protowire.Number]any{
+		6:  int64(1817), // целая сумма дублируется для старых консьюмеров
+		12: "1817.00",
+		14: "317.50", // дробная только в новом поле
+	}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("payment fields = %v, want %v", fields, want)
+	}
+}
@@ -0,0 +1,422 @@
+package codec
+
+import (
+	_ "embed"
+	"fmt"
+	"time"
+
+	db "wb/postgresql"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// OrderProtoSchema схема из order.proto, ее регистрируем в schema registry
+//
+//go:embed order.proto
+var OrderProtoSchema string
+
+// кодирование сделано вручную через protowire, чтобы не тащить protoc и сгенерированный код
+// номера полей должны совпадать с order.proto
+
+// MarshalOrderProto кодирует заказ в protobuf (сообщение wb.orders.v1.FullOrder)
+func MarshalOrderProto(o *db.FullOrder) []byte {
+	var b []byte
+	b = appendMessage(b, 1, marshalOrders(&o.Orders))
+	b = appendMessage(b, 2, marshalDelivery(&o.Delivery))
+	b = appendMessage(b, 3, marshalPayment(&o.Payment))
+	for i := range o.Items {
+		b = appendMessage(b, 4, marshalItem(&o.Items[i]))
+	}
+	return b
+}
+
+func marshalOrders(o *db.Orders) []byte {
+	var b []byte
+	b = appendString(b, 1, o.OrderUID)
+	b = appendString(b, 2, o.TrackNumber)
+	b = appendString(b, 3, o.Entry)
+	b = appendString(b, 4, o.Locale)
+	b = appendOptionalString(b, 5, o.InternalSignature)
+	b = appendString(b, 6, o.CustomerID)
+	b = appendString(b, 7, o.DeliveryService)
+	b = appendString(b, 8, o.Shardkey)
+	b = appendInt(b, 9, int64(o.SmID))
+	if !o.DateCreated.IsZero() {
+		b = appendString(b, 10, o.DateCreated.Format(time.RFC3339Nano))
+	}
+	b = appendString(b, 11, o.OofShard)
+	return b
+}
+
+func marshalDelivery(d *db.Delivery) []byte {
+	var b []byte
+	b = appendString(b, 1, d.OrderUID)
+	b = appendString(b, 2, d.Name)
+	b = appendString(b, 3, d.Phone)
+	b = appendString(b, 4, d.Zip)
+	b = appendString(b, 5, d.City)
+	b = appendString(b, 6, d.Address)
+	b = appendString(b, 7, d.Region)
+	b = appendString(b, 8, d.Email)
+	return b
+}
+
+func marshalPayment(p *db.Payment) []byte {
+	var b []byte
+	b = appendString(b, 1, p.OrderUID)
+	b = appendString(b, 2, p.Transaction)
+	b = appendOptionalString(b, 3, p.RequestID)
+	b = appendString(b, 4, p.Currency)
+	b = appendString(b, 5, p.Provider)
+	b = appendMoney(b, 6, 12, p.Amount)
+	b = appendInt(b, 7, p.PaymentDT)
+	b = appendString(b, 8, p.Bank)
+	b = appendMoney(b, 9, 13, p.DeliveryCost)
+	b = appendMoney(b, 10, 14, p.GoodsTotal)
+	b = appendMoney(b, 11, 15, p.CustomFee)
+	return b
+}
+
+func marshalItem(i *db.Item) []byte {
+	var b []byte
+	b = appendString(b, 1, i.OrderUID)
+	b = appendInt(b, 2, i.ChrtID)
+	b = appendString(b, 3, i.TrackNumber)
+	b = appendMoney(b, 4, 13, i.Price)
+	b = appendString(b, 5, i.Rid)
+	b = appendString(b, 6, i.Name)
+	b = appendInt(b, 7, int64(i.Sale))
+	b = appendString(b, 8, i.Size)
+	b = appendMoney(b, 9, 14, i.TotalPrice)
+	b = appendInt(b, 10, i.NmID)
+	b = appendString(b, 11, i.Brand)
+	b = appendInt(b, 12, int64(i.Status))
+	return b
+}
+
+// в proto3 нулевые значения не пишутся
+func appendString(b []byte, num protowire.Number, v string) []byte {
+	if v == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, v)
+}
+
+// optional поле пишется, даже если строка пустая, чтобы отличать "" от отсутствия
+func appendOptionalString(b []byte, num protowire.Number, v *string) []byte {
+	if v == nil {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, *v)
+}
+
+func appendInt(b []byte, num protowire.Number, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(v))
+}
+
+// суммы пишутся десятичной строкой в decimal, а целые суммы еще и в прежнее int64 поле legacy
+// для старых консьюмеров; ноль не пишется, как и остальные нулевые значения
+func appendMoney(b []byte, legacy, decimal protowire.Number, m db.Money) []byte {
+	if m.Minor == 0 {
+		return b
+	}
+	if whole, err := m.Rescale(0); err == nil {
+		b = appendInt(b, legacy, whole.Minor)
+	}
+	return appendString(b, decimal, m.String())
+}
+
+func appendMessage(b []byte, num protowire.Number, v []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+// field одно поле при разборе сообщения
+type field struct {
+	num    protowire.Number
+	typ    protowire.Type
+	varint uint64
+	bytes  []byte
+}
+
+func (f field) str() (string, error) {
+	if f.typ != protowire.BytesType {
+		return "", fmt.Errorf("field %d: expected bytes, got wire type %d", f.num, f.typ)
+	}
+	return string(f.bytes), nil
+}
+
+func (f field) money() (db.Money, error) {
+	s, err := f.str()
+	if err != nil {
+		return db.Money{}, err
+	}
+	m, err := db.ParseMoney(s)
+	if err != nil {
+		return db.Money{}, fmt.Errorf("field %d: %w", f.num, err)
+	}
+	return m, nil
+}
+
+// legacyMoney прежнее поле суммы: int64 в целых основных единицах; десятичная строка под тем же номером
+// осталась в сообщениях, записанных до переноса сумм в новые поля
+func (f field) legacyMoney() (db.Money, error) {
+	if f.typ == protowire.BytesType {
+		return f.money()
+	}
+	n, err := f.int()
+	return db.Money{Minor: n}, err
+}
+
+// moneyFields суммы сообщения: десятичное поле важнее прежнего, в каком бы порядке они ни пришли
+type moneyFields struct {
+	legacy  map[protowire.Number]*db.Money
+	decimal map[protowire.Number]*db.Money
+	seen    map[*db.Money]bool
+}
+
+func newMoneyFields() *moneyFields {
+	return &moneyFields{
+		legacy:  make(map[protowire.Number]*db.Money),
+		decimal: make(map[protowire.Number]*db.Money),
+		seen:    make(map[*db.Money]bool),
+	}
+}
+
+// add сумма dst хранится в полях legacy и decimal
+func (mf *moneyFields) add(legacy, decimal protowire.Number, dst *db.Money) {
+	mf.legacy[legacy], mf.decimal[decimal] = dst, dst
+}
+
+// read разбирает поле суммы; false — поле не денежное
+func (mf *moneyFields) read(f field) (bool, error) {
+	if dst, ok := mf.decimal[f.num]; ok {
+		m, err := f.money()
+		*dst, mf.seen[dst] = m, true
+		return true, err
+	}
+	if dst, ok := mf.legacy[f.num]; ok {
+		if mf.seen[dst] {
+			return true, nil
+		}
+		m, err := f.legacyMoney()
+		*dst = m
+		return true, err
+	}
+	return false, nil
+}
+
+func (f field) int() (int64, error) {
+	if f.typ != protowire.VarintType {
+		return 0, fmt.Errorf("field %d: expected varint, got wire type %d", f.num, f.typ)
+	}
+	return int64(f.varint), nil
+}
+
+// walk перебирает поля сообщения, неизвестные номера полей пропускаются вызывающим кодом
+func walk(b []byte, fn func(f field) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		f := field{num: num, typ: typ}
+		switch typ {
+		case protowire.VarintType:
+			f.varint, n = protowire.ConsumeVarint(b)
+		case protowire.BytesType:
+			f.bytes, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UnmarshalOrderProto разбирает protobuf сообщение wb.orders.v1.FullOrder
+func UnmarshalOrderProto(b []byte) (*db.FullOrder, error) {
+	var o db.FullOrder
+	err := walk(b, func(f field) error {
+		if f.num < 1 || f.num > 4 {
+			return nil
+		}
+		if f.typ != protowire.BytesType {
+			return fmt.Errorf("field %d: expected message, got wire type %d", f.num, f.typ)
+		}
+		switch f.num {
+		case 1:
+			return unmarshalOrders(f.bytes, &o.Orders)
+		case 2:
+			return unmarshalDelivery(f.bytes, &o.Delivery)
+		case 3:
+			return unmarshalPayment(f.bytes, &o.Payment)
+		default:
+			var item db.Item
+			if err := unmarshalItem(f.bytes, &item); err != nil {
+				return fmt.Errorf("items[%d]: %w", len(o.Items), err)
+			}
+			o.Items = append(o.Items, item)
+			return nil
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal order proto: %w", err)
+	}
+	return &o, nil
+}
+
+func unmarshalOrders(b []byte, o *db.Orders) error {
+	err := walk(b, func(f field) (err error) {
+		var n int64
+		switch f.num {
+		case 1:
+			o.OrderUID, err = f.str()
+		case 2:
+			o.TrackNumber, err = f.str()
+		case 3:
+			o.Entry, err = f.str()
+		case 4:
+			o.Locale, err = f.str()
+		case 5:
+			var s string
+			s, err = f.str()
+			o.InternalSignature = &s
+		case 6:
+			o.CustomerID, err = f.str()
+		case 7:
+			o.DeliveryService, err = f.str()
+		case 8:
+			o.Shardkey, err = f.str()
+		case 9:
+			n, err = f.int()
+			o.SmID = int32(n)
+		case 10:
+			var s string
+			if s, err = f.str(); err == nil {
+				o.DateCreated, err = time.Parse(time.RFC3339Nano, s)
+			}
+		case 11:
+			o.OofShard, err = f.str()
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("orders: %w", err)
+	}
+	return nil
+}
+
+func unmarshalDelivery(b []byte, d *db.Delivery) error {
+	err := walk(b, func(f field) (err error) {
+		switch f.num {
+		case 1:
+			d.OrderUID, err = f.str()
+		case 2:
+			d.Name, err = f.str()
+		case 3:
+			d.Phone, err = f.str()
+		case 4:
+			d.Zip, err = f.str()
+		case 5:
+			d.City, err = f.str()
+		case 6:
+			d.Address, err = f.str()
+		case 7:
+			d.Region, err = f.str()
+		case 8:
+			d.Email, err = f.str()
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("delivery: %w", err)
+	}
+	return nil
+}
+
+func unmarshalPayment(b []byte, p *db.Payment) error {
+	money := newMoneyFields()
+	money.add(6, 12, &p.Amount)
+	money.add(9, 13, &p.DeliveryCost)
+	money.add(10, 14, &p.GoodsTotal)
+	money.add(11, 15, &p.CustomFee)
+	err := walk(b, func(f field) (err error) {
+		if ok, err := money.read(f); ok {
+			return err
+		}
+		switch f.num {
+		case 1:
+			p.OrderUID, err = f.str()
+		case 2:
+			p.Transaction, err = f.str()
+		case 3:
+			var s string
+			s, err = f.str()
+			p.RequestID = &s
+		case 4:
+			p.Currency, err = f.str()
+		case 5:
+			p.Provider, err = f.str()
+		case 7:
+			p.PaymentDT, err = f.int()
+		case 8:
+			p.Bank, err = f.str()
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("payment: %w", err)
+	}
+	return nil
+}
+
+func unmarshalItem(b []byte, i *db.Item) error {
+	money := newMoneyFields()
+	money.add(4, 13, &i.Price)
+	money.add(9, 14, &i.TotalPrice)
+	return walk(b, func(f field) (err error) {
+		if ok, err := money.read(f); ok {
+			return err
+		}
+		var n int64
+		switch f.num {
+		case 1:
+			i.OrderUID, err = f.str()
+		case 2:
+			i.ChrtID, err = f.int()
+		case 3:
+			i.TrackNumber, err = f.str()
+		case 5:
+			i.Rid, err = f.str()
+		case 6:
+			i.Name, err = f.str()
+		case 7:
+			n, err = f.int()
+			i.Sale = int32(n)
+		case 8:
+			i.Size, err = f.str()
+		case 10:
+			i.NmID, err = f.int()
+		case 11:
+			i.Brand, err = f.str()
+		case 12:
+			n, err = f.int()
+			i.Status = int32(n)
+		}
+		return err
+	})
+}
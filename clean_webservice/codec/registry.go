@@ -0,0 +1,194 @@
+package codec
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+)
+
+const (
+	SchemaTypeProtobuf = "PROTOBUF"
+	SchemaTypeAvro     = "AVRO"
+)
+
+// ErrUnknownSchema в registry нет схемы с таким id
+var ErrUnknownSchema = errors.New("unknown schema")
+
+type (
+	Schema struct {
+		ID         int    `json:"id"`
+		Subject    string `json:"subject,omitempty"`
+		Version    int    `json:"version,omitempty"`
+		SchemaType string `json:"schemaType,omitempty"`
+		Schema     string `json:"schema"`
+	}
+	// Registry то немногое из API Confluent Schema Registry, что нужно сервису
+	Registry interface {
+		Register(ctx context.Context, subject, schemaType, schema string) (int, error)
+		SchemaByID(ctx context.Context, id int) (Schema, error)
+	}
+)
+
+// MemoryRegistry локальная замена schema registry: для тестов и запуска без отдельного сервиса
+type MemoryRegistry struct {
+	mu        sync.RWMutex
+	byID      map[int]Schema
+	bySubject map[string][]int
+}
+
+func NewMemoryRegistry() *MemoryRegistry {
+	return &MemoryRegistry{byID: make(map[int]Schema), bySubject: make(map[string][]int)}
+}
+
+// Register возвращает id уже зарегистрированной схемы, если текст совпадает, иначе заводит новую версию
+func (r *MemoryRegistry) Register(_ context.Context, subject, schemaType, schema string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, id := range r.bySubject[subject] {
+		if s := r.byID[id]; s.Schema == schema && s.SchemaType == schemaType {
+			return id, nil
+		}
+	}
+	id := len(r.byID) + 1
+	r.byID[id] = Schema{
+		ID:         id,
+		Subject:    subject,
+		Version:    len(r.bySubject[subject]) + 1,
+		SchemaType: schemaType,
+		Schema:     schema,
+	}
+	r.bySubject[subject] = append(r.bySubject[subject], id)
+	return id, nil
+}
+
+func (r *MemoryRegistry) SchemaByID(_ context.Context, id int) (Schema, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	s, ok := r.byID[id]
+	if !ok {
+		return Schema{}, fmt.Errorf("schema id %d: %w", id, ErrUnknownSchema)
+	}
+	return s, nil
+}
+
+// NewRegistryHandler отдает MemoryRegistry по REST API schema registry (только регистрация и поиск по id),
+// так клиентов можно проверять против httptest.Server без настоящего registry
+func NewRegistryHandler(r *MemoryRegistry) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /subjects/{subject}/versions", func(w http.ResponseWriter, req *http.Request) {
+		var body struct {
+			Schema     string `json:"schema"`
+			SchemaType string `json:"schemaType"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			writeRegistryError(w, http.StatusUnprocessableEntity, 42201, err.Error())
+			return
+		}
+		if body.SchemaType == "" {
+			body.SchemaType = SchemaTypeAvro
+		}
+		id, _ := r.Register(req.Context(), req.PathValue("subject"), body.SchemaType, body.Schema)
+		writeRegistryJSON(w, http.StatusOK, map[string]int{"id": id})
+	})
+	mux.HandleFunc("GET /schemas/ids/{id}", func(w http.ResponseWriter, req *http.Request) {
+		id, err := strconv.Atoi(req.PathValue("id"))
+		if err != nil {
+			writeRegistryError(w, http.StatusNotFound, 40403, "Schema not found")
+			return
+		}
+		s, err := r.SchemaByID(req.Context(), id)
+		if err != nil {
+			writeRegistryError(w, http.StatusNotFound, 40403, "Schema not found")
+			return
+		}
+		writeRegistryJSON(w, http.StatusOK, Schema{Schema: s.Schema, SchemaType: s.SchemaType})
+	})
+	return mux
+}
+
+func writeRegistryJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/vnd.schemaregistry.v1+json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeRegistryError(w http.ResponseWriter, status, code int, msg string) {
+	writeRegistryJSON(w, status, map[string]any{"error_code": code, "message": msg})
+}
+
+// HTTPRegistry клиент настоящего schema registry, схемы кешируются по id — они неизменяемые
+type HTTPRegistry struct {
+	baseURL string
+	client  *http.Client
+	mu      sync.RWMutex
+	cache   map[int]Schema
+}
+
+func NewHTTPRegistry(baseURL string) *HTTPRegistry {
+	return &HTTPRegistry{baseURL: baseURL, client: http.DefaultClient, cache: make(map[int]Schema)}
+}
+
+func (r *HTTPRegistry) Register(ctx context.Context, subject, schemaType, schema string) (int, error) {
+	body, err := json.Marshal(map[string]string{"schema": schema, "schemaType": schemaType})
+	if err != nil {
+		return 0, err
+	}
+	var resp struct {
+		ID int `json:"id"`
+	}
+	path := "/subjects/" + url.PathEscape(subject) + "/versions"
+	if err := r.do(ctx, http.MethodPost, path, body, &resp); err != nil {
+		return 0, fmt.Errorf("register schema %s: %w", subject, err)
+	}
+	return resp.ID, nil
+}
+
+func (r *HTTPRegistry) SchemaByID(ctx context.Context, id int) (Schema, error) {
+	r.mu.RLock()
+	s, ok := r.cache[id]
+	r.mu.RUnlock()
+	if ok {
+		return s, nil
+	}
+	if err := r.do(ctx, http.MethodGet, "/schemas/ids/"+strconv.Itoa(id), nil, &s); err != nil {
+		return Schema{}, fmt.Errorf("schema id %d: %w", id, err)
+	}
+	if s.SchemaType == "" {
+		s.SchemaType = SchemaTypeAvro // registry не пишет тип для avro
+	}
+	s.ID = id
+	r.mu.Lock()
+	r.cache[id] = s
+	r.mu.Unlock()
+	return s, nil
+}
+
+func (r *HTTPRegistry) do(ctx context.Context, method, path string, body []byte, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, r.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.schemaregistry.v1+json")
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrUnknownSchema
+	}
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Message string `json:"message"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&e)
+		return fmt.Errorf("registry: %s: %s", resp.Status, e.Message)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
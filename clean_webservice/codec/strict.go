@@ -0,0 +1,289 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	db "wb/postgresql"
+)
+
+// виды ошибок декодирования, используются как лейбл метрик и в сообщении для DLQ
+const (
+	ErrKindSyntax        = "syntax"
+	ErrKindUnknownField  = "unknown_field"
+	ErrKindMissingField  = "missing_field"
+	ErrKindTypeMismatch  = "type_mismatch"
+	ErrKindOutOfRange    = "out_of_range"
+	ErrKindInvalidValue  = "invalid_value"
+	ErrKindInvalidFormat = "invalid_payload"
+)
+
+type (
+	// FieldError одна ошибка декодирования с путем до поля, например items[3].price
+	FieldError struct {
+		Path    string `json:"path,omitempty"`
+		Kind    string `json:"kind"`
+		Message string `json:"message"`
+	}
+	// DecodeError все ошибки, найденные в сообщении
+	DecodeError struct {
+		Errors []FieldError `json:"errors"`
+	}
+)
+
+func (e *DecodeError) Error() string {
+	parts := make([]string, 0, len(e.Errors))
+	for _, fe := range e.Errors {
+		if fe.Path != "" {
+			parts = append(parts, fe.Path+": "+fe.Message)
+		} else {
+			parts = append(parts, fe.Message)
+		}
+	}
+	return "decode: " + strings.Join(parts, "; ")
+}
+
+// FieldErrors достает структурированные ошибки, любая другая ошибка становится одной записью invalid_payload
+func FieldErrors(err error) []FieldError {
+	var de *DecodeError
+	if errors.As(err, &de) {
+		return de.Errors
+	}
+	var me *db.MoneyError
+	if errors.As(err, &me) {
+		return []FieldError{{Path: me.Path, Kind: ErrKindInvalidValue, Message: me.Err.Error()}}
+	}
+	return []FieldError{{Kind: ErrKindInvalidFormat, Message: err.Error()}}
+}
+
+// DecodeJSON разбирает json в v
+// в строгом режиме запрещены неизвестные поля, обязательны все поля без omitempty,
+// а типы и диапазоны чисел проверяются с точным путем до поля; ошибки собираются все сразу
+func DecodeJSON(data []byte, v any, strict bool) error {
+	if !strict {
+		if err := json.Unmarshal(data, v); err != nil {
+			return lenientError(err)
+		}
+		return nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return lenientError(err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return &DecodeError{Errors: []FieldError{{Kind: ErrKindSyntax, Message: "unexpected data after top-level value"}}}
+	}
+
+	var errs []FieldError
+	validate("", reflect.TypeOf(v).Elem(), doc, &errs)
+	if len(errs) > 0 {
+		return &DecodeError{Errors: errs}
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return lenientError(err)
+	}
+	return nil
+}
+
+func lenientError(err error) error {
+	var (
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+		fe        FieldError
+	)
+	switch {
+	case errors.As(err, &syntaxErr):
+		fe = FieldError{Kind: ErrKindSyntax, Message: fmt.Sprintf("%v (offset %d)", syntaxErr, syntaxErr.Offset)}
+	case errors.As(err, &typeErr):
+		fe = FieldError{Path: typeErr.Field, Kind: ErrKindTypeMismatch,
+			Message: fmt.Sprintf("expected %s, got %s", typeErr.Type, typeErr.Value)}
+	default:
+		fe = FieldError{Kind: ErrKindInvalidValue, Message: err.Error()}
+	}
+	return &DecodeError{Errors: []FieldError{fe}}
+}
+
+var (
+	timeType        = reflect.TypeOf(time.Time{})
+	unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+)
+
+// validate сверяет разобранный json (map/slice/json.Number/...) с типом Go
+func validate(path string, t reflect.Type, v any, errs *[]FieldError) {
+	addErr := func(kind, format string, args ...any) {
+		*errs = append(*errs, FieldError{Path: path, Kind: kind, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if t.Kind() == reflect.Pointer {
+		if v == nil {
+			return
+		}
+		t = t.Elem()
+	}
+	if v == nil {
+		addErr(ErrKindMissingField, "must not be null")
+		return
+	}
+
+	switch {
+	case t == timeType:
+		s, ok := v.(string)
+		if !ok {
+			addErr(ErrKindTypeMismatch, "expected RFC3339 string, got %s", jsonKind(v))
+			return
+		}
+		if _, err := time.Parse(time.RFC3339, s); err != nil {
+			addErr(ErrKindInvalidValue, "expected RFC3339 time, got %q", s)
+		}
+		return
+	case reflect.PointerTo(t).Implements(unmarshalerType):
+		// тип сам разбирает свой json (Money): разбираем значение здесь, чтобы ошибка получила путь до поля
+		raw, err := json.Marshal(v)
+		if err == nil {
+			err = reflect.New(t).Interface().(json.Unmarshaler).UnmarshalJSON(raw)
+		}
+		switch {
+		case err == nil:
+		case errors.Is(err, db.ErrMoneyOverflow) || errors.Is(err, db.ErrMoneyScale):
+			addErr(ErrKindOutOfRange, "%v", err)
+		case jsonKind(v) != "string" && jsonKind(v) != "number":
+			addErr(ErrKindTypeMismatch, "expected number or string, got %s", jsonKind(v))
+		default:
+			addErr(ErrKindInvalidValue, "%v", err)
+		}
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := v.(map[string]any)
+		if !ok {
+			addErr(ErrKindTypeMismatch, "expected object, got %s", jsonKind(v))
+			return
+		}
+		known := make(map[string]bool)
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, optional, skip := jsonField(f)
+			if skip {
+				continue
+			}
+			known[name] = true
+			child := joinPath(path, name)
+			value, ok := obj[name]
+			if !ok {
+				if !optional {
+					*errs = append(*errs, FieldError{Path: child, Kind: ErrKindMissingField, Message: "required field is missing"})
+				}
+				continue
+			}
+			validate(child, f.Type, value, errs)
+		}
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		// порядок как в сообщении не сохраняется, сортируем для стабильного вывода
+		sort.Strings(keys)
+		for _, k := range keys {
+			if !known[k] {
+				*errs = append(*errs, FieldError{Path: joinPath(path, k), Kind: ErrKindUnknownField, Message: "unknown field"})
+			}
+		}
+	case reflect.Slice:
+		arr, ok := v.([]any)
+		if !ok {
+			addErr(ErrKindTypeMismatch, "expected array, got %s", jsonKind(v))
+			return
+		}
+		for i, elem := range arr {
+			validate(fmt.Sprintf("%s[%d]", path, i), t.Elem(), elem, errs)
+		}
+	case reflect.Map:
+		obj, ok := v.(map[string]any)
+		if !ok {
+			addErr(ErrKindTypeMismatch, "expected object, got %s", jsonKind(v))
+			return
+		}
+		for k, elem := range obj {
+			validate(joinPath(path, k), t.Elem(), elem, errs)
+		}
+	case reflect.String:
+		if _, ok := v.(string); !ok {
+			addErr(ErrKindTypeMismatch, "expected string, got %s", jsonKind(v))
+		}
+	case reflect.Bool:
+		if _, ok := v.(bool); !ok {
+			addErr(ErrKindTypeMismatch, "expected boolean, got %s", jsonKind(v))
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := v.(json.Number)
+		if !ok {
+			addErr(ErrKindTypeMismatch, "expected integer, got %s", jsonKind(v))
+			return
+		}
+		if _, err := strconv.ParseInt(n.String(), 10, t.Bits()); err != nil {
+			if errors.Is(err, strconv.ErrRange) {
+				addErr(ErrKindOutOfRange, "%s does not fit into %s", n, t.Kind())
+			} else {
+				addErr(ErrKindTypeMismatch, "expected integer, got %s", n)
+			}
+		}
+	case reflect.Float32, reflect.Float64:
+		if _, ok := v.(json.Number); !ok {
+			addErr(ErrKindTypeMismatch, "expected number, got %s", jsonKind(v))
+		}
+	}
+}
+
+// jsonField имя поля в json, optional — есть omitempty, skip — поле скрыто тегом "-"
+func jsonField(f reflect.StructField) (name string, optional, skip bool) {
+	if !f.IsExported() {
+		return "", false, true
+	}
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return "", false, true
+	}
+	name, opts, _ := strings.Cut(tag, ",")
+	if name == "" {
+		name = f.Name
+	}
+	return name, strings.Contains(opts, "omitempty"), false
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func jsonKind(v any) string {
+	switch v.(type) {
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case json.Number:
+		return "number"
+	case bool:
+		return "boolean"
+	case nil:
+		return "null"
+	}
+	return fmt.Sprintf("%T", v)
+}
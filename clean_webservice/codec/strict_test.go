@@ -0,0 +1,136 @@
+package codec
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	db "wb/postgresql"
+)
+
+// orderDoc заказ testOrder с четырьмя товарами как разобранный json, чтобы портить отдельные поля
+func orderDoc(t *testing.T) map[string]any {
+	t.Helper()
+	o := testOrder()
+	o.Items = append(o.Items, o.Items[0], o.Items[0])
+	data, err := json.Marshal(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestStrictDecodeErrors(t *testing.T) {
+	item := func(doc map[string]any, i int) map[string]any { return doc["items"].([]any)[i].(map[string]any) }
+	tests := []struct {
+		name   string
+		modify func(doc map[string]any)
+		want   []FieldError // сравниваются путь и вид ошибки
+	}{
+		{"valid", func(map[string]any) {}, nil},
+		{"missing required field", func(doc map[string]any) {
+			delete(doc["payment"].(map[string]any), "currency")
+		}, []FieldError{{Path: "payment.currency", Kind: ErrKindMissingField}}},
+		{"missing optional field", func(doc map[string]any) {
+			delete(doc["payment"].(map[string]any), "request_id")
+		}, nil},
+		{"null required field", func(doc map[string]any) {
+			doc["delivery"].(map[string]any)["city"] = nil
+		}, []FieldError{{Path: "delivery.city", Kind: ErrKindMissingField}}},
+		{"unknown top-level field", func(doc map[string]any) {
+			doc["comment"] = "x"
+		}, []FieldError{{Path: "comment", Kind: ErrKindUnknownField}}},
+		{"unknown nested field", func(doc map[string]any) {
+			item(doc, 2)["color"] = "red"
+			doc["delivery"].(map[string]any)["floor"] = 3
+		}, []FieldError{{Path: "delivery.floor", Kind: ErrKindUnknownField}, {Path: "items[2].color", Kind: ErrKindUnknownField}}},
+		{"price of wrong type", func(doc map[string]any) {
+			item(doc, 3)["price"] = true
+		}, []FieldError{{Path: "items[3].price", Kind: ErrKindTypeMismatch}}},
+		{"price object", func(doc map[string]any) {
+			item(doc, 3)["price"] = map[string]any{"amount": 1}
+		}, []FieldError{{Path: "items[3].price", Kind: ErrKindTypeMismatch}}},
+		{"price not a decimal", func(doc map[string]any) {
+			item(doc, 3)["price"] = "12,50"
+		}, []FieldError{{Path: "items[3].price", Kind: ErrKindInvalidValue}}},
+		{"price as string", func(doc map[string]any) {
+			item(doc, 3)["price"] = "453.00"
+		}, nil},
+		{"price too precise", func(doc map[string]any) {
+			item(doc, 3)["price"] = "1.0000000000000000001"
+		}, []FieldError{{Path: "items[3].price", Kind: ErrKindOutOfRange}}},
+		{"int out of range", func(doc map[string]any) {
+			item(doc, 1)["sale"] = json.Number("3000000000")
+		}, []FieldError{{Path: "items[1].sale", Kind: ErrKindOutOfRange}}},
+		{"string instead of int", func(doc map[string]any) {
+			doc["orders"].(map[string]any)["sm_id"] = "99"
+		}, []FieldError{{Path: "orders.sm_id", Kind: ErrKindTypeMismatch}}},
+		{"date_created as number", func(doc map[string]any) {
+			doc["orders"].(map[string]any)["date_created"] = 1637907739
+		}, []FieldError{{Path: "orders.date_created", Kind: ErrKindTypeMismatch}}},
+		{"date_created not RFC3339", func(doc map[string]any) {
+			doc["orders"].(map[string]any)["date_created"] = "2021-11-26 06:22:19"
+		}, []FieldError{{Path: "orders.date_created", Kind: ErrKindInvalidValue}}},
+		{"items not array", func(doc map[string]any) {
+			doc["items"] = map[string]any{}
+		}, []FieldError{{Path: "items", Kind: ErrKindTypeMismatch}}},
+		{"all errors at once", func(doc map[string]any) {
+			delete(doc["orders"].(map[string]any), "order_uid")
+			item(doc, 3)["price"] = false
+			doc["extra"] = 1
+		}, []FieldError{{Path: "orders.order_uid", Kind: ErrKindMissingField}, {Path: "items[3].price", Kind: ErrKindTypeMismatch},
+			{Path: "extra", Kind: ErrKindUnknownField}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := orderDoc(t)
+			tt.modify(doc)
+			data, err := json.Marshal(doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var order db.FullOrder
+			err = DecodeJSON(data, &order, true)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("DecodeJSON: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("DecodeJSON succeeded")
+			}
+			var got []FieldError
+			for _, fe := range FieldErrors(err) {
+				if fe.Message == "" {
+					t.Errorf("%s: empty message", fe.Path)
+				}
+				got = append(got, FieldError{Path: fe.Path, Kind: fe.Kind})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("errors = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLenientDecodeIgnoresUnknownFields(t *testing.T) {
+	doc := orderDoc(t)
+	doc["comment"] = "x"
+	delete(doc["payment"].(map[string]any), "currency")
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var order db.FullOrder
+	if err := DecodeJSON(data, &order, false); err != nil {
+		t.Errorf("lenient DecodeJSON: %v", err)
+	}
+	if err := DecodeJSON([]byte(`{"orders": {"sm_id": "99"}}`), &order, false); FieldErrors(err)[0].Path != "orders.sm_id" {
+		t.Errorf("lenient type error = %v, want path orders.sm_id", err)
+	}
+}
@@ -0,0 +1,67 @@
+package codec
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Confluent wire format: 0x00, 4 байта id схемы (big endian), для protobuf еще индексы сообщения, затем payload
+const magicByte = 0
+
+// ErrNotWireFormat сообщение не начинается с magic byte
+var ErrNotWireFormat = errors.New("not confluent wire format")
+
+// IsWireFormat похоже ли сообщение на Confluent wire format, json с 0x00 начинаться не может
+func IsWireFormat(data []byte) bool {
+	return len(data) >= 5 && data[0] == magicByte
+}
+
+// encodeWire собирает сообщение, индексы [0] (первое сообщение в .proto) пишутся одним нулевым байтом
+func encodeWire(schemaID int, msgIndexes []int, payload []byte) []byte {
+	b := make([]byte, 5, 6+len(payload))
+	b[0] = magicByte
+	binary.BigEndian.PutUint32(b[1:5], uint32(schemaID))
+	if len(msgIndexes) == 1 && msgIndexes[0] == 0 {
+		b = append(b, 0)
+	} else {
+		b = protowire.AppendVarint(b, protowire.EncodeZigZag(int64(len(msgIndexes))))
+		for _, idx := range msgIndexes {
+			b = protowire.AppendVarint(b, protowire.EncodeZigZag(int64(idx)))
+		}
+	}
+	return append(b, payload...)
+}
+
+// decodeWire возвращает id схемы, индексы сообщения в .proto и сам payload
+func decodeWire(data []byte) (schemaID int, msgIndexes []int, payload []byte, err error) {
+	if !IsWireFormat(data) {
+		return 0, nil, nil, ErrNotWireFormat
+	}
+	schemaID = int(binary.BigEndian.Uint32(data[1:5]))
+	b := data[5:]
+
+	count, n := protowire.ConsumeVarint(b)
+	if n < 0 {
+		return 0, nil, nil, fmt.Errorf("message indexes: %w", protowire.ParseError(n))
+	}
+	b = b[n:]
+	size := protowire.DecodeZigZag(count)
+	if size == 0 {
+		return schemaID, []int{0}, b, nil
+	}
+	if size < 0 || size > 100 {
+		return 0, nil, nil, fmt.Errorf("message indexes: bad count %d", size)
+	}
+	for i := int64(0); i < size; i++ {
+		idx, n := protowire.ConsumeVarint(b)
+		if n < 0 {
+			return 0, nil, nil, fmt.Errorf("message indexes: %w", protowire.ParseError(n))
+		}
+		b = b[n:]
+		msgIndexes = append(msgIndexes, int(protowire.DecodeZigZag(idx)))
+	}
+	return schemaID, msgIndexes, b, nil
+}
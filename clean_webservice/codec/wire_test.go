@@ -0,0 +1,67 @@
+package codec
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestWireRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		schemaID int
+		indexes  []int
+		payload  []byte
+		header   []byte // ожидаемые байты до payload
+	}{
+		{"first message", 7, []int{0}, []byte("payload"), []byte{0, 0, 0, 0, 7, 0}},
+		{"nested message", 1, []int{1, 2}, []byte{0xff}, []byte{0, 0, 0, 0, 1, 4, 2, 4}},
+		{"empty payload", 0x01020304, []int{0}, nil, []byte{0, 1, 2, 3, 4, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := encodeWire(tt.schemaID, tt.indexes, tt.payload)
+			if !bytes.HasPrefix(data, tt.header) {
+				t.Fatalf("encodeWire = % x, want prefix % x", data, tt.header)
+			}
+			if !IsWireFormat(data) {
+				t.Fatalf("IsWireFormat(% x) = false", data)
+			}
+			id, indexes, payload, err := decodeWire(data)
+			if err != nil {
+				t.Fatalf("decodeWire: %v", err)
+			}
+			if id != tt.schemaID || !reflect.DeepEqual(indexes, tt.indexes) || !bytes.Equal(payload, tt.payload) {
+				t.Errorf("decodeWire = %d %v % x, want %d %v % x", id, indexes, payload, tt.schemaID, tt.indexes, tt.payload)
+			}
+		})
+	}
+}
+
+func TestDecodeWireErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want error // nil — любая ошибка
+	}{
+		{"json", []byte(`{"orders":{}}`), ErrNotWireFormat},
+		{"too short", []byte{0, 0, 0, 1}, ErrNotWireFormat},
+		{"no indexes", []byte{0, 0, 0, 0, 1}, nil},
+		{"truncated varint", []byte{0, 0, 0, 0, 1, 0x80}, nil},
+		{"negative count", []byte{0, 0, 0, 0, 1, 1}, nil},
+		{"too many indexes", []byte{0, 0, 0, 0, 1, 0xca, 0x01}, nil},
+		{"missing index", []byte{0, 0, 0, 0, 1, 4, 2}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, _, err := decodeWire(tt.data)
+			if err == nil {
+				t.Fatalf("decodeWire(% x) succeeded", tt.data)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Errorf("decodeWire(% x) = %v, want %v", tt.data, err, tt.want)
+			}
+		})
+	}
+}
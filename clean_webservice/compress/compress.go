@@ -0,0 +1,200 @@
+// Package compress сжатие http ответов gzip или brotli по Accept-Encoding клиента
+package compress
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+)
+
+// MinSize ответы меньше этого не сжимаются: заголовки и словарь съедят выигрыш
+const MinSize = 1024
+
+// brotliLevel 5 — близко к gzip по скорости и заметно плотнее
+const brotliLevel = 5
+
+// compressible сжимаются только текстовые типы; gzip выгрузки, parquet и картинки уже сжаты
+var compressible = []string{
+	"text/",
+	"application/json",
+	"application/x-ndjson",
+	"application/javascript",
+	"application/xml",
+	"image/svg+xml",
+}
+
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(io.Writer)
+}
+
+var pools = map[string]*sync.Pool{
+	"br": {New: func() any { return brotli.NewWriterLevel(nil, brotliLevel) }},
+	"gzip": {New: func() any {
+		w, _ := gzip.NewWriterLevel(nil, gzip.DefaultCompression)
+		return w
+	}},
+}
+
+// Middleware сжимает ответ, если клиент принимает br или gzip, тип ответа текстовый и тело не меньше MinSize;
+// ответ копится в буфере до MinSize, дальше идет потоком, Flush обработчика сбрасывает и сжатые данные
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		encoding := negotiate(c.GetHeader("Accept-Encoding"))
+		if encoding == "" || c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+		w := &writer{ResponseWriter: c.Writer, encoding: encoding}
+		c.Writer = w
+		defer func() {
+			w.close()
+			c.Writer = w.ResponseWriter
+		}()
+		c.Next()
+	}
+}
+
+// negotiate br или gzip с наибольшим q, при равенстве br; identity и неизвестные кодировки не рассматриваются
+func negotiate(header string) string {
+	var (
+		best  string
+		bestQ float64
+	)
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		if name == "*" {
+			name = "gzip"
+		}
+		if _, ok := pools[name]; !ok || q <= 0 {
+			continue
+		}
+		if q > bestQ || (q == bestQ && name == "br") {
+			best, bestQ = name, q
+		}
+	}
+	return best
+}
+
+type writer struct {
+	gin.ResponseWriter
+	encoding string
+
+	buf     []byte
+	decided bool
+	enc     encoder
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if w.decided {
+		if w.enc != nil {
+			return w.enc.Write(p)
+		}
+		return w.ResponseWriter.Write(p)
+	}
+	w.buf = append(w.buf, p...)
+	if len(w.buf) >= MinSize {
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (w *writer) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush сбрасывает накопленное: до MinSize ответ уходит несжатым
+func (w *writer) Flush() {
+	if !w.decided {
+		if err := w.decide(len(w.buf) >= MinSize); err != nil {
+			return
+		}
+	}
+	if w.enc != nil {
+		if err := w.enc.Flush(); err != nil {
+			return
+		}
+	}
+	w.ResponseWriter.Flush()
+}
+
+// decide выбирает, сжимать ли ответ, и отправляет буфер
+func (w *writer) decide(large bool) error {
+	w.decided = true
+	buf := w.buf
+	w.buf = nil
+	if large && w.shouldCompress() {
+		h := w.Header()
+		h.Set("Content-Encoding", w.encoding)
+		h.Del("Content-Length")
+		if !strings.Contains(strings.Join(h.Values("Vary"), ","), "Accept-Encoding") {
+			h.Add("Vary", "Accept-Encoding")
+		}
+		// тело меняется, поэтому сильный ETag становится слабым, как у nginx
+		if etag := h.Get("ETag"); strings.HasPrefix(etag, `"`) {
+			h.Set("ETag", "W/"+etag)
+		}
+		w.enc = pools[w.encoding].Get().(encoder)
+		w.enc.Reset(w.ResponseWriter)
+		if len(buf) == 0 {
+			return nil
+		}
+		_, err := w.enc.Write(buf)
+		return err
+	}
+	if len(buf) == 0 {
+		return nil
+	}
+	_, err := w.ResponseWriter.Write(buf)
+	return err
+}
+
+func (w *writer) shouldCompress() bool {
+	status := w.Status()
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusPartialContent ||
+		status == http.StatusNotModified {
+		return false
+	}
+	h := w.Header()
+	if h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "" {
+		return false
+	}
+	ct, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	for _, prefix := range compressible {
+		if strings.HasPrefix(ct, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// close дописывает хвост сжатого потока или отправляет короткий ответ как есть
+func (w *writer) close() {
+	if !w.decided {
+		_ = w.decide(false)
+	}
+	if w.enc == nil {
+		return
+	}
+	_ = w.enc.Close()
+	w.enc.Reset(io.Discard)
+	pools[w.encoding].Put(w.enc)
+	w.enc = nil
+}
@@ -0,0 +1,134 @@
+package compress
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", ""},
+		{"gzip", "gzip"},
+		{"br", "br"},
+		{"gzip, deflate, br", "br"},
+		{"br;q=0, gzip", "gzip"},
+		{"br;q=0.5, gzip", "gzip"},
+		{"gzip;q=0.5, br;q=0.8", "br"},
+		{"br;q=0.5, gzip;q=0.5", "br"},
+		{"gzip;q=0, br;q=0", ""},
+		{"identity", ""},
+		{"deflate, compress", ""},
+		{"*", "gzip"},
+		{"*;q=0", ""},
+		{" GZIP ; q=0.3 ", "gzip"},
+		{"br;q=bad", "br"},
+	}
+	for _, tt := range tests {
+		if got := negotiate(tt.header); got != tt.want {
+			t.Errorf("negotiate(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	large := `{"orders":"` + strings.Repeat("a", 2*MinSize) + `"}`
+	small := `{"ok":true}`
+	router := gin.New()
+	router.Use(Middleware())
+	router.GET("/large", func(c *gin.Context) {
+		c.Header("ETag", `"abc"`)
+		c.Data(http.StatusOK, "application/json", []byte(large))
+	})
+	router.HEAD("/large", func(c *gin.Context) {
+		c.Header("ETag", `"abc"`)
+		c.Status(http.StatusOK)
+	})
+	router.GET("/small", func(c *gin.Context) { c.Data(http.StatusOK, "application/json", []byte(small)) })
+	router.GET("/image", func(c *gin.Context) { c.Data(http.StatusOK, "image/png", []byte(large)) })
+	router.GET("/not-modified", func(c *gin.Context) { c.Status(http.StatusNotModified) })
+	// большой ответ, отданный несколькими записями меньше MinSize
+	router.GET("/chunks", func(c *gin.Context) {
+		c.Header("Content-Type", "text/plain")
+		for range 4 {
+			c.Writer.WriteString(strings.Repeat("b", MinSize/2))
+		}
+	})
+
+	decode := func(t *testing.T, encoding string, body io.Reader) string {
+		t.Helper()
+		var r io.Reader
+		switch encoding {
+		case "gzip":
+			zr, err := gzip.NewReader(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r = zr
+		case "br":
+			r = brotli.NewReader(body)
+		default:
+			r = body
+		}
+		data, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	tests := []struct {
+		name, path, accept string
+		method             string
+		wantEncoding       string
+		wantBody           string
+		wantETag           string
+	}{
+		{name: "gzip", path: "/large", accept: "gzip", wantEncoding: "gzip", wantBody: large, wantETag: `W/"abc"`},
+		{name: "br preferred", path: "/large", accept: "gzip, br", wantEncoding: "br", wantBody: large, wantETag: `W/"abc"`},
+		{name: "br disabled", path: "/large", accept: "br;q=0, gzip;q=0.5", wantEncoding: "gzip", wantBody: large,
+			wantETag: `W/"abc"`},
+		{name: "no accept-encoding", path: "/large", wantBody: large, wantETag: `"abc"`},
+		{name: "below MinSize", path: "/small", accept: "gzip, br", wantBody: small},
+		{name: "not compressible", path: "/image", accept: "gzip", wantBody: large},
+		{name: "not modified", path: "/not-modified", accept: "gzip"},
+		{name: "head", path: "/large", method: http.MethodHead, accept: "gzip", wantETag: `"abc"`},
+		{name: "small writes", path: "/chunks", accept: "gzip", wantEncoding: "gzip", wantBody: strings.Repeat("b", 2*MinSize)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req := httptest.NewRequest(method, tt.path, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept-Encoding", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if got := w.Header().Get("Content-Encoding"); got != tt.wantEncoding {
+				t.Fatalf("Content-Encoding = %q, want %q", got, tt.wantEncoding)
+			}
+			if got := decode(t, tt.wantEncoding, w.Body); got != tt.wantBody {
+				t.Errorf("body = %d bytes, want %d", len(got), len(tt.wantBody))
+			}
+			if got := w.Header().Get("ETag"); got != tt.wantETag {
+				t.Errorf("ETag = %q, want %q", got, tt.wantETag)
+			}
+			if tt.wantEncoding != "" && !strings.Contains(w.Header().Get("Vary"), "Accept-Encoding") {
+				t.Error("compressed response without Vary: Accept-Encoding")
+			}
+		})
+	}
+}
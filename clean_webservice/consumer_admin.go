@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"wb/kafka"
+
+	"github.com/gin-gonic/gin"
+)
+
+// adminTimeout сколько ждать команду консьюмеру: она выполняется между вызовами Poll
+const adminTimeout = 30 * time.Second
+
+// parsePartitions номера партиций через запятую, пусто — все назначенные
+func parsePartitions(values ...string) ([]int32, error) {
+	var partitions []int32
+	for _, v := range values {
+		for _, p := range strings.Split(v, ",") {
+			if p = strings.TrimSpace(p); p == "" {
+				continue
+			}
+			n, err := strconv.ParseInt(p, 10, 32)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("bad partition %q", p)
+			}
+			partitions = append(partitions, int32(n))
+		}
+	}
+	return partitions, nil
+}
+
+// parseSeekTarget позиция из параметров <prefix>offset, <prefix>timestamp (RFC3339 или YYYY-MM-DD)
+// и <prefix>position (beginning, end)
+func parseSeekTarget(get func(string) string, prefix string) (kafka.SeekTarget, error) {
+	t := kafka.SeekTarget{Position: get(prefix + "position")}
+	if v := get(prefix + "offset"); v != "" {
+		offset, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return t, fmt.Errorf("bad %soffset %q", prefix, v)
+		}
+		t.Offset = &offset
+	}
+	if v := get(prefix + "timestamp"); v != "" {
+		var err error
+		if t.Time, err = time.Parse(time.RFC3339, v); err != nil {
+			if t.Time, err = time.Parse(reportDateLayout, v); err != nil {
+				return t, fmt.Errorf("bad %stimestamp %q, expected RFC3339 or YYYY-MM-DD", prefix, v)
+			}
+		}
+	}
+	return t, nil
+}
+
+func adminErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, kafka.ErrBadTarget):
+		return http.StatusBadRequest
+	case errors.Is(err, kafka.ErrNotAssigned):
+		return http.StatusConflict
+	case errors.Is(err, kafka.ErrConsumerClosed):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// consumerAction команда админки для консьюмера, результат отдается в поле result
+type consumerAction func(c *gin.Context, consumer *kafka.Consumer, partitions []int32) (any, error)
+
+// registerConsumerRoutes состояние консьюмеров и управление оффсетами:
+// пауза, перемотка на оффсет или время и повторное чтение диапазона
+func registerConsumerRoutes(router *gin.Engine, consumers []*kafka.Consumer) {
+	router.GET("/admin/consumers", func(c *gin.Context) {
+		states := make([]kafka.ConsumerState, 0, len(consumers))
+		for _, consumer := range consumers {
+			states = append(states, consumer.State())
+		}
+		c.JSON(http.StatusOK, gin.H{"consumers": states})
+	})
+
+	// handle находит консьюмер, подписанный на топик, и разбирает партиции, остальное делает action
+	handle := func(action consumerAction) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			var consumer *kafka.Consumer
+			for _, cons := range consumers {
+				if cons.Subscribes(c.Param("topic")) {
+					consumer = cons
+					break
+				}
+			}
+			if consumer == nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "No consumer for topic " + c.Param("topic")})
+				return
+			}
+			partitions, err := parsePartitions(c.QueryArray("partition")...)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			result, err := action(c, consumer, partitions)
+			if err != nil {
+				c.JSON(adminErrorStatus(err), gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, gin.H{"topic": c.Param("topic"), "result": result})
+		}
+	}
+	withTimeout := func(c *gin.Context) (context.Context, context.CancelFunc) {
+		return context.WithTimeout(c.Request.Context(), adminTimeout)
+	}
+
+	router.POST("/admin/consumers/:topic/pause", handle(func(c *gin.Context, consumer *kafka.Consumer, parts []int32) (any, error) {
+		ctx, cancel := withTimeout(c)
+		defer cancel()
+		return consumer.Pause(ctx, c.Param("topic"), parts)
+	}))
+	router.POST("/admin/consumers/:topic/resume", handle(func(c *gin.Context, consumer *kafka.Consumer, parts []int32) (any, error) {
+		ctx, cancel := withTimeout(c)
+		defer cancel()
+		return consumer.Resume(ctx, c.Param("topic"), parts)
+	}))
+	router.POST("/admin/consumers/:topic/seek", handle(func(c *gin.Context, consumer *kafka.Consumer, parts []int32) (any, error) {
+		target, err := parseSeekTarget(c.Query, "")
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", kafka.ErrBadTarget, err)
+		}
+		ctx, cancel := withTimeout(c)
+		defer cancel()
+		return consumer.Seek(ctx, c.Param("topic"), parts, target)
+	}))
+	router.POST("/admin/consumers/:topic/replay", handle(func(c *gin.Context, consumer *kafka.Consumer, parts []int32) (any, error) {
+		from, err := parseSeekTarget(c.Query, "from_")
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", kafka.ErrBadTarget, err)
+		}
+		to, err := parseSeekTarget(c.Query, "to_")
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", kafka.ErrBadTarget, err)
+		}
+		// без конца диапазона перечитываем до текущей позиции
+		if to == (kafka.SeekTarget{}) {
+			to.Position = "end"
+		}
+		ctx, cancel := withTimeout(c)
+		defer cancel()
+		return consumer.Replay(ctx, c.Param("topic"), parts, from, to)
+	}))
+}
+
+// runOffsetsCommand cli для управления оффсетами:
+// pause, resume, seek и replay вызывают http api работающего сервиса,
+// reset коммитит оффсеты группе напрямую и работает только при остановленном сервисе
+func runOffsetsCommand(args []string) error {
+	const usage = "usage: offsets pause|resume|seek|replay|reset [flags]"
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+	action := args[0]
+	fs := flag.NewFlagSet("offsets "+action, flag.ExitOnError)
+	addr := fs.String("addr", "http://localhost"+ginRout, "адрес сервиса")
+	topic := fs.String("topic", topicName, "топик")
+	partitions := fs.String("partitions", "", "партиции через запятую, пусто — все")
+	group := fs.String("group", consumerGroup, "группа консьюмеров (для reset)")
+	execute := fs.Bool("execute", false, "reset: закоммитить оффсеты, без флага только показать")
+	target := map[string]*string{}
+	for _, prefix := range []string{"", "from-", "to-"} {
+		target[prefix+"offset"] = fs.String(prefix+"offset", "", "оффсет")
+		target[prefix+"timestamp"] = fs.String(prefix+"timestamp", "", "время, RFC3339 или YYYY-MM-DD")
+		target[prefix+"position"] = fs.String(prefix+"position", "", "beginning или end")
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	get := func(k string) string { return *target[strings.ReplaceAll(k, "_", "-")] }
+
+	switch action {
+	case "pause", "resume", "seek", "replay":
+	case "reset":
+		parts, err := parsePartitions(*partitions)
+		if err != nil {
+			return err
+		}
+		t, err := parseSeekTarget(get, "")
+		if err != nil {
+			return err
+		}
+		cfg, err := kafka.ConfigFromEnv(broker)
+		if err != nil {
+			return err
+		}
+		result, err := kafka.ResetGroupOffsets(cfg, *group, *topic, parts, t, *execute)
+		if err != nil {
+			return err
+		}
+		for _, r := range result {
+			fmt.Printf("%s[%d]: %d -> %d\n", r.Topic, r.Partition, r.Previous, r.Offset)
+		}
+		if !*execute {
+			fmt.Println("dry run, add -execute to commit")
+		}
+		return nil
+	default:
+		return errors.New(usage)
+	}
+
+	query := url.Values{}
+	parts, err := parsePartitions(*partitions)
+	if err != nil {
+		return err
+	}
+	for _, p := range parts {
+		query.Add("partition", strconv.Itoa(int(p)))
+	}
+	for k, v := range target {
+		if *v != "" {
+			query.Set(strings.ReplaceAll(k, "-", "_"), *v)
+		}
+	}
+	u := fmt.Sprintf("%s/admin/consumers/%s/%s?%s", strings.TrimRight(*addr, "/"), url.PathEscape(*topic),
+		action, query.Encode())
+	resp, err := http.Post(u, "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if _, err := io.Copy(os.Stdout, resp.Body); err != nil {
+		return err
+	}
+	fmt.Println()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", action, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"wb/breaker"
+	"wb/kafka"
+	"wb/metrics"
+	db "wb/postgresql"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultDBBreakerThreshold = 5
+	defaultDBBreakerProbe     = 5 * time.Second
+	// пауза перед повторной доставкой сообщения, пока автомат еще не разомкнулся
+	dbRetryDelay = time.Second
+	// таймаут остановки и возобновления чтения по смене состояния автомата
+	holdTimeout = 15 * time.Second
+)
+
+// newDBBreaker автомат вокруг базы: DB_BREAKER_THRESHOLD ошибок недоступности подряд (по умолчанию 5)
+// ставят консьюмеры на паузу, база проверяется раз в DB_BREAKER_PROBE_INTERVAL (по умолчанию 5s),
+// после успешной проверки чтение возобновляется
+func newDBBreaker(ctx context.Context, consumers ...*kafka.Consumer) *breaker.Breaker {
+	threshold := defaultDBBreakerThreshold
+	if v := os.Getenv("DB_BREAKER_THRESHOLD"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err == nil && n > 0 {
+			threshold = n
+		} else {
+			log.Printf("Warning: bad DB_BREAKER_THRESHOLD %q, using %d", v, threshold)
+		}
+	}
+	interval := envDuration("DB_BREAKER_PROBE_INTERVAL", defaultDBBreakerProbe)
+	if interval == 0 {
+		interval = defaultDBBreakerProbe
+	}
+
+	b := breaker.New("postgres", threshold, interval, db.Ping)
+	b.OnChange(func(s breaker.State) {
+		for _, c := range consumers {
+			hctx, cancel := context.WithTimeout(ctx, holdTimeout)
+			var err error
+			switch s {
+			case breaker.Open:
+				err = c.Hold(hctx)
+			case breaker.HalfOpen:
+				// первое же сообщение решит, замкнуть автомат или снова разомкнуть
+				err = c.Release(hctx)
+			}
+			cancel()
+			if err != nil {
+				log.Printf("Consumer %s: breaker %s: %v", c.Name(), s, err)
+			}
+		}
+	})
+	return b
+}
+
+// dbFailed учитывает ошибку базы в автомате; true — база недоступна и сообщение нужно повторить
+func dbFailed(b *breaker.Breaker, err error) bool {
+	if db.IsUnavailable(err) {
+		b.Failure(err)
+		return true
+	}
+	b.Success()
+	return false
+}
+
+// settle завершает обработку сообщения: Done, а при ошибке базы — Rewind, сообщение придет повторно
+func settle(ctx context.Context, consumer *kafka.Consumer, msg kafka.Message, retry bool) {
+	if !retry {
+		msg.Done()
+		return
+	}
+	metrics.Inc(`messages_retried_total{topic="` + msg.Topic + `"}`)
+	if err := consumer.Rewind(ctx, msg); err != nil {
+		log.Printf("Rewind %s failed: %v", msg.ID(), err)
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(dbRetryDelay):
+	}
+}
+
+// registerReadinessRoutes GET /ready — 503, пока автомат базы разомкнут и чтение кафки остановлено
+func registerReadinessRoutes(router *gin.Engine, dbBreaker *breaker.Breaker, consumers []*kafka.Consumer) {
+	router.GET("/ready", func(c *gin.Context) {
+		status := dbBreaker.Status()
+		held := gin.H{}
+		for _, consumer := range consumers {
+			held[consumer.Name()] = consumer.State().Held
+		}
+		code, ready := http.StatusOK, "ready"
+		if status.State == breaker.Open {
+			code, ready = http.StatusServiceUnavailable, "not_ready"
+		}
+		c.JSON(code, gin.H{"status": ready, "database": status, "consumers_held": held})
+	})
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"wb/codec"
+	kafka "wb/kafka"
+	"wb/metrics"
+)
+
+const dlqTopicName = "orders-dlq"
+
+// dlqMessage что кладется в DLQ: координаты исходного сообщения, ошибки по полям и само сообщение
+type dlqMessage struct {
+	SourceTopic string             `json:"source_topic"`
+	Partition   int32              `json:"partition"`
+	Offset      int64              `json:"offset"`
+	MessageID   string             `json:"message_id"`
+	FailedAt    time.Time          `json:"failed_at"`
+	Reason      string             `json:"reason"`
+	Errors      []codec.FieldError `json:"errors"`
+	Headers     map[string]string  `json:"headers,omitempty"`
+	Payload     []byte             `json:"payload"` // base64, сообщение может быть и не json
+}
+
+// sendToDLQ отправляет сообщение, которое не удалось разобрать, и считает ошибки по видам
+func sendToDLQ(ctx context.Context, producer *kafka.Producer, msg kafka.Message, reason string, err error) {
+	fieldErrors := codec.FieldErrors(err)
+	for _, fe := range fieldErrors {
+		metrics.Inc(`decode_errors_total{topic="` + msg.Topic + `",kind="` + fe.Kind + `"}`)
+	}
+
+	data, mErr := json.Marshal(dlqMessage{
+		SourceTopic: msg.Topic,
+		Partition:   msg.Partition,
+		Offset:      msg.Offset,
+		MessageID:   msg.ID(),
+		FailedAt:    time.Now().UTC(),
+		Reason:      reason,
+		Errors:      fieldErrors,
+		Headers:     msg.Headers,
+		Payload:     msg.Value,
+	})
+	if mErr != nil {
+		log.Printf("DLQ marshal error: %v", mErr)
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+	if pErr := producer.Publish(ctx, dlqTopicName, msg.Key, data, map[string]string{
+		codec.HeaderContentType: codec.ContentTypeJSON,
+		"reason":                reason,
+	}); pErr != nil {
+		log.Printf("DLQ publish error (message %s): %v", msg.ID(), pErr)
+		metrics.Inc("dlq_publish_failed_total")
+		return
+	}
+	metrics.Inc(`dlq_messages_total{reason="` + reason + `"}`)
+}
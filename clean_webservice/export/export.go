@@ -0,0 +1,245 @@
+package export
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	db "wb/postgresql"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress"
+)
+
+type (
+	Format string
+	// Layout flat — строка на товар, nested — строка на заказ с вложенными товарами
+	Layout string
+)
+
+const (
+	FormatCSV     Format = "csv"
+	FormatNDJSON  Format = "ndjson"
+	FormatParquet Format = "parquet"
+
+	LayoutFlat   Layout = "flat"
+	LayoutNested Layout = "nested"
+
+	// parquetRowGroupSize строк в одной row group, после нее буфер сбрасывается в выход
+	parquetRowGroupSize = 10000
+)
+
+// Options параметры выгрузки
+// Gzip для csv и ndjson сжимает весь поток, для parquet включает gzip внутри файла (по умолчанию snappy)
+// MaskPII скрывает персональные данные доставки
+type Options struct {
+	Format  Format
+	Layout  Layout
+	Gzip    bool
+	MaskPII bool
+}
+
+// Validate проверяет формат и проставляет раскладку по умолчанию: flat для csv, nested для остальных
+func (o *Options) Validate() error {
+	switch o.Format {
+	case FormatCSV, FormatNDJSON, FormatParquet:
+	default:
+		return fmt.Errorf("unknown export format %q, expected csv, ndjson or parquet", o.Format)
+	}
+	switch o.Layout {
+	case "":
+		o.Layout = LayoutNested
+		if o.Format == FormatCSV {
+			o.Layout = LayoutFlat
+		}
+	case LayoutFlat, LayoutNested:
+	default:
+		return fmt.Errorf("unknown export layout %q, expected flat or nested", o.Layout)
+	}
+	return nil
+}
+
+// ContentType и FileName для ответа http и имени файла по умолчанию
+func (o Options) ContentType() string {
+	switch {
+	case o.Gzip && o.Format != FormatParquet:
+		return "application/gzip"
+	case o.Format == FormatCSV:
+		return "text/csv; charset=utf-8"
+	case o.Format == FormatNDJSON:
+		return "application/x-ndjson"
+	}
+	return "application/vnd.apache.parquet"
+}
+
+func (o Options) FileName() string {
+	name := "orders." + string(o.Format)
+	if o.Gzip && o.Format != FormatParquet {
+		name += ".gz"
+	}
+	return name
+}
+
+// Writer пишет заказы в выбранном формате, Close дописывает хвост файла, но не закрывает сам выход
+type Writer interface {
+	Write(o *db.FullOrder) error
+	Close() error
+}
+
+// NewWriter создает writer поверх out
+func NewWriter(out io.Writer, opts Options) (Writer, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	if opts.Format == FormatParquet {
+		var codec compress.Codec = &parquet.Snappy
+		if opts.Gzip {
+			codec = &parquet.Gzip
+		}
+		config := parquet.Compression(codec)
+		if opts.Layout == LayoutFlat {
+			return &parquetWriter[FlatRecord]{w: parquet.NewGenericWriter[FlatRecord](out, config), records: FlatRecords}, nil
+		}
+		return &parquetWriter[NestedRecord]{w: parquet.NewGenericWriter[NestedRecord](out, config),
+			records: func(o *db.FullOrder) []NestedRecord { return []NestedRecord{NewNestedRecord(o)} }}, nil
+	}
+
+	s := &stream{}
+	if opts.Gzip {
+		s.gz = gzip.NewWriter(out)
+		out = s.gz
+	}
+	s.buf = bufio.NewWriterSize(out, 64*1024)
+	if opts.Format == FormatCSV {
+		s.enc = newCSVEncoder(s.buf, opts.Layout)
+	} else {
+		s.enc = newJSONEncoder(s.buf, opts.Layout)
+	}
+	return s, nil
+}
+
+// Run выгружает заказы по фильтру и возвращает их число
+func Run(ctx context.Context, out io.Writer, opts Options, filter db.ExportFilter, progress func(n int)) (int, error) {
+	w, err := NewWriter(out, opts)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	err = db.ForEachOrder(ctx, filter, func(o *db.FullOrder) error {
+		if opts.MaskPII {
+			o.Delivery = o.Delivery.Masked()
+		}
+		if err := w.Write(o); err != nil {
+			return err
+		}
+		n++
+		if progress != nil {
+			progress(n)
+		}
+		return nil
+	})
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return n, fmt.Errorf("export: %w", err)
+	}
+	return n, nil
+}
+
+// stream текстовые форматы: encoder -> буфер -> (gzip) -> выход
+type stream struct {
+	enc func(o *db.FullOrder) error
+	buf *bufio.Writer
+	gz  *gzip.Writer
+}
+
+func (s *stream) Write(o *db.FullOrder) error { return s.enc(o) }
+
+func (s *stream) Close() error {
+	if err := s.buf.Flush(); err != nil {
+		return err
+	}
+	if s.gz != nil {
+		return s.gz.Close()
+	}
+	return nil
+}
+
+func newCSVEncoder(out io.Writer, layout Layout) func(o *db.FullOrder) error {
+	w := csv.NewWriter(out)
+	header := append([]string{}, orderColumns...)
+	if layout == LayoutFlat {
+		header = append(header, itemColumns...)
+	} else {
+		header = append(header, "items") // товары json массивом в одной ячейке
+	}
+	wroteHeader := false
+	return func(o *db.FullOrder) error {
+		if !wroteHeader {
+			if err := w.Write(header); err != nil {
+				return err
+			}
+			wroteHeader = true
+		}
+		if layout == LayoutFlat {
+			for _, r := range FlatRecords(o) {
+				if err := w.Write(append(r.OrderRecord.values(), r.ItemRecord.values()...)); err != nil {
+					return err
+				}
+			}
+		} else {
+			r := NewNestedRecord(o)
+			items, err := json.Marshal(r.Items)
+			if err != nil {
+				return err
+			}
+			if err := w.Write(append(r.OrderRecord.values(), string(items))); err != nil {
+				return err
+			}
+		}
+		w.Flush()
+		return w.Error()
+	}
+}
+
+// newJSONEncoder nested пишет заказ в том же виде, что приходит в топик orders, его можно загрузить обратно
+func newJSONEncoder(out io.Writer, layout Layout) func(o *db.FullOrder) error {
+	enc := json.NewEncoder(out)
+	return func(o *db.FullOrder) error {
+		if layout == LayoutNested {
+			return enc.Encode(o)
+		}
+		for _, r := range FlatRecords(o) {
+			if err := enc.Encode(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+type parquetWriter[T any] struct {
+	w       *parquet.GenericWriter[T]
+	records func(o *db.FullOrder) []T
+	rows    int
+}
+
+func (p *parquetWriter[T]) Write(o *db.FullOrder) error {
+	records := p.records(o)
+	if _, err := p.w.Write(records); err != nil {
+		return err
+	}
+	p.rows += len(records)
+	if p.rows >= parquetRowGroupSize {
+		p.rows = 0
+		return p.w.Flush()
+	}
+	return nil
+}
+
+func (p *parquetWriter[T]) Close() error { return p.w.Close() }
@@ -0,0 +1,194 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"wb/codec"
+	db "wb/postgresql"
+)
+
+// CSVReader читает обратно csv выгрузку: flat (строки одного заказа идут подряд) или nested (товары json в колонке items)
+type CSVReader struct {
+	r       *csv.Reader
+	columns map[string]int
+	nested  bool
+	line    int
+	pending []string // первая строка следующего заказа, прочитанная при сборке текущего
+	pendLn  int
+}
+
+func NewCSVReader(r io.Reader) (*CSVReader, error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read csv header: %w", err)
+	}
+	c := &CSVReader{r: cr, columns: make(map[string]int, len(header)), line: 1}
+	for i, name := range header {
+		c.columns[name] = i
+	}
+	if _, ok := c.columns["order_uid"]; !ok {
+		return nil, errors.New("csv header: order_uid column is missing")
+	}
+	_, c.nested = c.columns["items"]
+	return c, nil
+}
+
+// Next возвращает следующий заказ и номер его первой строки в файле, в конце файла io.EOF
+// ошибка разбора заказа приходит как *codec.DecodeError, чтение можно продолжать
+func (c *CSVReader) Next() (*db.FullOrder, int, error) {
+	first, firstLine := c.pending, c.pendLn
+	c.pending = nil
+	if first == nil {
+		rec, err := c.read()
+		if err != nil {
+			return nil, c.line, err
+		}
+		first, firstLine = rec, c.line
+	}
+	rows := [][]string{first}
+	if !c.nested {
+		uid := c.get(first, "order_uid")
+		for {
+			rec, err := c.read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, firstLine, err
+			}
+			if c.get(rec, "order_uid") != uid {
+				c.pending, c.pendLn = rec, c.line
+				break
+			}
+			rows = append(rows, rec)
+		}
+	}
+	order, err := c.order(rows)
+	return order, firstLine, err
+}
+
+func (c *CSVReader) read() ([]string, error) {
+	rec, err := c.r.Read()
+	if err == nil {
+		c.line++
+	}
+	var pe *csv.ParseError
+	if errors.As(err, &pe) {
+		c.line = pe.Line
+		return nil, &codec.DecodeError{Errors: []codec.FieldError{{Kind: codec.ErrKindSyntax, Message: pe.Error()}}}
+	}
+	return rec, err
+}
+
+func (c *CSVReader) get(rec []string, column string) string {
+	if i, ok := c.columns[column]; ok && i < len(rec) {
+		return rec[i]
+	}
+	return ""
+}
+
+// order собирает заказ из строк, все ошибки колонок собираются сразу
+func (c *CSVReader) order(rows [][]string) (*db.FullOrder, error) {
+	var errs []codec.FieldError
+	rec := rows[0]
+	str := func(column string) string { return c.get(rec, column) }
+	num := func(column string, bits int) int64 {
+		v := str(column)
+		if v == "" {
+			return 0
+		}
+		n, err := strconv.ParseInt(v, 10, bits)
+		if err != nil {
+			errs = append(errs, codec.FieldError{Path: column, Kind: codec.ErrKindTypeMismatch, Message: "expected integer, got " + strconv.Quote(v)})
+		}
+		return n
+	}
+	money := func(column, v string) db.Money {
+		if v == "" {
+			return db.Money{}
+		}
+		m, err := db.ParseMoney(v)
+		if err != nil {
+			errs = append(errs, codec.FieldError{Path: column, Kind: codec.ErrKindInvalidValue, Message: err.Error()})
+		}
+		return m
+	}
+	optional := func(column string) *string {
+		if v := str(column); v != "" {
+			return &v
+		}
+		return nil
+	}
+
+	o := &db.FullOrder{}
+	uid := str("order_uid")
+	o.Orders = db.Orders{
+		OrderUID: uid, TrackNumber: str("track_number"), Entry: str("entry"), Locale: str("locale"),
+		InternalSignature: optional("internal_signature"), CustomerID: str("customer_id"),
+		DeliveryService: str("delivery_service"), Shardkey: str("shardkey"), SmID: int32(num("sm_id", 32)),
+		OofShard: str("oof_shard"),
+	}
+	if v := str("date_created"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			errs = append(errs, codec.FieldError{Path: "date_created", Kind: codec.ErrKindInvalidValue, Message: "expected RFC3339 time, got " + strconv.Quote(v)})
+		}
+		o.Orders.DateCreated = t
+	}
+	o.Delivery = db.Delivery{
+		OrderUID: uid, Name: str("delivery_name"), Phone: str("delivery_phone"), Zip: str("delivery_zip"),
+		City: str("delivery_city"), Address: str("delivery_address"), Region: str("delivery_region"),
+		Email: str("delivery_email"),
+	}
+	o.Payment = db.Payment{
+		OrderUID: uid, Transaction: str("transaction"), RequestID: optional("request_id"), Currency: str("currency"),
+		Provider: str("provider"), Amount: money("amount", str("amount")), PaymentDT: num("payment_dt", 64),
+		Bank: str("bank"), DeliveryCost: money("delivery_cost", str("delivery_cost")),
+		GoodsTotal: money("goods_total", str("goods_total")), CustomFee: money("custom_fee", str("custom_fee")),
+	}
+
+	var items []ItemRecord
+	if c.nested {
+		if v := str("items"); v != "" {
+			if err := json.Unmarshal([]byte(v), &items); err != nil {
+				errs = append(errs, codec.FieldError{Path: "items", Kind: codec.ErrKindInvalidValue, Message: err.Error()})
+			}
+		}
+	} else {
+		for _, row := range rows {
+			rec = row
+			if str("chrt_id") == "" {
+				continue // заказ без товаров
+			}
+			items = append(items, ItemRecord{
+				ChrtID: num("chrt_id", 64), ItemTrackNumber: str("item_track_number"), Price: str("price"),
+				Rid: str("rid"), Name: str("name"), Sale: int32(num("sale", 32)), Size: str("size"),
+				TotalPrice: str("total_price"), NmID: num("nm_id", 64), Brand: str("brand"),
+				ItemStatus: int32(num("item_status", 32)),
+			})
+		}
+	}
+	for i, it := range items {
+		path := fmt.Sprintf("items[%d]", i)
+		o.Items = append(o.Items, db.Item{
+			OrderUID: uid, ChrtID: it.ChrtID, TrackNumber: it.ItemTrackNumber, Price: money(path+".price", it.Price),
+			Rid: it.Rid, Name: it.Name, Sale: it.Sale, Size: it.Size, TotalPrice: money(path+".total_price", it.TotalPrice),
+			NmID: it.NmID, Brand: it.Brand, Status: it.ItemStatus,
+		})
+	}
+
+	if len(errs) > 0 {
+		return nil, &codec.DecodeError{Errors: errs}
+	}
+	if err := o.ApplyCurrency(); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
@@ -0,0 +1,177 @@
+package export
+
+import (
+	"strconv"
+	"time"
+
+	db "wb/postgresql"
+)
+
+// записи выгрузки: плоские колонки с понятными именами, суммы строками, чтобы не терять точность
+// одни и те же структуры дают заголовок csv, ключи json и схему parquet
+
+type (
+	// OrderRecord колонки заказа, доставки и платежа
+	OrderRecord struct {
+		OrderUID          string `json:"order_uid" parquet:"order_uid"`
+		TrackNumber       string `json:"track_number" parquet:"track_number"`
+		Entry             string `json:"entry" parquet:"entry"`
+		Locale            string `json:"locale" parquet:"locale"`
+		InternalSignature string `json:"internal_signature" parquet:"internal_signature"`
+		CustomerID        string `json:"customer_id" parquet:"customer_id"`
+		DeliveryService   string `json:"delivery_service" parquet:"delivery_service"`
+		Shardkey          string `json:"shardkey" parquet:"shardkey"`
+		SmID              int32  `json:"sm_id" parquet:"sm_id"`
+		DateCreated       string `json:"date_created" parquet:"date_created"`
+		OofShard          string `json:"oof_shard" parquet:"oof_shard"`
+		Status            string `json:"status" parquet:"status"`
+		DeliveryName      string `json:"delivery_name" parquet:"delivery_name"`
+		DeliveryPhone     string `json:"delivery_phone" parquet:"delivery_phone"`
+		DeliveryZip       string `json:"delivery_zip" parquet:"delivery_zip"`
+		DeliveryCity      string `json:"delivery_city" parquet:"delivery_city"`
+		DeliveryAddress   string `json:"delivery_address" parquet:"delivery_address"`
+		DeliveryRegion    string `json:"delivery_region" parquet:"delivery_region"`
+		DeliveryEmail     string `json:"delivery_email" parquet:"delivery_email"`
+		Transaction       string `json:"transaction" parquet:"transaction"`
+		RequestID         string `json:"request_id" parquet:"request_id"`
+		Currency          string `json:"currency" parquet:"currency"`
+		Provider          string `json:"provider" parquet:"provider"`
+		Amount            string `json:"amount" parquet:"amount"`
+		PaymentDT         int64  `json:"payment_dt" parquet:"payment_dt"`
+		Bank              string `json:"bank" parquet:"bank"`
+		DeliveryCost      string `json:"delivery_cost" parquet:"delivery_cost"`
+		GoodsTotal        string `json:"goods_total" parquet:"goods_total"`
+		CustomFee         string `json:"custom_fee" parquet:"custom_fee"`
+	}
+	// ItemRecord колонки товара, в плоской выгрузке пустые у заказа без товаров
+	ItemRecord struct {
+		ChrtID          int64  `json:"chrt_id" parquet:"chrt_id"`
+		ItemTrackNumber string `json:"item_track_number" parquet:"item_track_number"`
+		Price           string `json:"price" parquet:"price"`
+		Rid             string `json:"rid" parquet:"rid"`
+		Name            string `json:"name" parquet:"name"`
+		Sale            int32  `json:"sale" parquet:"sale"`
+		Size            string `json:"size" parquet:"size"`
+		TotalPrice      string `json:"total_price" parquet:"total_price"`
+		NmID            int64  `json:"nm_id" parquet:"nm_id"`
+		Brand           string `json:"brand" parquet:"brand"`
+		ItemStatus      int32  `json:"item_status" parquet:"item_status"`
+	}
+	// FlatRecord одна строка на товар: колонки заказа повторяются
+	FlatRecord struct {
+		OrderRecord
+		ItemRecord
+	}
+	// NestedRecord одна строка на заказ со списком товаров
+	NestedRecord struct {
+		OrderRecord
+		Items []ItemRecord `json:"items" parquet:"items,list"`
+	}
+)
+
+func newOrderRecord(o *db.FullOrder) OrderRecord {
+	r := OrderRecord{
+		OrderUID:        o.Orders.OrderUID,
+		TrackNumber:     o.Orders.TrackNumber,
+		Entry:           o.Orders.Entry,
+		Locale:          o.Orders.Locale,
+		CustomerID:      o.Orders.CustomerID,
+		DeliveryService: o.Orders.DeliveryService,
+		Shardkey:        o.Orders.Shardkey,
+		SmID:            o.Orders.SmID,
+		DateCreated:     o.Orders.DateCreated.UTC().Format(time.RFC3339),
+		OofShard:        o.Orders.OofShard,
+		DeliveryName:    o.Delivery.Name,
+		DeliveryPhone:   o.Delivery.Phone,
+		DeliveryZip:     o.Delivery.Zip,
+		DeliveryCity:    o.Delivery.City,
+		DeliveryAddress: o.Delivery.Address,
+		DeliveryRegion:  o.Delivery.Region,
+		DeliveryEmail:   o.Delivery.Email,
+		Transaction:     o.Payment.Transaction,
+		Currency:        o.Payment.Currency,
+		Provider:        o.Payment.Provider,
+		Amount:          o.Payment.Amount.String(),
+		PaymentDT:       o.Payment.PaymentDT,
+		Bank:            o.Payment.Bank,
+		DeliveryCost:    o.Payment.DeliveryCost.String(),
+		GoodsTotal:      o.Payment.GoodsTotal.String(),
+		CustomFee:       o.Payment.CustomFee.String(),
+	}
+	if o.Orders.InternalSignature != nil {
+		r.InternalSignature = *o.Orders.InternalSignature
+	}
+	if o.Payment.RequestID != nil {
+		r.RequestID = *o.Payment.RequestID
+	}
+	if o.Status != nil {
+		r.Status = string(o.Status.Status)
+	}
+	return r
+}
+
+func newItemRecord(i *db.Item) ItemRecord {
+	return ItemRecord{
+		ChrtID:          i.ChrtID,
+		ItemTrackNumber: i.TrackNumber,
+		Price:           i.Price.String(),
+		Rid:             i.Rid,
+		Name:            i.Name,
+		Sale:            i.Sale,
+		Size:            i.Size,
+		TotalPrice:      i.TotalPrice.String(),
+		NmID:            i.NmID,
+		Brand:           i.Brand,
+		ItemStatus:      i.Status,
+	}
+}
+
+// FlatRecords строки плоской выгрузки заказа, у заказа без товаров одна строка с пустыми колонками товара
+func FlatRecords(o *db.FullOrder) []FlatRecord {
+	order := newOrderRecord(o)
+	if len(o.Items) == 0 {
+		return []FlatRecord{{OrderRecord: order}}
+	}
+	records := make([]FlatRecord, len(o.Items))
+	for i := range o.Items {
+		records[i] = FlatRecord{OrderRecord: order, ItemRecord: newItemRecord(&o.Items[i])}
+	}
+	return records
+}
+
+func NewNestedRecord(o *db.FullOrder) NestedRecord {
+	r := NestedRecord{OrderRecord: newOrderRecord(o), Items: make([]ItemRecord, len(o.Items))}
+	for i := range o.Items {
+		r.Items[i] = newItemRecord(&o.Items[i])
+	}
+	return r
+}
+
+// csv колонки в том же порядке, что и поля структур
+var (
+	orderColumns = []string{"order_uid", "track_number", "entry", "locale", "internal_signature", "customer_id",
+		"delivery_service", "shardkey", "sm_id", "date_created", "oof_shard", "status",
+		"delivery_name", "delivery_phone", "delivery_zip", "delivery_city", "delivery_address", "delivery_region",
+		"delivery_email", "transaction", "request_id", "currency", "provider", "amount", "payment_dt", "bank",
+		"delivery_cost", "goods_total", "custom_fee"}
+	itemColumns = []string{"chrt_id", "item_track_number", "price", "rid", "name", "sale", "size", "total_price",
+		"nm_id", "brand", "item_status"}
+)
+
+func (r OrderRecord) values() []string {
+	return []string{r.OrderUID, r.TrackNumber, r.Entry, r.Locale, r.InternalSignature, r.CustomerID,
+		r.DeliveryService, r.Shardkey, strconv.Itoa(int(r.SmID)), r.DateCreated, r.OofShard, r.Status,
+		r.DeliveryName, r.DeliveryPhone, r.DeliveryZip, r.DeliveryCity, r.DeliveryAddress, r.DeliveryRegion,
+		r.DeliveryEmail, r.Transaction, r.RequestID, r.Currency, r.Provider, r.Amount,
+		strconv.FormatInt(r.PaymentDT, 10), r.Bank, r.DeliveryCost, r.GoodsTotal, r.CustomFee}
+}
+
+// values пустая запись товара (chrt_id 0) дает пустые ячейки, а не нули
+func (r ItemRecord) values() []string {
+	if r.ChrtID == 0 && r.Rid == "" {
+		return make([]string, len(itemColumns))
+	}
+	return []string{strconv.FormatInt(r.ChrtID, 10), r.ItemTrackNumber, r.Price, r.Rid, r.Name,
+		strconv.Itoa(int(r.Sale)), r.Size, r.TotalPrice, strconv.FormatInt(r.NmID, 10), r.Brand,
+		strconv.Itoa(int(r.ItemStatus))}
+}
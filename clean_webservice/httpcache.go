@@ -0,0 +1,96 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	db "wb/postgresql"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultStaticMaxAge = time.Hour
+
+// orderView тело ответа заказа и его ETag
+type orderView struct {
+	once sync.Once
+	body []byte
+	etag string
+	err  error
+}
+
+// orderViews тела ответа заказа без маски и с маской персональных данных; считаются один раз на заказ в кеше,
+// так что повторный запрос и If-None-Match не сериализуют заказ заново
+type orderViews [2]orderView
+
+func (v *orderViews) get(o *db.FullOrder, showPII bool) (*orderView, error) {
+	view := &v[0]
+	if showPII {
+		view = &v[1]
+	}
+	view.once.Do(func() {
+		view.body, view.err = json.Marshal(mapFullOrderToResponse(o, showPII))
+		sum := sha256.Sum256(view.body)
+		view.etag = `"` + hex.EncodeToString(sum[:16]) + `"`
+	})
+	return view, view.err
+}
+
+// writeOrderView отдает заказ с ETag и Last-Modified или 304, если у клиента та же версия;
+// ответ зависит от ключа и арендатора, поэтому кешируется только в браузере и всегда перепроверяется
+func writeOrderView(c *gin.Context, view *orderView, modified time.Time) {
+	h := c.Writer.Header()
+	h.Set("ETag", view.etag)
+	h.Set("Cache-Control", "private, no-cache")
+	// Accept-Encoding сразу: 304 тоже должен его называть, хотя сжатие его не коснется
+	h.Add("Vary", "Authorization, X-API-Key, X-Tenant, Accept-Encoding")
+	if !modified.IsZero() {
+		h.Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+	if notModified(c.Request, view.etag, modified) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(http.StatusOK, "application/json; charset=utf-8", view.body)
+}
+
+// notModified If-None-Match сравнивается без учета W/ (сжатый ответ отдает слабый ETag),
+// If-Modified-Since проверяется, только если If-None-Match нет
+func notModified(r *http.Request, etag string, modified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == "*" || tag == etag {
+				return true
+			}
+		}
+		return false
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !modified.IsZero() {
+		t, err := http.ParseTime(ims)
+		return err == nil && !modified.Truncate(time.Second).After(t)
+	}
+	return false
+}
+
+// staticCacheHeaders Cache-Control для /static: html без хешей в именах всегда перепроверяется
+// по Last-Modified, остальные файлы кешируются на STATIC_MAX_AGE (по умолчанию 1h)
+func staticCacheHeaders() gin.HandlerFunc {
+	maxAge := "public, max-age=" + strconv.Itoa(int(envDuration("STATIC_MAX_AGE", defaultStaticMaxAge).Seconds()))
+	return func(c *gin.Context) {
+		switch ext := path.Ext(c.Request.URL.Path); {
+		case ext == "" || ext == ".html":
+			c.Header("Cache-Control", "no-cache")
+		default:
+			c.Header("Cache-Control", maxAge)
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"wb/compress"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestNotModified(t *testing.T) {
+	const etag = `"0123abcd"`
+	modified := time.Date(2025, 3, 1, 12, 0, 0, 500_000_000, time.UTC)
+	tests := []struct {
+		name     string
+		inm      string
+		ims      string
+		modified time.Time
+		want     bool
+	}{
+		{name: "no conditions", modified: modified},
+		{name: "same etag", inm: etag, want: true},
+		{name: "weak etag", inm: `W/` + etag, want: true},
+		{name: "other etag", inm: `"ffff"`},
+		{name: "list of tags", inm: `"ffff", W/"eeee" , ` + etag, want: true},
+		{name: "list without match", inm: `"ffff", W/"eeee"`},
+		{name: "star", inm: "*", want: true},
+		{name: "unquoted tag", inm: "0123abcd"},
+		{name: "since same second", ims: modified.Format(http.TimeFormat), modified: modified, want: true},
+		{name: "since later", ims: modified.Add(time.Hour).Format(http.TimeFormat), modified: modified, want: true},
+		{name: "since earlier", ims: modified.Add(-time.Second).Format(http.TimeFormat), modified: modified},
+		{name: "since broken date", ims: "yesterday", modified: modified},
+		{name: "since without last-modified", ims: modified.Format(http.TimeFormat)},
+		{name: "if-none-match wins over since", inm: `"ffff"`, ims: modified.Add(time.Hour).Format(http.TimeFormat),
+			modified: modified},
+		{name: "if-none-match match ignores since", inm: etag, ims: modified.Add(-time.Hour).Format(http.TimeFormat),
+			modified: modified, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/order/1", nil)
+			if tt.inm != "" {
+				r.Header.Set("If-None-Match", tt.inm)
+			}
+			if tt.ims != "" {
+				r.Header.Set("If-Modified-Since", tt.ims)
+			}
+			if got := notModified(r, etag, tt.modified); got != tt.want {
+				t.Errorf("notModified = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteOrderView(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	body := []byte(`{"order_uid":"` + strings.Repeat("a", 2*compress.MinSize) + `"}`)
+	view := &orderView{body: body, etag: `"0123abcd"`}
+	modified := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	router := gin.New()
+	router.Use(compress.Middleware())
+	router.GET("/order/:order_uid", func(c *gin.Context) { writeOrderView(c, view, modified) })
+
+	get := func(headers map[string]string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/order/1", nil)
+		for k, v := range headers {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	w := get(map[string]string{"Accept-Encoding": "gzip"})
+	if w.Code != http.StatusOK || w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("status %d encoding %q, want 200 gzip", w.Code, w.Header().Get("Content-Encoding"))
+	}
+	weak := w.Header().Get("ETag")
+	if weak != `W/"0123abcd"` || w.Header().Get("Last-Modified") != modified.Format(http.TimeFormat) {
+		t.Fatalf("ETag %q Last-Modified %q", weak, w.Header().Get("Last-Modified"))
+	}
+
+	// слабый ETag сжатого ответа подходит и для повторного запроса со сжатием, и без него
+	for _, h := range []map[string]string{
+		{"If-None-Match": weak, "Accept-Encoding": "gzip"},
+		{"If-None-Match": weak},
+		{"If-Modified-Since": modified.Format(http.TimeFormat), "Accept-Encoding": "br"},
+	} {
+		w := get(h)
+		if w.Code != http.StatusNotModified || w.Body.Len() != 0 || w.Header().Get("Content-Encoding") != "" {
+			t.Errorf("%v: status %d, %d bytes, encoding %q, want empty 304", h, w.Code, w.Body.Len(),
+				w.Header().Get("Content-Encoding"))
+		}
+		if w.Header().Get("ETag") == "" || w.Header().Get("Vary") == "" {
+			t.Errorf("%v: 304 without ETag or Vary", h)
+		}
+	}
+	if w := get(map[string]string{"If-None-Match": `"ffff"`}); w.Code != http.StatusOK || w.Body.Len() != len(body) {
+		t.Errorf("stale etag: status %d, %d bytes, want full 200", w.Code, w.Body.Len())
+	}
+}
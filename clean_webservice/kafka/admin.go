@@ -0,0 +1,456 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+)
+
+// defaultAdminTimeout таймаут операции, если у контекста нет дедлайна
+const defaultAdminTimeout = 30 * time.Second
+
+var (
+	// ErrTopicNotFound топика нет в кластере
+	ErrTopicNotFound = errors.New("topic not found")
+	// ErrGroupNotFound группа не найдена или в ней нет ни участников, ни оффсетов
+	ErrGroupNotFound = errors.New("consumer group not found")
+)
+
+// Admin операции над кластером поверх одного admin клиента, таймаут каждой задает контекст
+type Admin struct {
+	client *kafka.AdminClient
+}
+
+func NewAdmin(cfg Config) (*Admin, error) {
+	cm, err := cfg.ConfigMap(nil)
+	if err != nil {
+		return nil, err
+	}
+	client, err := kafka.NewAdminClient(cm)
+	if err != nil {
+		return nil, err
+	}
+	return &Admin{client: client}, nil
+}
+
+func (a *Admin) Close() {
+	a.client.Close()
+}
+
+// timeout оставшееся время контекста, его же отдаем брокеру как таймаут операции
+func timeout(ctx context.Context) time.Duration {
+	if deadline, ok := ctx.Deadline(); ok {
+		return max(time.Until(deadline), time.Millisecond)
+	}
+	return defaultAdminTimeout
+}
+
+// CreateTopic создает топик, если его еще нет
+func (a *Admin) CreateTopic(ctx context.Context, topicName string, numPartitions, replicationFactor int) error {
+	topicSpec := kafka.TopicSpecification{
+		Topic:             topicName,
+		NumPartitions:     numPartitions,
+		ReplicationFactor: replicationFactor,
+	}
+
+	results, err := a.client.CreateTopics(
+		ctx,
+		[]kafka.TopicSpecification{topicSpec},
+		kafka.SetAdminOperationTimeout(timeout(ctx)),
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, result := range results {
+		if result.Error.Code() != kafka.ErrNoError && result.Error.Code() != kafka.ErrTopicAlreadyExists {
+			return result.Error
+		}
+		if result.Error.Code() == kafka.ErrTopicAlreadyExists {
+			log.Printf("Topic %s already exists", topicName)
+		} else {
+			log.Printf("Topic %s created successfully", topicName)
+		}
+	}
+
+	return nil
+}
+
+// ListTopics имена топиков кластера без служебных
+func (a *Admin) ListTopics(ctx context.Context) ([]string, error) {
+	md, err := a.client.GetMetadata(nil, true, int(timeout(ctx).Milliseconds()))
+	if err != nil {
+		return nil, err
+	}
+	topics := make([]string, 0, len(md.Topics))
+	for name := range md.Topics {
+		if len(name) > 0 && name[0] != '_' {
+			topics = append(topics, name)
+		}
+	}
+	sort.Strings(topics)
+	return topics, nil
+}
+
+// PartitionInfo партиция топика: лидер, реплики и границы оффсетов
+type PartitionInfo struct {
+	Partition int32   `json:"partition"`
+	Leader    int32   `json:"leader"`
+	Replicas  []int32 `json:"replicas"`
+	ISR       []int32 `json:"isr"`
+	Low       int64   `json:"low"`
+	High      int64   `json:"high"`
+}
+
+// TopicInfo описание топика; в Configs только настройки, отличающиеся от умолчаний брокера
+type TopicInfo struct {
+	Name       string            `json:"name"`
+	Partitions []PartitionInfo   `json:"partitions"`
+	Configs    map[string]string `json:"configs"`
+}
+
+// DescribeTopic партиции с watermark оффсетами и настройки топика
+func (a *Admin) DescribeTopic(ctx context.Context, topic string) (*TopicInfo, error) {
+	res, err := a.client.DescribeTopics(ctx, kafka.NewTopicCollectionOfTopicNames([]string{topic}),
+		kafka.SetAdminRequestTimeout(timeout(ctx)))
+	if err != nil {
+		return nil, err
+	}
+	if len(res.TopicDescriptions) != 1 {
+		return nil, fmt.Errorf("describe %s: empty response", topic)
+	}
+	desc := res.TopicDescriptions[0]
+	switch desc.Error.Code() {
+	case kafka.ErrNoError:
+	case kafka.ErrUnknownTopicOrPart, kafka.ErrUnknownTopic:
+		return nil, fmt.Errorf("%w: %s", ErrTopicNotFound, topic)
+	default:
+		return nil, fmt.Errorf("describe %s: %w", topic, desc.Error)
+	}
+
+	info := &TopicInfo{Name: topic, Configs: make(map[string]string)}
+	partitions := make([]int32, len(desc.Partitions))
+	for i, p := range desc.Partitions {
+		pi := PartitionInfo{Partition: int32(p.Partition), Leader: -1}
+		if p.Leader != nil {
+			pi.Leader = int32(p.Leader.ID)
+		}
+		for _, n := range p.Replicas {
+			pi.Replicas = append(pi.Replicas, int32(n.ID))
+		}
+		for _, n := range p.Isr {
+			pi.ISR = append(pi.ISR, int32(n.ID))
+		}
+		info.Partitions = append(info.Partitions, pi)
+		partitions[i] = pi.Partition
+	}
+	sort.Slice(info.Partitions, func(i, j int) bool {
+		return info.Partitions[i].Partition < info.Partitions[j].Partition
+	})
+
+	marks, err := a.watermarks(ctx, topic, partitions)
+	if err != nil {
+		return nil, err
+	}
+	for i := range info.Partitions {
+		w := marks[info.Partitions[i].Partition]
+		info.Partitions[i].Low, info.Partitions[i].High = w[0], w[1]
+	}
+
+	configs, err := a.client.DescribeConfigs(ctx,
+		[]kafka.ConfigResource{{Type: kafka.ResourceTopic, Name: topic}},
+		kafka.SetAdminRequestTimeout(timeout(ctx)))
+	if err != nil {
+		return nil, fmt.Errorf("describe configs %s: %w", topic, err)
+	}
+	for _, r := range configs {
+		if r.Error.Code() != kafka.ErrNoError {
+			return nil, fmt.Errorf("describe configs %s: %w", topic, r.Error)
+		}
+		for name, entry := range r.Config {
+			if entry.Source != kafka.ConfigSourceDefault && entry.Source != kafka.ConfigSourceStaticBroker {
+				info.Configs[name] = entry.Value
+			}
+		}
+	}
+	return info, nil
+}
+
+// watermarks low/high оффсеты партиций: запросы ListOffsets earliest и latest
+func (a *Admin) watermarks(ctx context.Context, topic string, partitions []int32) (map[int32][2]int64, error) {
+	marks := make(map[int32][2]int64, len(partitions))
+	for i, spec := range []kafka.OffsetSpec{kafka.EarliestOffsetSpec, kafka.LatestOffsetSpec} {
+		req := make(map[kafka.TopicPartition]kafka.OffsetSpec, len(partitions))
+		for _, p := range partitions {
+			req[kafka.TopicPartition{Topic: &topic, Partition: p}] = spec
+		}
+		res, err := a.client.ListOffsets(ctx, req, kafka.SetAdminRequestTimeout(timeout(ctx)))
+		if err != nil {
+			return nil, fmt.Errorf("list offsets %s: %w", topic, err)
+		}
+		for tp, info := range res.ResultInfos {
+			if info.Error.Code() != kafka.ErrNoError {
+				return nil, fmt.Errorf("list offsets %s[%d]: %w", topic, tp.Partition, info.Error)
+			}
+			w := marks[tp.Partition]
+			w[i] = int64(info.Offset)
+			marks[tp.Partition] = w
+		}
+	}
+	return marks, nil
+}
+
+// GroupListing группа консьюмеров в списке
+type GroupListing struct {
+	Group string `json:"group"`
+	State string `json:"state"`
+}
+
+// ListGroups группы консьюмеров кластера
+func (a *Admin) ListGroups(ctx context.Context) ([]GroupListing, error) {
+	res, err := a.client.ListConsumerGroups(ctx, kafka.SetAdminRequestTimeout(timeout(ctx)))
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Errors) > 0 {
+		return nil, fmt.Errorf("list groups: %w", errors.Join(res.Errors...))
+	}
+	groups := make([]GroupListing, 0, len(res.Valid))
+	for _, g := range res.Valid {
+		groups = append(groups, GroupListing{Group: g.GroupID, State: g.State.String()})
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Group < groups[j].Group })
+	return groups, nil
+}
+
+// GroupMember участник группы и его партиции
+type GroupMember struct {
+	ClientID   string   `json:"client_id"`
+	ConsumerID string   `json:"consumer_id"`
+	Host       string   `json:"host"`
+	Partitions []string `json:"partitions"` // topic[partition]
+}
+
+// PartitionLag отставание группы в партиции: High минус закоммиченный оффсет
+// без коммита Committed = -1, а отставание считается от начала партиции
+type PartitionLag struct {
+	Topic     string `json:"topic"`
+	Partition int32  `json:"partition"`
+	Committed int64  `json:"committed"`
+	Low       int64  `json:"low"`
+	High      int64  `json:"high"`
+	Lag       int64  `json:"lag"`
+}
+
+// GroupInfo описание группы: состояние, участники и отставание по закоммиченным партициям
+type GroupInfo struct {
+	Group     string         `json:"group"`
+	State     string         `json:"state"`
+	Assignor  string         `json:"assignor"`
+	Members   []GroupMember  `json:"members"`
+	Lag       []PartitionLag `json:"lag"`
+	TotalLag  int64          `json:"total_lag"`
+	Generated time.Time      `json:"generated_at"`
+}
+
+// DescribeGroup состояние группы, участники и отставание; topics ограничивает расчет отставания,
+// без них считается по всем топикам, где у группы есть коммиты или назначенные партиции
+func (a *Admin) DescribeGroup(ctx context.Context, group string, topics ...string) (*GroupInfo, error) {
+	res, err := a.client.DescribeConsumerGroups(ctx, []string{group}, kafka.SetAdminRequestTimeout(timeout(ctx)))
+	if err != nil {
+		return nil, err
+	}
+	if len(res.ConsumerGroupDescriptions) != 1 {
+		return nil, fmt.Errorf("describe group %s: empty response", group)
+	}
+	desc := res.ConsumerGroupDescriptions[0]
+	if desc.Error.Code() != kafka.ErrNoError {
+		return nil, fmt.Errorf("describe group %s: %w", group, desc.Error)
+	}
+	info := &GroupInfo{
+		Group:     group,
+		State:     desc.State.String(),
+		Assignor:  desc.PartitionAssignor,
+		Members:   make([]GroupMember, 0, len(desc.Members)),
+		Generated: time.Now(),
+	}
+	assigned := make(map[string][]int32)
+	for _, m := range desc.Members {
+		member := GroupMember{ClientID: m.ClientID, ConsumerID: m.ConsumerID, Host: m.Host}
+		for _, tp := range m.Assignment.TopicPartitions {
+			member.Partitions = append(member.Partitions, fmt.Sprintf("%s[%d]", *tp.Topic, tp.Partition))
+			assigned[*tp.Topic] = append(assigned[*tp.Topic], tp.Partition)
+		}
+		info.Members = append(info.Members, member)
+	}
+
+	lag, err := a.lag(ctx, group, topics, assigned)
+	if err != nil {
+		return nil, err
+	}
+	if len(lag) == 0 && len(info.Members) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrGroupNotFound, group)
+	}
+	info.Lag = lag
+	for _, l := range lag {
+		info.TotalLag += l.Lag
+	}
+	return info, nil
+}
+
+// Lag отставание группы по партициям топиков (без топиков — по всем закоммиченным)
+func (a *Admin) Lag(ctx context.Context, group string, topics ...string) ([]PartitionLag, error) {
+	return a.lag(ctx, group, topics, nil)
+}
+
+func (a *Admin) lag(ctx context.Context, group string, topics []string, assigned map[string][]int32) ([]PartitionLag, error) {
+	// nil партиции — все, по которым у группы есть коммиты
+	res, err := a.client.ListConsumerGroupOffsets(ctx,
+		[]kafka.ConsumerGroupTopicPartitions{{Group: group}},
+		kafka.SetAdminRequestTimeout(timeout(ctx)))
+	if err != nil {
+		return nil, fmt.Errorf("group offsets %s: %w", group, err)
+	}
+	committed := make(map[string]map[int32]int64)
+	add := func(topic string, partition int32, offset int64) {
+		if committed[topic] == nil {
+			committed[topic] = make(map[int32]int64)
+		}
+		if prev, ok := committed[topic][partition]; !ok || prev < 0 {
+			committed[topic][partition] = offset
+		}
+	}
+	for _, g := range res.ConsumerGroupsTopicPartitions {
+		for _, tp := range g.Partitions {
+			if tp.Error != nil {
+				return nil, fmt.Errorf("group offsets %s[%d]: %w", *tp.Topic, tp.Partition, tp.Error)
+			}
+			add(*tp.Topic, tp.Partition, int64(tp.Offset))
+		}
+	}
+	for topic, partitions := range assigned {
+		for _, p := range partitions {
+			add(topic, p, -1)
+		}
+	}
+	// топик задан явно: считаем по всем его партициям, даже без коммитов
+	for _, topic := range topics {
+		if _, ok := committed[topic]; ok {
+			continue
+		}
+		md, err := a.client.GetMetadata(&topic, false, int(timeout(ctx).Milliseconds()))
+		if err != nil {
+			return nil, err
+		}
+		tm, ok := md.Topics[topic]
+		if !ok || tm.Error.Code() != kafka.ErrNoError {
+			return nil, fmt.Errorf("%w: %s", ErrTopicNotFound, topic)
+		}
+		for _, p := range tm.Partitions {
+			add(topic, p.ID, -1)
+		}
+	}
+
+	wanted := make(map[string]bool, len(topics))
+	for _, t := range topics {
+		wanted[t] = true
+	}
+	var lags []PartitionLag
+	for topic, offsets := range committed {
+		if len(wanted) > 0 && !wanted[topic] {
+			continue
+		}
+		partitions := make([]int32, 0, len(offsets))
+		for p := range offsets {
+			partitions = append(partitions, p)
+		}
+		marks, err := a.watermarks(ctx, topic, partitions)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range partitions {
+			l := PartitionLag{Topic: topic, Partition: p, Committed: offsets[p], Low: marks[p][0], High: marks[p][1]}
+			from := l.Committed
+			if from < l.Low {
+				from = l.Low
+			}
+			l.Lag = max(l.High-from, 0)
+			lags = append(lags, l)
+		}
+	}
+	sort.Slice(lags, func(i, j int) bool {
+		if lags[i].Topic != lags[j].Topic {
+			return lags[i].Topic < lags[j].Topic
+		}
+		return lags[i].Partition < lags[j].Partition
+	})
+	return lags, nil
+}
+
+// AlterTopicConfig меняет настройки топика (retention.ms, cleanup.policy и т.п.) инкрементально:
+// остальные настройки не сбрасываются, удаленные из del возвращаются к умолчанию брокера
+func (a *Admin) AlterTopicConfig(ctx context.Context, topic string, set map[string]string, del []string) error {
+	if len(set) == 0 && len(del) == 0 {
+		return errors.New("nothing to change")
+	}
+	entries := make([]kafka.ConfigEntry, 0, len(set)+len(del))
+	for name, value := range set {
+		entries = append(entries, kafka.ConfigEntry{Name: name, Value: value,
+			IncrementalOperation: kafka.AlterConfigOpTypeSet})
+	}
+	for _, name := range del {
+		entries = append(entries, kafka.ConfigEntry{Name: name, IncrementalOperation: kafka.AlterConfigOpTypeDelete})
+	}
+	res, err := a.client.IncrementalAlterConfigs(ctx,
+		[]kafka.ConfigResource{{Type: kafka.ResourceTopic, Name: topic, Config: entries}},
+		kafka.SetAdminRequestTimeout(timeout(ctx)))
+	if err != nil {
+		return err
+	}
+	for _, r := range res {
+		if r.Error.Code() != kafka.ErrNoError {
+			return fmt.Errorf("alter config %s: %w", topic, r.Error)
+		}
+	}
+	log.Printf("Topic %s config altered: set %v, deleted %v", topic, set, del)
+	return nil
+}
+
+// IncreasePartitions увеличивает число партиций топика до count; уменьшить его kafka не позволяет
+// новые партиции меняют распределение ключей, порядок заказа с тем же ключом между ними не гарантируется
+func (a *Admin) IncreasePartitions(ctx context.Context, topic string, count int) error {
+	info, err := a.DescribeTopic(ctx, topic)
+	if err != nil {
+		return err
+	}
+	if count <= len(info.Partitions) {
+		return fmt.Errorf("topic %s already has %d partitions, can only increase", topic, len(info.Partitions))
+	}
+	res, err := a.client.CreatePartitions(ctx,
+		[]kafka.PartitionsSpecification{{Topic: topic, IncreaseTo: count}},
+		kafka.SetAdminOperationTimeout(timeout(ctx)))
+	if err != nil {
+		return err
+	}
+	for _, r := range res {
+		if r.Error.Code() != kafka.ErrNoError {
+			return fmt.Errorf("create partitions %s: %w", topic, r.Error)
+		}
+	}
+	log.Printf("Topic %s partitions increased %d -> %d", topic, len(info.Partitions), count)
+	return nil
+}
+
+// RetentionMs значение retention.ms для длительности, отрицательная — хранить бессрочно
+func RetentionMs(d time.Duration) string {
+	if d < 0 {
+		return "-1"
+	}
+	return strconv.FormatInt(d.Milliseconds(), 10)
+}
@@ -0,0 +1,232 @@
+package kafka
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+)
+
+// Config подключение к кафке: адрес, защита соединения и произвольные свойства librdkafka
+type Config struct {
+	Brokers          string
+	SecurityProtocol string // plaintext, ssl, sasl_plaintext, sasl_ssl
+	SASLMechanism    string // PLAIN, SCRAM-SHA-256, SCRAM-SHA-512
+	SASLUsername     string
+	SASLPassword     string
+	TLSCAFile        string
+	TLSCertFile      string
+	TLSKeyFile       string
+	TLSKeyPassword   string
+	TLSSkipVerify    bool
+	// AssignmentStrategy стратегия распределения партиций для consumer: range, roundrobin, cooperative-sticky
+	AssignmentStrategy string
+	// Properties передаются в librdkafka как есть и перекрывают все остальные настройки
+	Properties map[string]string
+}
+
+var (
+	securityProtocols    = map[string]bool{"plaintext": true, "ssl": true, "sasl_plaintext": true, "sasl_ssl": true}
+	saslMechanisms       = map[string]bool{"PLAIN": true, "SCRAM-SHA-256": true, "SCRAM-SHA-512": true}
+	assignmentStrategies = map[string]bool{"range": true, "roundrobin": true, "cooperative-sticky": true}
+)
+
+// ConfigFromEnv читает настройки из переменных окружения KAFKA_*, brokers — адрес по умолчанию
+// KAFKA_PROPERTIES: "key=value;key=value", KAFKA_PROPERTIES_FILE: файл key=value по строке, # — комментарий
+func ConfigFromEnv(brokers string) (Config, error) {
+	c := Config{
+		Brokers:            brokers,
+		SecurityProtocol:   strings.ToLower(os.Getenv("KAFKA_SECURITY_PROTOCOL")),
+		SASLMechanism:      strings.ToUpper(os.Getenv("KAFKA_SASL_MECHANISM")),
+		SASLUsername:       os.Getenv("KAFKA_SASL_USERNAME"),
+		SASLPassword:       os.Getenv("KAFKA_SASL_PASSWORD"),
+		TLSCAFile:          os.Getenv("KAFKA_TLS_CA_FILE"),
+		TLSCertFile:        os.Getenv("KAFKA_TLS_CERT_FILE"),
+		TLSKeyFile:         os.Getenv("KAFKA_TLS_KEY_FILE"),
+		TLSKeyPassword:     os.Getenv("KAFKA_TLS_KEY_PASSWORD"),
+		AssignmentStrategy: strings.ToLower(os.Getenv("KAFKA_ASSIGNMENT_STRATEGY")),
+		Properties:         make(map[string]string),
+	}
+	if v := os.Getenv("KAFKA_BROKER"); v != "" {
+		c.Brokers = v
+	}
+	if v := os.Getenv("KAFKA_TLS_INSECURE_SKIP_VERIFY"); v != "" {
+		skip, err := strconv.ParseBool(v)
+		if err != nil {
+			return c, fmt.Errorf("KAFKA_TLS_INSECURE_SKIP_VERIFY: %w", err)
+		}
+		c.TLSSkipVerify = skip
+	}
+	if path := os.Getenv("KAFKA_PROPERTIES_FILE"); path != "" {
+		if err := readProperties(path, c.Properties); err != nil {
+			return c, err
+		}
+	}
+	for _, kv := range strings.Split(os.Getenv("KAFKA_PROPERTIES"), ";") {
+		if kv = strings.TrimSpace(kv); kv == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			return c, fmt.Errorf("KAFKA_PROPERTIES: expected key=value, got %q", kv)
+		}
+		c.Properties[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return c, c.Validate()
+}
+
+func readProperties(path string, dst map[string]string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("kafka properties file: %w", err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		k, v, ok := strings.Cut(line, "=")
+		if !ok {
+			return fmt.Errorf("%s:%d: expected key=value", path, n)
+		}
+		dst[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return scanner.Err()
+}
+
+// Validate проверяет согласованность настроек и то, что librdkafka знает все переданные свойства
+func (c Config) Validate() error {
+	var errs []error
+	if c.Brokers == "" {
+		errs = append(errs, errors.New("brokers are not set"))
+	}
+	protocol := c.protocol()
+	if !securityProtocols[protocol] {
+		errs = append(errs, fmt.Errorf("unknown security protocol %q", c.SecurityProtocol))
+	}
+	sasl := strings.HasPrefix(protocol, "sasl_")
+	switch {
+	case sasl && !saslMechanisms[c.SASLMechanism]:
+		errs = append(errs, fmt.Errorf("%s requires SASL mechanism PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512, got %q",
+			protocol, c.SASLMechanism))
+	case sasl && (c.SASLUsername == "" || c.SASLPassword == ""):
+		errs = append(errs, fmt.Errorf("%s requires SASL username and password", protocol))
+	case !sasl && c.SASLMechanism != "":
+		errs = append(errs, fmt.Errorf("SASL mechanism is set, but security protocol is %s", protocol))
+	}
+	tls := protocol == "ssl" || protocol == "sasl_ssl"
+	if !tls && (c.TLSCAFile != "" || c.TLSCertFile != "" || c.TLSKeyFile != "") {
+		errs = append(errs, fmt.Errorf("TLS files are set, but security protocol is %s", protocol))
+	}
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		errs = append(errs, errors.New("TLS client certificate and key must be set together"))
+	}
+	for _, path := range []string{c.TLSCAFile, c.TLSCertFile, c.TLSKeyFile} {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			errs = append(errs, fmt.Errorf("TLS file: %w", err))
+		}
+	}
+	if c.AssignmentStrategy != "" && !assignmentStrategies[c.AssignmentStrategy] {
+		errs = append(errs, fmt.Errorf("unknown assignment strategy %q, want range, roundrobin or cooperative-sticky",
+			c.AssignmentStrategy))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("kafka config: %w", errors.Join(errs...))
+	}
+
+	// неизвестное свойство или неверное значение librdkafka находит при создании клиента,
+	// ждать подключения не нужно: клиент сразу закрывается
+	cm, err := c.ConfigMap(nil)
+	if err != nil {
+		return err
+	}
+	(*cm)["log_level"] = 0 // клиент успевает начать подключение, его ошибки в логе только путают
+	p, err := kafka.NewProducer(cm)
+	if err != nil {
+		return fmt.Errorf("kafka config: %w", err)
+	}
+	p.Close()
+	return nil
+}
+
+func (c Config) protocol() string {
+	if c.SecurityProtocol == "" {
+		return "plaintext"
+	}
+	return strings.ToLower(c.SecurityProtocol)
+}
+
+// ConfigMap собирает настройки клиента: подключение, затем настройки компонента (group.id и т.п.),
+// затем Properties, чтобы из конфигурации можно было поменять что угодно
+func (c Config) ConfigMap(component kafka.ConfigMap) (*kafka.ConfigMap, error) {
+	cm := kafka.ConfigMap{
+		"bootstrap.servers": c.Brokers,
+		"security.protocol": c.protocol(),
+	}
+	if c.SASLMechanism != "" {
+		cm["sasl.mechanisms"] = c.SASLMechanism
+		cm["sasl.username"] = c.SASLUsername
+		cm["sasl.password"] = c.SASLPassword
+	}
+	set := func(key, value string) {
+		if value != "" {
+			cm[key] = value
+		}
+	}
+	set("ssl.ca.location", c.TLSCAFile)
+	set("ssl.certificate.location", c.TLSCertFile)
+	set("ssl.key.location", c.TLSKeyFile)
+	set("ssl.key.password", c.TLSKeyPassword)
+	if c.TLSSkipVerify {
+		cm["enable.ssl.certificate.verification"] = false
+	}
+	for k, v := range component {
+		cm[k] = v
+	}
+	for k, v := range c.Properties {
+		if err := cm.SetKey(k, v); err != nil {
+			return nil, fmt.Errorf("kafka property %s: %w", k, err)
+		}
+	}
+	return &cm, nil
+}
+
+// String описание настроек для лога, без секретов
+func (c Config) String() string {
+	parts := []string{"brokers=" + c.Brokers, "security.protocol=" + c.protocol()}
+	if c.SASLMechanism != "" {
+		parts = append(parts, "sasl.mechanism="+c.SASLMechanism, "sasl.username="+c.SASLUsername)
+	}
+	if c.TLSCAFile != "" {
+		parts = append(parts, "ssl.ca="+c.TLSCAFile)
+	}
+	if c.TLSCertFile != "" {
+		parts = append(parts, "ssl.cert="+c.TLSCertFile)
+	}
+	if c.AssignmentStrategy != "" {
+		parts = append(parts, "partition.assignment.strategy="+c.AssignmentStrategy)
+	}
+	keys := make([]string, 0, len(c.Properties))
+	for k := range c.Properties {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := c.Properties[k]
+		if strings.Contains(k, "password") || strings.Contains(k, "secret") {
+			v = "***"
+		}
+		parts = append(parts, k+"="+v)
+	}
+	return strings.Join(parts, " ")
+}
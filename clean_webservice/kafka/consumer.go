@@ -0,0 +1,509 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"wb/metrics"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+)
+
+// сколько ждать обработки уже выданных сообщений при отзыве партиций и остановке
+const drainTimeout = 10 * time.Second
+
+type partitionKey struct {
+	topic     string
+	partition int32
+}
+
+// subscription топики consumer: имена и регулярные выражения (начинаются с ^, как в librdkafka)
+type subscription struct {
+	topics   []string
+	names    map[string]bool
+	patterns []*regexp.Regexp
+}
+
+func parseSubscription(topics []string) (subscription, error) {
+	s := subscription{names: make(map[string]bool)}
+	for _, t := range topics {
+		if t = strings.TrimSpace(t); t == "" {
+			continue
+		}
+		if strings.HasPrefix(t, "^") {
+			re, err := regexp.Compile(t)
+			if err != nil {
+				return s, fmt.Errorf("bad topic pattern %q: %w", t, err)
+			}
+			s.patterns = append(s.patterns, re)
+		} else {
+			s.names[t] = true
+		}
+		s.topics = append(s.topics, t)
+	}
+	if len(s.topics) == 0 {
+		return s, errors.New("no topics to subscribe")
+	}
+	return s, nil
+}
+
+func (s subscription) matches(topic string) bool {
+	if s.names[topic] {
+		return true
+	}
+	for _, re := range s.patterns {
+		if re.MatchString(topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// Consumer читает топики в составе группы: оффсет сообщения фиксируется только после Message.Done,
+// при отзыве партиций consumer дожидается обработки выданных сообщений и коммитит их
+type Consumer struct {
+	name     string
+	sub      subscription
+	group    string
+	consumer *kafka.Consumer
+	messages chan Message
+	control  chan func()   // команды админки, выполняются в горутине опроса
+	stopped  chan struct{} // закрывается, когда опрос остановлен
+
+	mu            sync.Mutex
+	closed        bool
+	assignment    map[partitionKey]bool
+	inFlight      map[partitionKey]int
+	paused        map[partitionKey]bool
+	replays       map[partitionKey]ReplayState
+	revoking      map[partitionKey]bool // партиции, отзыв которых ждет обработки выданных сообщений
+	generation    map[partitionKey]int  // растет при перемотке, сообщения старого поколения оффсет не сохраняют
+	held          bool                  // чтение остановлено целиком до Release, см. Hold
+	rebalances    int
+	lastRebalance time.Time
+	startedAt     time.Time
+	lastMessage   map[string]time.Time // по топикам
+}
+
+// PartitionState партиция, назначенная consumer, и число сообщений в обработке
+type PartitionState struct {
+	Topic     string       `json:"topic"`
+	Partition int32        `json:"partition"`
+	InFlight  int          `json:"in_flight"`
+	Paused    bool         `json:"paused"`
+	Replay    *ReplayState `json:"replay,omitempty"`
+}
+
+// ConsumerState состояние consumer для админки
+type ConsumerState struct {
+	Name              string           `json:"name"`
+	Topics            []string         `json:"topics"`
+	Group             string           `json:"group"`
+	RebalanceProtocol string           `json:"rebalance_protocol,omitempty"`
+	Assignment        []PartitionState `json:"assignment"`
+	Rebalances        int              `json:"rebalances"`
+	LastRebalanceAt   *time.Time       `json:"last_rebalance_at,omitempty"`
+	LastMessageAt     *time.Time       `json:"last_message_at,omitempty"`
+	Held              bool             `json:"held"`
+	Closed            bool             `json:"closed"`
+}
+
+// RunKafkaConsumer запускает Kafka consumer с именем name на топики (имена или регулярные выражения с ^),
+// сообщения приходят в Messages(); канал закрывается, когда consumer остановится (например, при отмене контекста)
+func RunKafkaConsumer(ctx context.Context, cfg Config, name string, topics []string, groupID string) (*Consumer, error) {
+	sub, err := parseSubscription(topics)
+	if err != nil {
+		return nil, err
+	}
+	component := kafka.ConfigMap{
+		"group.id":          groupID,
+		"auto.offset.reset": "earliest", //  какойто дефолт на оффсет
+		// оффсет сохраняем сами после обработки, librdkafka коммитит сохраненные в фоне
+		"enable.auto.offset.store": false,
+	}
+	if cfg.AssignmentStrategy != "" {
+		component["partition.assignment.strategy"] = cfg.AssignmentStrategy
+	}
+	cm, err := cfg.ConfigMap(component)
+	if err != nil {
+		return nil, err
+	}
+	consumer, err := kafka.NewConsumer(cm)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Consumer{
+		name:        name,
+		sub:         sub,
+		group:       groupID,
+		consumer:    consumer,
+		messages:    make(chan Message),
+		control:     make(chan func()),
+		stopped:     make(chan struct{}),
+		assignment:  make(map[partitionKey]bool),
+		inFlight:    make(map[partitionKey]int),
+		paused:      make(map[partitionKey]bool),
+		replays:     make(map[partitionKey]ReplayState),
+		revoking:    make(map[partitionKey]bool),
+		generation:  make(map[partitionKey]int),
+		startedAt:   time.Now(),
+		lastMessage: make(map[string]time.Time),
+	}
+	if err := consumer.SubscribeTopics(sub.topics, c.rebalance); err != nil {
+		consumer.Close()
+		return nil, err
+	}
+
+	go c.run(ctx)
+
+	return c, nil
+}
+
+// Name имя consumer, по нему он виден в админке и метриках
+func (c *Consumer) Name() string {
+	return c.name
+}
+
+// Topics подписка consumer как она задана: имена топиков и регулярные выражения
+func (c *Consumer) Topics() []string {
+	return c.sub.topics
+}
+
+// Subscribes читает ли consumer топик, в том числе по регулярному выражению
+func (c *Consumer) Subscribes(topic string) bool {
+	return c.sub.matches(topic)
+}
+
+// LastMessageAt время последнего полученного из топика сообщения; если сообщений еще не было —
+// время запуска consumer и false
+func (c *Consumer) LastMessageAt(topic string) (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	last, ok := c.lastMessage[topic]
+	if !ok {
+		return c.startedAt, false
+	}
+	return last, true
+}
+
+// Messages канал сообщений, после обработки каждого нужно вызвать Done
+func (c *Consumer) Messages() <-chan Message {
+	return c.messages
+}
+
+func (c *Consumer) run(ctx context.Context) {
+	defer func() {
+		// при выходе из горутины дожидаемся обработки выданных сообщений, закрываем consumer
+		// (он отзывает партиции и коммитит сохраненные оффсеты) и канал сообщений
+		// Done после этого оффсет уже не сохраняет: сообщение придет повторно
+		close(c.stopped)
+		c.drain(nil)
+		c.mu.Lock()
+		c.closed = true
+		c.mu.Unlock()
+		if err := c.consumer.Close(); err != nil {
+			log.Printf("Failed to close consumer: %v", err)
+		}
+		close(c.messages)
+		log.Println("Kafka consumer stopped")
+	}()
+
+	// канал для получения системных сигналов для graceful shutdown
+	sigchan := make(chan os.Signal, 1)
+	signal.Notify(sigchan, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigchan)
+
+	run := true
+	for run {
+		select {
+		case sig := <-sigchan:
+			log.Printf("Caught signal %v: terminating consumer", sig)
+			run = false // конструция для закрытия цикла
+		case <-ctx.Done():
+			log.Println("Context cancelled: terminating consumer")
+			run = false // конструция для закрытия цикла
+		case fn := <-c.control:
+			fn()
+		default:
+			// получаем сообщение из кафки с таймаутом 100 мс
+			ev := c.consumer.Poll(100)
+			if ev == nil {
+				continue // если ничего непришло, ждем дальше
+			}
+
+			switch e := ev.(type) {
+			case *kafka.Message:
+				msg := newMessage(e)
+				if !c.checkReplay(&msg) {
+					continue // replay закончился, партиция вернулась к прежней позиции
+				}
+				gen := c.track(e, &msg)
+				if !c.deliver(ctx, msg, gen) {
+					run = false // конструция для закрытия цикла
+				}
+			case kafka.Error:
+				log.Printf("Kafka error: %v", e)
+				// если ошибка фатальная — завершаем работу consumer
+				if e.IsFatal() {
+					run = false // конструция для закрытия цикла
+				}
+			}
+		}
+	}
+}
+
+// deliver отдает сообщение обработчику; пока он занят, выполняет команды админки и Hold/Rewind
+// сообщение партиции, которую за это время перемотали, не отдается: оно придет заново с новой позиции
+func (c *Consumer) deliver(ctx context.Context, msg Message, gen int) bool {
+	key := partitionKey{msg.Topic, msg.Partition}
+	for {
+		select {
+		case c.messages <- msg:
+			return true
+		case fn := <-c.control:
+			fn()
+			c.mu.Lock()
+			stale := c.generation[key] != gen
+			c.mu.Unlock()
+			if stale {
+				msg.done(false)
+				return true
+			}
+		case <-ctx.Done():
+			msg.done(false)
+			return false
+		}
+	}
+}
+
+// track учитывает сообщение как выданное в обработку, возвращает поколение его партиции
+func (c *Consumer) track(e *kafka.Message, msg *Message) int {
+	key := partitionKey{msg.Topic, msg.Partition}
+	c.mu.Lock()
+	c.inFlight[key]++
+	gen := c.generation[key]
+	c.lastMessage[msg.Topic] = time.Now()
+	c.mu.Unlock()
+	var once sync.Once
+	msg.done = func(store bool) {
+		once.Do(func() { c.release(e.TopicPartition, gen, store) })
+	}
+	return gen
+}
+
+// release снимает сообщение с учета, store — сохранить его оффсет для коммита
+func (c *Consumer) release(tp kafka.TopicPartition, gen int, store bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := partitionKey{*tp.Topic, tp.Partition}
+	if c.inFlight[key] > 0 {
+		c.inFlight[key]--
+	}
+	// после отзыва партиции ее оффсет уже не сохранить: сообщение получит новый владелец;
+	// после перемотки сохраненный оффсет задает перемотка
+	if !store || c.closed || !c.assignment[key] || gen != c.generation[key] {
+		return
+	}
+	next := tp
+	next.Offset++
+	// replay перечитывает уже закоммиченные сообщения: сохраненный оффсет не должен уйти назад от ResumeAt,
+	// иначе после перезапуска диапазон и все за ним до прежней позиции прочитаются еще раз
+	if r, ok := c.replays[key]; ok && int64(next.Offset) < r.ResumeAt {
+		return
+	}
+	if _, err := c.consumer.StoreOffsets([]kafka.TopicPartition{next}); err != nil {
+		log.Printf("Failed to store offset %s[%d]@%d: %v", key.topic, key.partition, next.Offset, err)
+	}
+}
+
+// drain ждет, пока выданные сообщения указанных партиций (nil — всех) будут обработаны
+func (c *Consumer) drain(partitions []kafka.TopicPartition) {
+	deadline := time.Now().Add(drainTimeout)
+	for {
+		c.mu.Lock()
+		if c.closed {
+			// остановка уже дождалась обработки, Close отзывает партиции без ожидания
+			c.mu.Unlock()
+			return
+		}
+		pending := 0
+		if partitions == nil {
+			for _, n := range c.inFlight {
+				pending += n
+			}
+		}
+		for _, tp := range partitions {
+			pending += c.inFlight[partitionKey{*tp.Topic, tp.Partition}]
+		}
+		c.mu.Unlock()
+		if pending == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			log.Printf("Consumer %s: %d messages still in flight after %s, they will be redelivered",
+				c.name, pending, drainTimeout)
+			return
+		}
+		// drain идет в горутине опроса: команды, которых ждут обработчики (Rewind), выполняются здесь,
+		// иначе обработчик не завершится до drainTimeout
+		select {
+		case fn := <-c.control:
+			fn()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+// rebalance вызывается из Poll при смене назначения партиций; назначение и отзыв
+// (Assign/IncrementalAssign для cooperative-sticky) выполняет сама библиотека после возврата
+func (c *Consumer) rebalance(consumer *kafka.Consumer, ev kafka.Event) error {
+	cooperative := consumer.GetRebalanceProtocol() == "COOPERATIVE"
+	switch e := ev.(type) {
+	case kafka.AssignedPartitions:
+		log.Printf("Consumer %s: assigned %s", c.name, formatPartitions(e.Partitions))
+		c.mu.Lock()
+		if !cooperative {
+			clear(c.assignment)
+		}
+		for _, tp := range e.Partitions {
+			c.assignment[partitionKey{*tp.Topic, tp.Partition}] = true
+		}
+		held := c.held
+		c.mu.Unlock()
+		if held {
+			// во время Hold новые партиции назначаем сами, чтобы сразу поставить их на паузу
+			c.assignPaused(consumer, e.Partitions, cooperative)
+		}
+		metrics.Inc(fmt.Sprintf(`kafka_rebalances_total{consumer=%q,type="assigned"}`, c.name))
+	case kafka.RevokedPartitions:
+		log.Printf("Consumer %s: revoked %s", c.name, formatPartitions(e.Partitions))
+		c.mu.Lock()
+		for _, tp := range e.Partitions {
+			c.revoking[partitionKey{*tp.Topic, tp.Partition}] = true
+		}
+		c.mu.Unlock()
+		c.drain(e.Partitions)
+		if consumer.AssignmentLost() {
+			// партиции уже у другого участника, коммит отклонит брокер
+			log.Printf("Consumer %s: assignment lost, skip commit", c.name)
+			metrics.Inc(fmt.Sprintf(`kafka_rebalances_total{consumer=%q,type="lost"}`, c.name))
+		} else {
+			var kerr kafka.Error
+			if _, err := consumer.Commit(); err != nil && !(errors.As(err, &kerr) && kerr.Code() == kafka.ErrNoOffset) {
+				log.Printf("Consumer %s: commit on revoke failed: %v", c.name, err)
+			}
+			metrics.Inc(fmt.Sprintf(`kafka_rebalances_total{consumer=%q,type="revoked"}`, c.name))
+		}
+		// пауза и replay относятся к назначению: новый владелец начнет с закоммиченного оффсета
+		c.mu.Lock()
+		for _, tp := range e.Partitions {
+			delete(c.revoking, partitionKey{*tp.Topic, tp.Partition})
+		}
+		if cooperative {
+			for _, tp := range e.Partitions {
+				key := partitionKey{*tp.Topic, tp.Partition}
+				delete(c.assignment, key)
+				delete(c.paused, key)
+				delete(c.replays, key)
+			}
+		} else {
+			clear(c.assignment)
+			clear(c.paused)
+			clear(c.replays)
+		}
+		c.mu.Unlock()
+	}
+	c.mu.Lock()
+	c.rebalances++
+	c.lastRebalance = time.Now()
+	metrics.Set(fmt.Sprintf(`kafka_assigned_partitions{consumer=%q}`, c.name), int64(len(c.assignment)))
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *Consumer) assignPaused(consumer *kafka.Consumer, partitions []kafka.TopicPartition, cooperative bool) {
+	var err error
+	if cooperative {
+		err = consumer.IncrementalAssign(partitions)
+	} else {
+		err = consumer.Assign(partitions)
+	}
+	if err == nil {
+		err = consumer.Pause(partitions)
+	}
+	if err != nil {
+		log.Printf("Consumer %s: failed to pause assigned partitions: %v", c.name, err)
+	}
+}
+
+// State текущее назначение партиций и счетчики ребалансов
+func (c *Consumer) State() ConsumerState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := ConsumerState{
+		Name:       c.name,
+		Topics:     c.sub.topics,
+		Group:      c.group,
+		Assignment: make([]PartitionState, 0, len(c.assignment)),
+		Rebalances: c.rebalances,
+		Held:       c.held,
+		Closed:     c.closed,
+	}
+	if !c.closed {
+		s.RebalanceProtocol = c.consumer.GetRebalanceProtocol()
+	}
+	if !c.lastRebalance.IsZero() {
+		t := c.lastRebalance
+		s.LastRebalanceAt = &t
+	}
+	for _, t := range c.lastMessage {
+		if s.LastMessageAt == nil || t.After(*s.LastMessageAt) {
+			s.LastMessageAt = &t
+		}
+	}
+	for key := range c.assignment {
+		ps := PartitionState{
+			Topic:     key.topic,
+			Partition: key.partition,
+			InFlight:  c.inFlight[key],
+			Paused:    c.paused[key],
+		}
+		if r, ok := c.replays[key]; ok {
+			ps.Replay = &r
+		}
+		s.Assignment = append(s.Assignment, ps)
+	}
+	sort.Slice(s.Assignment, func(i, j int) bool {
+		a, b := s.Assignment[i], s.Assignment[j]
+		if a.Topic != b.Topic {
+			return a.Topic < b.Topic
+		}
+		return a.Partition < b.Partition
+	})
+	return s
+}
+
+func formatPartitions(partitions []kafka.TopicPartition) string {
+	if len(partitions) == 0 {
+		return "nothing"
+	}
+	s := ""
+	for i, tp := range partitions {
+		if i > 0 {
+			s += ", "
+		}
+		s += fmt.Sprintf("%s[%d]", *tp.Topic, tp.Partition)
+	}
+	return s
+}
@@ -1,122 +1,58 @@
 package kafka
 
 import (
-	"context"
-	"log"
-	"os"
-	"os/signal"
-	"syscall"
+	"fmt"
 	"time"
 
 	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
 )
 
-// RunKafkaConsumer запускает Kafka consumer и возвращает канал, в который будет поступать json
-// канал закрывается, когда consumer остановится (например, при отмене контекста)
-func RunKafkaConsumer(ctx context.Context, brokers, topic, groupID string) (<-chan []byte, error) {
-	consumer, err := kafka.NewConsumer(&kafka.ConfigMap{
-		"bootstrap.servers": brokers,
-		"group.id":          groupID,
-		"auto.offset.reset": "earliest", //  какойто дефолт на оффсет
-	})
-	if err != nil {
-		return nil, err
-	}
+// Message сообщение из кафки вместе с координатами (нужны для дедупликации)
+type Message struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+	Key       []byte
+	Value     []byte
+	Headers   map[string]string
+	Timestamp time.Time
+	// Replay сообщение перечитано командой replay: обработать заново, даже если id уже встречался
+	Replay bool
+
+	done func(store bool) // выставляет Consumer: снять с учета и сохранить оффсет после обработки
+}
 
-	if err := consumer.Subscribe(topic, nil); err != nil {
-		consumer.Close()
-		return nil, err
+// Done отмечает сообщение обработанным, его оффсет будет закоммичен
+// сообщения без Done при отзыве партиции или остановке будут доставлены повторно
+func (m Message) Done() {
+	if m.done != nil {
+		m.done(true)
 	}
-
-	msgChan := make(chan []byte)
-
-	go func() {
-		defer func() {
-			// при выходе из горутины закрываем(например контекст) consumer и канал сообщений
-			consumer.Close()
-			close(msgChan)
-			log.Println("Kafka consumer stopped")
-		}()
-
-		// канал для получения системных сигналов для graceful shutdown
-		sigchan := make(chan os.Signal, 1)
-		signal.Notify(sigchan, syscall.SIGINT, syscall.SIGTERM)
-
-		run := true
-		for run {
-			select {
-			case sig := <-sigchan:
-				log.Printf("Caught signal %v: terminating consumer", sig)
-				run = false // конструция для закрытия цикла
-			case <-ctx.Done():
-				log.Println("Context cancelled: terminating consumer")
-				run = false // конструция для закрытия цикла
-			default:
-				// получаем сообщение из кафки с таймаутом 100 сек
-				ev := consumer.Poll(100)
-				if ev == nil {
-					continue // если ничего непришло, ждем дальше
-				}
-
-				switch e := ev.(type) {
-				case *kafka.Message:
-					select {
-					case msgChan <- e.Value:
-						if _, err := consumer.CommitMessage(e); err != nil {
-							log.Printf("Failed to commit message: %v", err)
-						}
-					case <-ctx.Done():
-						run = false // конструция для закрытия цикла
-					}
-				case kafka.Error:
-					log.Printf("Kafka error: %v", e)
-					// если ошибка фатальная — завершаем работу consumer
-					if e.IsFatal() {
-						run = false // конструция для закрытия цикла
-					}
-				}
-			}
-		}
-	}()
-
-	return msgChan, nil
 }
 
-func CreateTopic(brokers, topicName string, numPartitions, replicationFactor int) error {
-	adminClient, err := kafka.NewAdminClient(&kafka.ConfigMap{"bootstrap.servers": brokers})
-	if err != nil {
-		return err
+// ID возвращает идентификатор сообщения: заголовок message_id, если продюсер его прислал,
+// иначе topic/partition/offset — он одинаковый при повторной доставке того же сообщения
+func (m Message) ID() string {
+	if id := m.Headers["message_id"]; id != "" {
+		return id
 	}
-	defer adminClient.Close()
-
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+	return fmt.Sprintf("%s/%d/%d", m.Topic, m.Partition, m.Offset)
+}
 
-	topicSpec := kafka.TopicSpecification{
-		Topic:             topicName,
-		NumPartitions:     numPartitions,
-		ReplicationFactor: replicationFactor,
+func newMessage(e *kafka.Message) Message {
+	msg := Message{
+		Partition: e.TopicPartition.Partition,
+		Offset:    int64(e.TopicPartition.Offset),
+		Key:       e.Key,
+		Value:     e.Value,
+		Headers:   make(map[string]string, len(e.Headers)),
+		Timestamp: e.Timestamp,
 	}
-
-	results, err := adminClient.CreateTopics(
-		ctx,
-		[]kafka.TopicSpecification{topicSpec},
-		kafka.SetAdminOperationTimeout(30*time.Second),
-	)
-	if err != nil {
-		return err
+	if e.TopicPartition.Topic != nil {
+		msg.Topic = *e.TopicPartition.Topic
 	}
-
-	for _, result := range results {
-		if result.Error.Code() != kafka.ErrNoError && result.Error.Code() != kafka.ErrTopicAlreadyExists {
-			return result.Error
-		}
-		if result.Error.Code() == kafka.ErrTopicAlreadyExists {
-			log.Printf("Topic %s already exists", topicName)
-		} else {
-			log.Printf("Topic %s created successfully", topicName)
-		}
+	for _, h := range e.Headers {
+		msg.Headers[h.Key] = string(h.Value)
 	}
-
-	return nil
+	return msg
 }
@@ -0,0 +1,293 @@
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"wb/metrics"
+)
+
+// LagAlertConfig пороги алертов; нулевой порог отключает проверку
+type LagAlertConfig struct {
+	MaxLag     int64         // отставание партиции в сообщениях
+	MaxIdle    time.Duration // сколько консьюмер топика может не получать сообщений
+	Repeat     time.Duration // как часто повторять алерт, пока он не снят
+	WebhookURL string        // пусто — алерты только в лог
+}
+
+// Alert алерт об отставании (kind=lag, Value в сообщениях) или тишине в топике (kind=idle, Value в секундах)
+type Alert struct {
+	Kind      string    `json:"kind"`
+	Status    string    `json:"status"` // firing или resolved
+	Group     string    `json:"group"`
+	Topic     string    `json:"topic"`
+	Partition *int32    `json:"partition,omitempty"`
+	Value     int64     `json:"value"`
+	Threshold int64     `json:"threshold"`
+	Since     time.Time `json:"since"`
+	At        time.Time `json:"at"`
+
+	lastSent time.Time
+}
+
+// TopicLag итог по топику: суммарное отставание и время последнего полученного сообщения
+// LastMessageAt есть только для топиков, из которых этот экземпляр сервиса уже получал сообщения
+type TopicLag struct {
+	Group         string     `json:"group"`
+	Topic         string     `json:"topic"`
+	TotalLag      int64      `json:"total_lag"`
+	LastMessageAt *time.Time `json:"last_message_at,omitempty"`
+	IdleSeconds   int64      `json:"idle_seconds,omitempty"`
+}
+
+// GroupLag отставание партиции в группе консьюмера
+type GroupLag struct {
+	Group string `json:"group"`
+	PartitionLag
+}
+
+// LagStatus результат последней проверки
+type LagStatus struct {
+	Groups     []string   `json:"groups"`
+	CheckedAt  time.Time  `json:"checked_at"`
+	Error      string     `json:"error,omitempty"`
+	Topics     []TopicLag `json:"topics"`
+	Partitions []GroupLag `json:"partitions"`
+	Alerts     []Alert    `json:"alerts"`
+}
+
+// LagMonitor периодически считает отставание групп консьюмеров по закоммиченным оффсетам и watermark,
+// пишет его в метрики и поднимает алерты в лог и webhook
+type LagMonitor struct {
+	admin     *Admin
+	groups    []string
+	consumers []*Consumer
+	alerts    LagAlertConfig
+	client    *http.Client
+
+	mu     sync.Mutex
+	status LagStatus
+	firing map[string]*Alert
+}
+
+// NewLagMonitor монитор групп consumers по топикам, которые они читают
+func NewLagMonitor(admin *Admin, alerts LagAlertConfig, consumers ...*Consumer) *LagMonitor {
+	m := &LagMonitor{
+		admin:     admin,
+		consumers: consumers,
+		alerts:    alerts,
+		client:    &http.Client{Timeout: 5 * time.Second},
+		firing:    make(map[string]*Alert),
+	}
+	for _, c := range consumers {
+		m.groups = append(m.groups, c.group)
+	}
+	m.status.Groups = m.groups
+	return m
+}
+
+// lags отставание каждой группы по топикам ее подписки; для регулярных выражений — по всем топикам группы
+// с коммитами, которые под них подходят
+func (m *LagMonitor) lags(ctx context.Context) ([]GroupLag, error) {
+	var lags []GroupLag
+	for _, c := range m.consumers {
+		var names []string
+		if len(c.sub.patterns) == 0 {
+			for name := range c.sub.names {
+				names = append(names, name)
+			}
+		}
+		group, err := m.admin.Lag(ctx, c.group, names...)
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range group {
+			if c.Subscribes(l.Topic) {
+				lags = append(lags, GroupLag{Group: c.group, PartitionLag: l})
+			}
+		}
+	}
+	return lags, nil
+}
+
+func (m *LagMonitor) consumerOf(topic string) *Consumer {
+	for _, c := range m.consumers {
+		if c.Subscribes(topic) {
+			return c
+		}
+	}
+	return nil
+}
+
+// Run проверяет отставание сразу и дальше с интервалом, пока не отменен контекст
+func (m *LagMonitor) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		checkCtx, cancel := context.WithTimeout(ctx, interval)
+		m.Check(checkCtx)
+		cancel()
+		select {
+		case <-ctx.Done():
+			log.Println("Lag monitor stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Status результат последней проверки и активные алерты
+func (m *LagMonitor) Status() LagStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.status
+	s.Alerts = make([]Alert, 0, len(m.firing))
+	for _, a := range m.firing {
+		s.Alerts = append(s.Alerts, *a)
+	}
+	sort.Slice(s.Alerts, func(i, j int) bool { return s.Alerts[i].Since.Before(s.Alerts[j].Since) })
+	return s
+}
+
+// Check одна проверка: отставание, метрики и алерты
+func (m *LagMonitor) Check(ctx context.Context) {
+	now := time.Now()
+	lags, err := m.lags(ctx)
+	if err != nil {
+		log.Printf("Lag check error: %v", err)
+		metrics.Inc("kafka_lag_check_errors_total")
+		m.mu.Lock()
+		m.status.CheckedAt = now
+		m.status.Error = err.Error()
+		m.mu.Unlock()
+		return
+	}
+
+	// каждый топик читает один консьюмер, так что топик однозначно задает группу
+	totals := make(map[string]*TopicLag)
+	for _, c := range m.consumers {
+		for topic := range c.sub.names {
+			totals[topic] = &TopicLag{Group: c.group, Topic: topic}
+		}
+	}
+	conditions := make(map[string]Alert)
+	for _, l := range lags {
+		metrics.Set(fmt.Sprintf(`kafka_consumer_lag{group=%q,topic=%q,partition="%d"}`, l.Group, l.Topic, l.Partition), l.Lag)
+		t := totals[l.Topic]
+		if t == nil {
+			t = &TopicLag{Group: l.Group, Topic: l.Topic}
+			totals[l.Topic] = t
+		}
+		t.TotalLag += l.Lag
+		if m.alerts.MaxLag > 0 && l.Lag > m.alerts.MaxLag {
+			p := l.Partition
+			conditions[fmt.Sprintf("lag/%s/%d", l.Topic, l.Partition)] = Alert{Kind: "lag", Group: l.Group,
+				Topic: l.Topic, Partition: &p, Value: l.Lag, Threshold: m.alerts.MaxLag}
+		}
+	}
+	for topic, t := range totals {
+		c := m.consumerOf(topic)
+		if c == nil {
+			continue
+		}
+		last, ok := c.LastMessageAt(topic)
+		if ok {
+			t.LastMessageAt = &last
+		}
+		idle := now.Sub(last)
+		t.IdleSeconds = int64(idle.Seconds())
+		metrics.Set(fmt.Sprintf(`kafka_seconds_since_last_message{topic=%q}`, topic), t.IdleSeconds)
+		if m.alerts.MaxIdle > 0 && idle > m.alerts.MaxIdle {
+			conditions["idle/"+topic] = Alert{Kind: "idle", Group: c.group, Topic: topic, Value: t.IdleSeconds,
+				Threshold: int64(m.alerts.MaxIdle.Seconds())}
+		}
+	}
+
+	status := LagStatus{Groups: m.groups, CheckedAt: now, Partitions: lags}
+	for _, t := range totals {
+		metrics.Set(fmt.Sprintf(`kafka_consumer_lag_total{group=%q,topic=%q}`, t.Group, t.Topic), t.TotalLag)
+		status.Topics = append(status.Topics, *t)
+	}
+	sort.Slice(status.Topics, func(i, j int) bool { return status.Topics[i].Topic < status.Topics[j].Topic })
+
+	m.mu.Lock()
+	m.status = status
+	m.mu.Unlock()
+	m.evaluate(ctx, now, conditions)
+}
+
+// evaluate поднимает новые алерты, повторяет активные раз в Repeat и снимает те, чье условие прошло
+func (m *LagMonitor) evaluate(ctx context.Context, now time.Time, conditions map[string]Alert) {
+	var send []Alert
+	m.mu.Lock()
+	for key, cond := range conditions {
+		a, ok := m.firing[key]
+		if !ok {
+			cond.Status, cond.Since = "firing", now
+			a = &cond
+			m.firing[key] = a
+		}
+		a.Value, a.At = cond.Value, now
+		if !ok || (m.alerts.Repeat > 0 && now.Sub(a.lastSent) >= m.alerts.Repeat) {
+			a.lastSent = now
+			send = append(send, *a)
+		}
+	}
+	for key, a := range m.firing {
+		if _, ok := conditions[key]; ok {
+			continue
+		}
+		delete(m.firing, key)
+		resolved := *a
+		resolved.Status, resolved.At = "resolved", now
+		send = append(send, resolved)
+	}
+	metrics.Set("kafka_lag_alerts_firing", int64(len(m.firing)))
+	m.mu.Unlock()
+
+	for _, a := range send {
+		m.notify(ctx, a)
+	}
+}
+
+func (m *LagMonitor) notify(ctx context.Context, a Alert) {
+	where := a.Topic
+	if a.Partition != nil {
+		where = fmt.Sprintf("%s[%d]", a.Topic, *a.Partition)
+	}
+	log.Printf("ALERT %s %s: group %s %s value %d, threshold %d, since %s", a.Status, a.Kind, a.Group, where,
+		a.Value, a.Threshold, a.Since.Format(time.RFC3339))
+	metrics.Inc(fmt.Sprintf(`kafka_lag_alerts_total{kind=%q,status=%q}`, a.Kind, a.Status))
+	if m.alerts.WebhookURL == "" {
+		return
+	}
+	body, err := json.Marshal(a)
+	if err != nil {
+		log.Printf("Alert webhook: %v", err)
+		return
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.alerts.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Alert webhook: %v", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := m.client.Do(req)
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			err = fmt.Errorf("status %s", resp.Status)
+		}
+	}
+	if err != nil {
+		log.Printf("Alert webhook %s failed: %v", m.alerts.WebhookURL, err)
+		metrics.Inc("kafka_lag_webhook_errors_total")
+	}
+}
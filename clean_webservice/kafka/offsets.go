@@ -0,0 +1,512 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+)
+
+// таймаут запросов к брокеру при поиске оффсетов
+const offsetsTimeout = 10 * time.Second
+
+var (
+	// ErrConsumerClosed consumer уже остановлен
+	ErrConsumerClosed = errors.New("consumer is closed")
+	// ErrNotAssigned партиция не назначена этому экземпляру сервиса
+	ErrNotAssigned = errors.New("partition is not assigned to this consumer")
+	// ErrBadTarget позиция для перемотки задана неверно
+	ErrBadTarget = errors.New("bad seek target")
+)
+
+// SeekTarget позиция в партиции: ровно одно из Offset, Time или Position (beginning, end)
+type SeekTarget struct {
+	Offset   *int64
+	Time     time.Time
+	Position string
+}
+
+func (t SeekTarget) validate() error {
+	n := 0
+	if t.Offset != nil {
+		n++
+	}
+	if !t.Time.IsZero() {
+		n++
+	}
+	if t.Position != "" {
+		if t.Position != "beginning" && t.Position != "end" {
+			return fmt.Errorf("%w: position must be beginning or end, got %q", ErrBadTarget, t.Position)
+		}
+		n++
+	}
+	if n != 1 {
+		return fmt.Errorf("%w: set exactly one of offset, timestamp or position", ErrBadTarget)
+	}
+	return nil
+}
+
+func (t SeekTarget) String() string {
+	switch {
+	case t.Offset != nil:
+		return fmt.Sprintf("offset %d", *t.Offset)
+	case !t.Time.IsZero():
+		return "time " + t.Time.Format(time.RFC3339)
+	}
+	return t.Position
+}
+
+// PartitionOffset итог перемотки партиции
+type PartitionOffset struct {
+	Topic     string `json:"topic"`
+	Partition int32  `json:"partition"`
+	Offset    int64  `json:"offset"`
+	// Previous позиция до перемотки (для reset — закоммиченный оффсет группы, -1 если его не было)
+	Previous int64 `json:"previous"`
+}
+
+// ReplayState партиция, в которой идет повторное чтение диапазона [From, To)
+// после To consumer возвращается к ResumeAt — позиции, на которой был до replay
+type ReplayState struct {
+	From     int64 `json:"from"`
+	To       int64 `json:"to"`
+	ResumeAt int64 `json:"resume_at"`
+}
+
+// resolveOffset переводит позицию в конкретный оффсет партиции; оффсет вне [low, high] — ошибка
+func resolveOffset(c offsetQuerier, topic string, partition int32, target SeekTarget) (int64, error) {
+	low, high, err := c.QueryWatermarkOffsets(topic, partition, int(offsetsTimeout.Milliseconds()))
+	if err != nil {
+		return 0, fmt.Errorf("watermarks %s[%d]: %w", topic, partition, err)
+	}
+	switch {
+	case target.Offset != nil && (*target.Offset < low || *target.Offset > high):
+		return 0, fmt.Errorf("%w: offset %d of %s[%d] is outside [%d, %d]", ErrBadTarget,
+			*target.Offset, topic, partition, low, high)
+	case target.Offset != nil:
+		return *target.Offset, nil
+	case target.Position == "beginning":
+		return low, nil
+	case target.Position == "end":
+		return high, nil
+	}
+	res, err := c.OffsetsForTimes([]kafka.TopicPartition{{
+		Topic:     &topic,
+		Partition: partition,
+		Offset:    kafka.Offset(target.Time.UnixMilli()),
+	}}, int(offsetsTimeout.Milliseconds()))
+	if err != nil {
+		return 0, fmt.Errorf("offsets for time %s[%d]: %w", topic, partition, err)
+	}
+	if len(res) != 1 {
+		return 0, fmt.Errorf("offsets for time %s[%d]: empty response", topic, partition)
+	}
+	if res[0].Error != nil {
+		return 0, fmt.Errorf("offsets for time %s[%d]: %w", topic, partition, res[0].Error)
+	}
+	// сообщений позже этого времени нет: позиция — конец партиции
+	if res[0].Offset < 0 {
+		return high, nil
+	}
+	return int64(res[0].Offset), nil
+}
+
+// offsetQuerier общая часть kafka.Consumer, нужная для поиска оффсетов
+type offsetQuerier interface {
+	QueryWatermarkOffsets(topic string, partition int32, timeoutMs int) (low, high int64, err error)
+	OffsetsForTimes(times []kafka.TopicPartition, timeoutMs int) ([]kafka.TopicPartition, error)
+}
+
+// do выполняет fn в горутине опроса: там же вызываются Poll и callback ребаланса,
+// поэтому назначение партиций не поменяется посреди операции
+func (c *Consumer) do(ctx context.Context, fn func() error) error {
+	done := make(chan error, 1)
+	select {
+	case c.control <- func() { done <- fn() }:
+	case <-c.stopped:
+		return ErrConsumerClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// partitionsFor выбирает назначенные партиции топика, пустой список — все назначенные партиции топика
+// вызывается из горутины опроса
+func (c *Consumer) partitionsFor(topic string, partitions []int32) ([]partitionKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var keys []partitionKey
+	if len(partitions) == 0 {
+		for key := range c.assignment {
+			if key.topic == topic {
+				keys = append(keys, key)
+			}
+		}
+		if len(keys) == 0 {
+			return nil, fmt.Errorf("%w: no partitions of %s assigned yet", ErrNotAssigned, topic)
+		}
+	}
+	for _, p := range partitions {
+		key := partitionKey{topic, p}
+		if !c.assignment[key] {
+			return nil, fmt.Errorf("%w: %s[%d]", ErrNotAssigned, topic, p)
+		}
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].partition < keys[j].partition })
+	return keys, nil
+}
+
+func topicPartitions(keys []partitionKey) []kafka.TopicPartition {
+	tps := make([]kafka.TopicPartition, len(keys))
+	for i, key := range keys {
+		topic := key.topic
+		tps[i] = kafka.TopicPartition{Topic: &topic, Partition: key.partition}
+	}
+	return tps
+}
+
+// Pause останавливает чтение партиций топика (пустой список — всех назначенных) до Resume или ребаланса
+func (c *Consumer) Pause(ctx context.Context, topic string, partitions []int32) ([]int32, error) {
+	return c.setPaused(ctx, topic, partitions, true)
+}
+
+// Resume продолжает чтение партиций, остановленных Pause
+func (c *Consumer) Resume(ctx context.Context, topic string, partitions []int32) ([]int32, error) {
+	return c.setPaused(ctx, topic, partitions, false)
+}
+
+func (c *Consumer) setPaused(ctx context.Context, topic string, partitions []int32, paused bool) ([]int32, error) {
+	var changed []int32
+	err := c.do(ctx, func() error {
+		keys, err := c.partitionsFor(topic, partitions)
+		if err != nil {
+			return err
+		}
+		c.mu.Lock()
+		held := c.held
+		c.mu.Unlock()
+		switch {
+		case paused:
+			err = c.consumer.Pause(topicPartitions(keys))
+		case !held:
+			// во время Hold партиции продолжат чтение после Release
+			err = c.consumer.Resume(topicPartitions(keys))
+		}
+		if err != nil {
+			return err
+		}
+		c.mu.Lock()
+		for _, key := range keys {
+			if paused {
+				c.paused[key] = true
+			} else {
+				delete(c.paused, key)
+			}
+			changed = append(changed, key.partition)
+		}
+		c.mu.Unlock()
+		log.Printf("Consumer %s: paused=%t partitions %s%v", c.name, paused, topic, changed)
+		return nil
+	})
+	return changed, err
+}
+
+// Hold останавливает чтение всех назначенных партиций, например пока недоступна база;
+// партиции, назначенные во время Hold, тоже ставятся на паузу. Пауза из админки сохраняется
+func (c *Consumer) Hold(ctx context.Context) error {
+	return c.do(ctx, func() error {
+		c.mu.Lock()
+		if c.held {
+			c.mu.Unlock()
+			return nil
+		}
+		c.held = true
+		keys := make([]partitionKey, 0, len(c.assignment))
+		for key := range c.assignment {
+			keys = append(keys, key)
+		}
+		c.mu.Unlock()
+		log.Printf("Consumer %s: hold", c.name)
+		if len(keys) == 0 {
+			return nil
+		}
+		return c.consumer.Pause(topicPartitions(keys))
+	})
+}
+
+// Release продолжает чтение после Hold, кроме партиций на паузе из админки
+func (c *Consumer) Release(ctx context.Context) error {
+	return c.do(ctx, func() error {
+		c.mu.Lock()
+		if !c.held {
+			c.mu.Unlock()
+			return nil
+		}
+		c.held = false
+		var keys []partitionKey
+		for key := range c.assignment {
+			if !c.paused[key] {
+				keys = append(keys, key)
+			}
+		}
+		c.mu.Unlock()
+		log.Printf("Consumer %s: release", c.name)
+		if len(keys) == 0 {
+			return nil
+		}
+		return c.consumer.Resume(topicPartitions(keys))
+	})
+}
+
+// Rewind возвращает партицию сообщения к его оффсету, сообщение придет повторно; вызывается вместо Done,
+// когда сообщение не удалось обработать по временной причине. Следующие за ним сообщения, уже
+// прочитанные из партиции, отбрасываются
+func (c *Consumer) Rewind(ctx context.Context, msg Message) error {
+	if msg.done == nil {
+		return nil
+	}
+	key := partitionKey{msg.Topic, msg.Partition}
+	c.mu.Lock()
+	revoking := c.revoking[key]
+	c.mu.Unlock()
+	if revoking {
+		// партицию отзывают, перематывать нечего: оффсет не сохранен, сообщение получит новый владелец
+		msg.done(false)
+		return nil
+	}
+	err := c.do(ctx, func() error {
+		c.mu.Lock()
+		assigned := c.assignment[key] && !c.revoking[key]
+		c.mu.Unlock()
+		if !assigned {
+			return nil // оффсет не сохранен, сообщение получит новый владелец партиции
+		}
+		return c.seek(key, msg.Offset, false)
+	})
+	msg.done(false)
+	return err
+}
+
+// Seek перематывает партиции на позицию; новая позиция сразу сохраняется для коммита,
+// поэтому переживает перезапуск, даже если партиция на паузе и сообщений еще не было
+func (c *Consumer) Seek(ctx context.Context, topic string, partitions []int32, target SeekTarget) ([]PartitionOffset, error) {
+	if err := target.validate(); err != nil {
+		return nil, err
+	}
+	var result []PartitionOffset
+	err := c.do(ctx, func() error {
+		keys, err := c.partitionsFor(topic, partitions)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			offset, err := resolveOffset(c.consumer, key.topic, key.partition, target)
+			if err != nil {
+				return err
+			}
+			prev := c.position(key)
+			if err := c.seek(key, offset, true); err != nil {
+				return err
+			}
+			c.mu.Lock()
+			delete(c.replays, key)
+			c.mu.Unlock()
+			result = append(result, PartitionOffset{Topic: key.topic, Partition: key.partition,
+				Offset: offset, Previous: prev})
+		}
+		log.Printf("Consumer %s: seek to %s: %v", c.name, target, result)
+		return nil
+	})
+	return result, err
+}
+
+// Replay повторно читает диапазон [from, to) и возвращается к текущей позиции; сообщения
+// диапазона приходят с Message.Replay, чтобы их не отбросила дедупликация
+func (c *Consumer) Replay(ctx context.Context, topic string, partitions []int32, from, to SeekTarget) ([]ReplayState, error) {
+	if err := from.validate(); err != nil {
+		return nil, fmt.Errorf("from: %w", err)
+	}
+	if err := to.validate(); err != nil {
+		return nil, fmt.Errorf("to: %w", err)
+	}
+	var result []ReplayState
+	err := c.do(ctx, func() error {
+		keys, err := c.partitionsFor(topic, partitions)
+		if err != nil {
+			return err
+		}
+		ranges := make([]ReplayState, len(keys))
+		for i, key := range keys {
+			if ranges[i].From, err = resolveOffset(c.consumer, key.topic, key.partition, from); err != nil {
+				return err
+			}
+			if ranges[i].To, err = resolveOffset(c.consumer, key.topic, key.partition, to); err != nil {
+				return err
+			}
+			if ranges[i].To < ranges[i].From {
+				return fmt.Errorf("%w: %s[%d]: range end %d is before start %d", ErrBadTarget,
+					key.topic, key.partition, ranges[i].To, ranges[i].From)
+			}
+			ranges[i].ResumeAt = max(c.position(key), ranges[i].To)
+		}
+		for i, key := range keys {
+			if ranges[i].From == ranges[i].To {
+				continue
+			}
+			// сохраненный оффсет не трогаем: при перезапуске посреди replay чтение продолжится с ResumeAt
+			if err := c.seek(key, ranges[i].From, false); err != nil {
+				return err
+			}
+			c.mu.Lock()
+			c.replays[key] = ranges[i]
+			c.mu.Unlock()
+			result = append(result, ranges[i])
+		}
+		log.Printf("Consumer %s: replay %s .. %s: %v", c.name, from, to, result)
+		return nil
+	})
+	return result, err
+}
+
+// position оффсет следующего сообщения партиции, -1 если сообщений еще не было
+func (c *Consumer) position(key partitionKey) int64 {
+	tps, err := c.consumer.Position(topicPartitions([]partitionKey{key}))
+	if err != nil || len(tps) == 0 || tps[0].Offset < 0 {
+		return -1
+	}
+	return int64(tps[0].Offset)
+}
+
+// seek перематывает партицию: сообщения, выданные до перемотки, свой оффсет уже не сохранят
+func (c *Consumer) seek(key partitionKey, offset int64, store bool) error {
+	tp := topicPartitions([]partitionKey{key})[0]
+	tp.Offset = kafka.Offset(offset)
+	res, err := c.consumer.SeekPartitions([]kafka.TopicPartition{tp})
+	if err == nil && len(res) == 1 && res[0].Error != nil {
+		err = res[0].Error
+	}
+	if err != nil {
+		return fmt.Errorf("seek %s[%d] to %d: %w", key.topic, key.partition, offset, err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation[key]++
+	if store {
+		if _, err := c.consumer.StoreOffsets([]kafka.TopicPartition{tp}); err != nil {
+			return fmt.Errorf("store offset %s[%d]@%d: %w", key.topic, key.partition, offset, err)
+		}
+	}
+	return nil
+}
+
+// checkReplay вызывается для каждого полученного сообщения: помечает сообщения диапазона replay,
+// а на первом сообщении за его концом возвращает партицию к ResumeAt. false — сообщение отброшено
+func (c *Consumer) checkReplay(msg *Message) bool {
+	key := partitionKey{msg.Topic, msg.Partition}
+	c.mu.Lock()
+	r, ok := c.replays[key]
+	c.mu.Unlock()
+	if !ok {
+		return true
+	}
+	if msg.Offset < r.To {
+		msg.Replay = msg.Offset >= r.From
+		return true
+	}
+	c.mu.Lock()
+	delete(c.replays, key)
+	c.mu.Unlock()
+	log.Printf("Consumer %s: replay of %s[%d] finished at %d", c.name, key.topic, key.partition, r.To)
+	if msg.Offset >= r.ResumeAt {
+		return true
+	}
+	if err := c.seek(key, r.ResumeAt, false); err != nil {
+		log.Printf("Consumer %s: %v", c.name, err)
+		return true
+	}
+	return false
+}
+
+// ResetGroupOffsets коммитит группе оффсеты на позиции target для партиций топика (пустой список — все).
+// Для работающей группы брокер коммит отклонит: сервис нужно остановить или использовать Seek.
+// execute=false только считает новые оффсеты
+func ResetGroupOffsets(cfg Config, group, topic string, partitions []int32, target SeekTarget,
+	execute bool) ([]PartitionOffset, error) {
+	if err := target.validate(); err != nil {
+		return nil, err
+	}
+	cm, err := cfg.ConfigMap(kafka.ConfigMap{
+		"group.id":           group,
+		"enable.auto.commit": false,
+	})
+	if err != nil {
+		return nil, err
+	}
+	consumer, err := kafka.NewConsumer(cm)
+	if err != nil {
+		return nil, err
+	}
+	defer consumer.Close()
+
+	if len(partitions) == 0 {
+		md, err := consumer.GetMetadata(&topic, false, int(offsetsTimeout.Milliseconds()))
+		if err != nil {
+			return nil, fmt.Errorf("metadata %s: %w", topic, err)
+		}
+		tm, ok := md.Topics[topic]
+		if !ok || tm.Error.Code() != kafka.ErrNoError {
+			return nil, fmt.Errorf("topic %s not found", topic)
+		}
+		for _, p := range tm.Partitions {
+			partitions = append(partitions, p.ID)
+		}
+		sort.Slice(partitions, func(i, j int) bool { return partitions[i] < partitions[j] })
+	}
+
+	keys := make([]partitionKey, len(partitions))
+	for i, p := range partitions {
+		keys[i] = partitionKey{topic, p}
+	}
+	committed, err := consumer.Committed(topicPartitions(keys), int(offsetsTimeout.Milliseconds()))
+	if err != nil {
+		return nil, fmt.Errorf("committed offsets: %w", err)
+	}
+	result := make([]PartitionOffset, len(keys))
+	offsets := make([]kafka.TopicPartition, len(keys))
+	for i, key := range keys {
+		offset, err := resolveOffset(consumer, topic, key.partition, target)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = PartitionOffset{Topic: topic, Partition: key.partition, Offset: offset, Previous: -1}
+		if i < len(committed) && committed[i].Offset >= 0 {
+			result[i].Previous = int64(committed[i].Offset)
+		}
+		offsets[i] = topicPartitions([]partitionKey{key})[0]
+		offsets[i].Offset = kafka.Offset(offset)
+	}
+	if !execute {
+		return result, nil
+	}
+	res, err := consumer.CommitOffsets(offsets)
+	if err != nil {
+		return nil, fmt.Errorf("commit offsets for group %s: %w", group, err)
+	}
+	for _, tp := range res {
+		if tp.Error != nil {
+			return nil, fmt.Errorf("commit %s[%d]: %w", topic, tp.Partition, tp.Error)
+		}
+	}
+	return result, nil
+}
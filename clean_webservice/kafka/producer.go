@@ -0,0 +1,109 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+)
+
+// Producer синхронная обертка над продюсером: Publish ждет подтверждения доставки
+// для нагрузки без ожидания каждого сообщения есть PublishAsync
+type Producer struct {
+	producer *kafka.Producer
+	delivery chan kafka.Event // общий канал delivery report для PublishAsync
+}
+
+func NewProducer(cfg Config) (*Producer, error) {
+	cm, err := cfg.ConfigMap(kafka.ConfigMap{
+		"enable.idempotence": true, // без дублей и перестановок внутри партиции при ретраях
+		"acks":               "all",
+	})
+	if err != nil {
+		return nil, err
+	}
+	p, err := kafka.NewProducer(cm)
+	if err != nil {
+		return nil, err
+	}
+	pr := &Producer{producer: p, delivery: make(chan kafka.Event, 10000)}
+	go pr.dispatchDeliveries()
+	return pr, nil
+}
+
+// Publish отправляет сообщение и ждет delivery report
+// сообщения с одинаковым key попадают в одну партицию, так сохраняется порядок событий по заказу
+func (p *Producer) Publish(ctx context.Context, topic string, key, value []byte, headers map[string]string) error {
+	msg := newKafkaMessage(topic, key, value, headers)
+	deliveryChan := make(chan kafka.Event, 1)
+	if err := p.producer.Produce(msg, deliveryChan); err != nil {
+		return fmt.Errorf("produce: %w", err)
+	}
+	select {
+	case ev := <-deliveryChan:
+		m, ok := ev.(*kafka.Message)
+		if !ok {
+			return fmt.Errorf("unexpected delivery event: %v", ev)
+		}
+		if m.TopicPartition.Error != nil {
+			return fmt.Errorf("delivery: %w", m.TopicPartition.Error)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// PublishAsync ставит сообщение в очередь и сразу возвращается, done вызывается из горутины доставки
+// с ошибкой доставки или nil; ошибка самой постановки в очередь (например, очередь переполнена) возвращается сразу
+func (p *Producer) PublishAsync(topic string, key, value []byte, headers map[string]string, done func(err error)) error {
+	msg := newKafkaMessage(topic, key, value, headers)
+	msg.Opaque = done
+	if err := p.producer.Produce(msg, p.delivery); err != nil {
+		return fmt.Errorf("produce: %w", err)
+	}
+	return nil
+}
+
+// IsQueueFull локальная очередь продюсера переполнена, отправку стоит повторить чуть позже
+func IsQueueFull(err error) bool {
+	var kerr kafka.Error
+	return errors.As(err, &kerr) && kerr.Code() == kafka.ErrQueueFull
+}
+
+func (p *Producer) dispatchDeliveries() {
+	for ev := range p.delivery {
+		m, ok := ev.(*kafka.Message)
+		if !ok {
+			continue
+		}
+		done, _ := m.Opaque.(func(error))
+		if done == nil {
+			continue
+		}
+		if m.TopicPartition.Error != nil {
+			done(fmt.Errorf("delivery: %w", m.TopicPartition.Error))
+		} else {
+			done(nil)
+		}
+	}
+}
+
+func newKafkaMessage(topic string, key, value []byte, headers map[string]string) *kafka.Message {
+	msg := &kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: kafka.PartitionAny},
+		Key:            key,
+		Value:          value,
+	}
+	for k, v := range headers {
+		msg.Headers = append(msg.Headers, kafka.Header{Key: k, Value: []byte(v)})
+	}
+	return msg
+}
+
+// Close дожидается отправки того, что осталось в очереди, и закрывает продюсер
+func (p *Producer) Close() {
+	p.producer.Flush(10000)
+	p.producer.Close()
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"wb/kafka"
+
+	"github.com/gin-gonic/gin"
+)
+
+// kafkaAdminTimeout таймаут запросов админки к кластеру по http
+const kafkaAdminTimeout = 15 * time.Second
+
+func kafkaAdminStatus(err error) int {
+	switch {
+	case errors.Is(err, kafka.ErrTopicNotFound), errors.Is(err, kafka.ErrGroupNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusBadGateway
+}
+
+// registerKafkaAdminRoutes просмотр кластера: топики с watermark оффсетами и группы с отставанием
+// изменения (настройки топиков, число партиций) доступны только из cli
+func registerKafkaAdminRoutes(router *gin.Engine, admin *kafka.Admin) {
+	handle := func(fn func(ctx context.Context, c *gin.Context) (any, error)) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			ctx, cancel := context.WithTimeout(c.Request.Context(), kafkaAdminTimeout)
+			defer cancel()
+			result, err := fn(ctx, c)
+			if err != nil {
+				c.JSON(kafkaAdminStatus(err), gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, result)
+		}
+	}
+	router.GET("/admin/kafka/topics", handle(func(ctx context.Context, c *gin.Context) (any, error) {
+		topics, err := admin.ListTopics(ctx)
+		return gin.H{"topics": topics}, err
+	}))
+	router.GET("/admin/kafka/topics/:topic", handle(func(ctx context.Context, c *gin.Context) (any, error) {
+		return admin.DescribeTopic(ctx, c.Param("topic"))
+	}))
+	router.GET("/admin/kafka/groups", handle(func(ctx context.Context, c *gin.Context) (any, error) {
+		groups, err := admin.ListGroups(ctx)
+		return gin.H{"groups": groups}, err
+	}))
+	router.GET("/admin/kafka/groups/:group", handle(func(ctx context.Context, c *gin.Context) (any, error) {
+		return admin.DescribeGroup(ctx, c.Param("group"), c.QueryArray("topic")...)
+	}))
+}
+
+// parseRetention длительность хранения: 36h, 7d или -1 (бессрочно)
+func parseRetention(v string) (time.Duration, error) {
+	if v == "-1" {
+		return -1, nil
+	}
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("bad retention %q", v)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("bad retention %q, expected 36h, 7d or -1", v)
+	}
+	return d, nil
+}
+
+// runKafkaCommand cli админки кластера, настройки подключения берутся из KAFKA_*
+func runKafkaCommand(args []string) error {
+	const usage = "usage: kafka topics | topic <name> | groups | group <name> | lag <group> | " +
+		"alter-config <topic> | partitions <topic> [flags перед именем]"
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+	action := args[0]
+	fs := flag.NewFlagSet("kafka "+action, flag.ExitOnError)
+	timeout := fs.Duration("timeout", 30*time.Second, "таймаут операции")
+	asJSON := fs.Bool("json", false, "вывод в json")
+	topics := fs.String("topic", "", "group, lag: топики через запятую, по умолчанию все с коммитами")
+	retention := fs.String("retention", "", "alter-config: retention.ms как 36h, 7d или -1")
+	cleanup := fs.String("cleanup-policy", "", "alter-config: delete, compact или compact,delete")
+	set := fs.String("set", "", "alter-config: другие настройки key=value через запятую")
+	del := fs.String("delete", "", "alter-config: вернуть настройки к умолчанию, через запятую")
+	count := fs.Int("count", 0, "partitions: новое число партиций")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	name := fs.Arg(0)
+	needName := action != "topics" && action != "groups"
+	if needName && name == "" {
+		return errors.New(usage)
+	}
+
+	// изменения проверяем до подключения к кластеру
+	changes := map[string]string{}
+	var deleted []string
+	if action == "alter-config" {
+		if *retention != "" {
+			d, err := parseRetention(*retention)
+			if err != nil {
+				return err
+			}
+			changes["retention.ms"] = kafka.RetentionMs(d)
+		}
+		if *cleanup != "" {
+			switch *cleanup {
+			case "delete", "compact", "compact,delete", "delete,compact":
+			default:
+				return fmt.Errorf("bad cleanup policy %q", *cleanup)
+			}
+			changes["cleanup.policy"] = *cleanup
+		}
+		for _, kv := range strings.Split(*set, ",") {
+			if kv = strings.TrimSpace(kv); kv == "" {
+				continue
+			}
+			k, v, ok := strings.Cut(kv, "=")
+			if !ok {
+				return fmt.Errorf("-set: expected key=value, got %q", kv)
+			}
+			changes[strings.TrimSpace(k)] = strings.TrimSpace(v)
+		}
+		for _, k := range strings.Split(*del, ",") {
+			if k = strings.TrimSpace(k); k != "" {
+				deleted = append(deleted, k)
+			}
+		}
+	}
+	if action == "partitions" && *count <= 0 {
+		return errors.New("partitions: set -count")
+	}
+
+	cfg, err := kafka.ConfigFromEnv(broker)
+	if err != nil {
+		return err
+	}
+	admin, err := kafka.NewAdmin(cfg)
+	if err != nil {
+		return err
+	}
+	defer admin.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	var filter []string
+	if *topics != "" {
+		filter = strings.Split(*topics, ",")
+	}
+
+	var result any
+	switch action {
+	case "topics":
+		result, err = admin.ListTopics(ctx)
+	case "topic":
+		result, err = admin.DescribeTopic(ctx, name)
+	case "groups":
+		result, err = admin.ListGroups(ctx)
+	case "group":
+		result, err = admin.DescribeGroup(ctx, name, filter...)
+	case "lag":
+		result, err = admin.Lag(ctx, name, filter...)
+	case "alter-config":
+		if err := admin.AlterTopicConfig(ctx, name, changes, deleted); err != nil {
+			return err
+		}
+		result, err = admin.DescribeTopic(ctx, name)
+	case "partitions":
+		if err := admin.IncreasePartitions(ctx, name, *count); err != nil {
+			return err
+		}
+		result, err = admin.DescribeTopic(ctx, name)
+	default:
+		return errors.New(usage)
+	}
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(result)
+	}
+	printKafkaAdmin(result)
+	return nil
+}
+
+// printKafkaAdmin выводит результат команды таблицей
+func printKafkaAdmin(result any) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	defer w.Flush()
+	printLag := func(lags []kafka.PartitionLag) {
+		fmt.Fprintln(w, "TOPIC\tPARTITION\tCOMMITTED\tLOW\tHIGH\tLAG")
+		for _, l := range lags {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\n", l.Topic, l.Partition, l.Committed, l.Low, l.High, l.Lag)
+		}
+	}
+	switch r := result.(type) {
+	case []string:
+		for _, s := range r {
+			fmt.Fprintln(w, s)
+		}
+	case []kafka.GroupListing:
+		fmt.Fprintln(w, "GROUP\tSTATE")
+		for _, g := range r {
+			fmt.Fprintf(w, "%s\t%s\n", g.Group, g.State)
+		}
+	case *kafka.TopicInfo:
+		fmt.Fprintf(w, "Topic %s, %d partitions\n\n", r.Name, len(r.Partitions))
+		fmt.Fprintln(w, "PARTITION\tLEADER\tREPLICAS\tISR\tLOW\tHIGH")
+		for _, p := range r.Partitions {
+			fmt.Fprintf(w, "%d\t%d\t%v\t%v\t%d\t%d\n", p.Partition, p.Leader, p.Replicas, p.ISR, p.Low, p.High)
+		}
+		keys := make([]string, 0, len(r.Configs))
+		for k := range r.Configs {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		if len(keys) > 0 {
+			fmt.Fprintln(w, "\nCONFIG\tVALUE")
+		}
+		for _, k := range keys {
+			fmt.Fprintf(w, "%s\t%s\n", k, r.Configs[k])
+		}
+	case *kafka.GroupInfo:
+		fmt.Fprintf(w, "Group %s, state %s, assignor %s, total lag %d\n\n", r.Group, r.State, r.Assignor, r.TotalLag)
+		fmt.Fprintln(w, "MEMBER\tHOST\tPARTITIONS")
+		for _, m := range r.Members {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", m.ConsumerID, m.Host, strings.Join(m.Partitions, ","))
+		}
+		fmt.Fprintln(w)
+		printLag(r.Lag)
+	case []kafka.PartitionLag:
+		printLag(r)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"wb/kafka"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultLagCheckInterval = 30 * time.Second
+	defaultLagAlertMaxLag   = 1000
+	defaultLagAlertRepeat   = 15 * time.Minute
+)
+
+// envDuration длительность из переменной окружения, 0 допустим (порог отключен)
+func envDuration(name string, def time.Duration) time.Duration {
+	if v := os.Getenv(name); v != "" {
+		d, err := time.ParseDuration(v)
+		if err == nil && d >= 0 {
+			return d
+		}
+		log.Printf("Warning: bad %s %q, using %s", name, v, def)
+	}
+	return def
+}
+
+// lagCheckInterval период проверки отставания из LAG_CHECK_INTERVAL, по умолчанию 30 секунд
+func lagCheckInterval() time.Duration {
+	if d := envDuration("LAG_CHECK_INTERVAL", defaultLagCheckInterval); d > 0 {
+		return d
+	}
+	return defaultLagCheckInterval
+}
+
+// lagAlertConfig пороги алертов из LAG_ALERT_*: MAX_LAG в сообщениях (0 — выключен),
+// MAX_IDLE — сколько топик может молчать (0 — выключен), REPEAT и WEBHOOK
+func lagAlertConfig() kafka.LagAlertConfig {
+	cfg := kafka.LagAlertConfig{
+		MaxLag:     defaultLagAlertMaxLag,
+		MaxIdle:    envDuration("LAG_ALERT_MAX_IDLE", 0),
+		Repeat:     envDuration("LAG_ALERT_REPEAT", defaultLagAlertRepeat),
+		WebhookURL: os.Getenv("LAG_ALERT_WEBHOOK"),
+	}
+	if v := os.Getenv("LAG_ALERT_MAX_LAG"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err == nil && n >= 0 {
+			cfg.MaxLag = n
+		} else {
+			log.Printf("Warning: bad LAG_ALERT_MAX_LAG %q, using %d", v, cfg.MaxLag)
+		}
+	}
+	return cfg
+}
+
+// registerLagRoutes GET /admin/lag — отставание группы по партициям и активные алерты
+func registerLagRoutes(router *gin.Engine, monitor *kafka.LagMonitor) {
+	router.GET("/admin/lag", func(c *gin.Context) {
+		c.JSON(http.StatusOK, monitor.Status())
+	})
+}
@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// простые счетчики без внешних зависимостей, отдаются в текстовом формате prometheus
+// имя может сразу содержать лейблы, например orders_skipped_total{reason="duplicate"}
+var values sync.Map // name -> *atomic.Int64
+
+func get(name string) *atomic.Int64 {
+	v, _ := values.LoadOrStore(name, new(atomic.Int64))
+	return v.(*atomic.Int64)
+}
+
+// Inc увеличивает счетчик на единицу
+func Inc(name string) {
+	get(name).Add(1)
+}
+
+// Add увеличивает счетчик на delta
+func Add(name string, delta int64) {
+	get(name).Add(delta)
+}
+
+// Set выставляет значение (для gauge)
+func Set(name string, value int64) {
+	get(name).Store(value)
+}
+
+// Value текущее значение счетчика, 0 если его еще не было
+func Value(name string) int64 {
+	return get(name).Load()
+}
+
+// Handler отдает все счетчики, отсортированные по имени
+func Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var names []string
+		values.Range(func(k, _ any) bool {
+			names = append(names, k.(string))
+			return true
+		})
+		sort.Strings(names)
+		c.Header("Content-Type", "text/plain; version=0.0.4")
+		for _, name := range names {
+			fmt.Fprintf(c.Writer, "%s %d\n", name, get(name).Load())
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"wb/export"
+	db "wb/postgresql"
+
+	"github.com/gin-gonic/gin"
+)
+
+// exportProgressEvery как часто cli пишет прогресс выгрузки
+const exportProgressEvery = 10000
+
+// parseExportFilter фильтр выгрузки: from/to по date_created в формате YYYY-MM-DD (to не включается),
+// delivery_service, currency, status; пустые значения не ограничивают выборку
+func parseExportFilter(get func(string) string) (db.ExportFilter, error) {
+	f := db.ExportFilter{
+		DeliveryService: get("delivery_service"),
+		Currency:        get("currency"),
+		Status:          db.Status(get("status")),
+	}
+	var err error
+	if v := get("from"); v != "" {
+		if f.From, err = time.Parse(reportDateLayout, v); err != nil {
+			return f, errors.New("bad from date, expected YYYY-MM-DD")
+		}
+	}
+	if v := get("to"); v != "" {
+		if f.To, err = time.Parse(reportDateLayout, v); err != nil {
+			return f, errors.New("bad to date, expected YYYY-MM-DD")
+		}
+	}
+	if f.Status != "" && !f.Status.Valid() {
+		return f, fmt.Errorf("unknown status %q", f.Status)
+	}
+	return f, nil
+}
+
+// exportHandler GET /orders/export?format=csv|ndjson|parquet&layout=flat|nested&gzip=true&from=...&to=...
+// ответ идет потоком из серверного курсора; ошибка посреди выгрузки обрывает ответ, клиент получит неполный файл
+func exportHandler(c *gin.Context) {
+	opts := export.Options{
+		Format: export.Format(c.DefaultQuery("format", "csv")),
+		Layout: export.Layout(c.Query("layout")),
+	}
+	opts.Gzip, _ = strconv.ParseBool(c.Query("gzip"))
+	opts.MaskPII = !canSeePII(c)
+	if err := opts.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filter, err := parseExportFilter(c.Query)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	// по http выгружаются только заказы арендатора из X-Tenant
+	tenant := requestTenant(c)
+	filter.Tenant = &tenant
+
+	c.Header("Content-Type", opts.ContentType())
+	c.Header("Content-Disposition", `attachment; filename="`+opts.FileName()+`"`)
+	c.Status(http.StatusOK)
+	n, err := export.Run(c.Request.Context(), c.Writer, opts, filter, nil)
+	if err != nil {
+		log.Printf("export error after %d orders: %v", n, err)
+		c.Abort()
+		return
+	}
+	log.Printf("Exported %d orders (%s, %s)", n, opts.Format, opts.Layout)
+}
+
+// runExportCommand cli: ./main export -format ndjson -gzip -from 2025-01-01 -out orders.ndjson.gz
+func runExportCommand(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	format := fs.String("format", "csv", "csv, ndjson или parquet")
+	layout := fs.String("layout", "", "flat (строка на товар) или nested (строка на заказ), по умолчанию flat для csv")
+	gz := fs.Bool("gzip", false, "сжать выгрузку")
+	out := fs.String("out", "-", "файл, - для stdout")
+	from := fs.String("from", "", "date_created с этой даты, YYYY-MM-DD")
+	to := fs.String("to", "", "date_created до этой даты (не включая), YYYY-MM-DD")
+	deliveryService := fs.String("delivery-service", "", "фильтр по службе доставки")
+	currency := fs.String("currency", "", "фильтр по валюте")
+	status := fs.String("status", "", "фильтр по статусу заказа")
+	tenant := fs.String("tenant", "", "только заказы арендатора, по умолчанию все; -tenant= — заказы без арендатора")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	opts := export.Options{Format: export.Format(*format), Layout: export.Layout(*layout), Gzip: *gz}
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	values := map[string]string{"from": *from, "to": *to, "delivery_service": *deliveryService,
+		"currency": *currency, "status": *status}
+	filter, err := parseExportFilter(func(k string) string { return values[k] })
+	if err != nil {
+		return err
+	}
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "tenant" {
+			filter.Tenant = tenant
+		}
+	})
+
+	ctx := context.Background()
+	if err := connectDB(ctx); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	w := os.Stdout
+	if *out != "-" {
+		if w, err = os.Create(*out); err != nil {
+			return err
+		}
+		defer w.Close()
+	}
+	start := time.Now()
+	n, err := export.Run(ctx, w, opts, filter, func(n int) {
+		if n%exportProgressEvery == 0 {
+			log.Printf("exported %d orders...", n)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("Exported %d orders in %s", n, time.Since(start).Round(time.Millisecond))
+	return nil
+}
@@ -0,0 +1,445 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"wb/codec"
+	"wb/export"
+	kafka "wb/kafka"
+	db "wb/postgresql"
+)
+
+const (
+	importProgressInterval = 5 * time.Second
+	importMaxLine          = 16 << 20 // самый длинный заказ в ndjson
+)
+
+// importRejected строка отчета об отклоненных заказах (ndjson)
+type importRejected struct {
+	File     string             `json:"file"`
+	Line     int                `json:"line"`
+	OrderUID string             `json:"order_uid,omitempty"`
+	Stage    string             `json:"stage"` // decode, validation, publish или db
+	Errors   []codec.FieldError `json:"errors"`
+	Raw      string             `json:"raw,omitempty"`
+}
+
+// importStats счетчики для прогресса и итога
+type importStats struct {
+	read, valid, rejected, written, skipped atomic.Int64
+}
+
+func (s *importStats) String() string {
+	return fmt.Sprintf("read %d, valid %d, written %d, skipped %d, rejected %d",
+		s.read.Load(), s.valid.Load(), s.written.Load(), s.skipped.Load(), s.rejected.Load())
+}
+
+// orderSource читает заказы из файла: заказ, номер строки, исходный текст (для отчета) и ошибка разбора
+type orderSource interface {
+	Next() (*db.FullOrder, int, []byte, error)
+}
+
+// ndjsonSource по заказу в строке, в том же формате, что сообщения топика orders
+type ndjsonSource struct {
+	scanner *bufio.Scanner
+	decoder *codec.Decoder
+	line    int
+}
+
+func (s *ndjsonSource) Next() (*db.FullOrder, int, []byte, error) {
+	for s.scanner.Scan() {
+		s.line++
+		raw := s.scanner.Bytes()
+		if len(strings.TrimSpace(string(raw))) == 0 {
+			continue
+		}
+		raw = append([]byte(nil), raw...)
+		order, _, _, err := s.decoder.DecodeOrder(context.Background(), topicName,
+			map[string]string{codec.HeaderContentType: codec.ContentTypeJSON}, raw)
+		return order, s.line, raw, err
+	}
+	if err := s.scanner.Err(); err != nil {
+		return nil, s.line, nil, err
+	}
+	return nil, s.line, nil, io.EOF
+}
+
+type csvSource struct{ r *export.CSVReader }
+
+func (s csvSource) Next() (*db.FullOrder, int, []byte, error) {
+	order, line, err := s.r.Next()
+	return order, line, nil, err
+}
+
+// validateImported минимальные проверки сверх разбора: без этих полей заказ бесполезен, дальше — сходимость сумм
+func validateImported(o *db.FullOrder) error {
+	var errs []codec.FieldError
+	if o.Orders.OrderUID == "" {
+		errs = append(errs, codec.FieldError{Path: "orders.order_uid", Kind: codec.ErrKindMissingField, Message: "required"})
+	}
+	if o.Orders.DateCreated.IsZero() {
+		errs = append(errs, codec.FieldError{Path: "orders.date_created", Kind: codec.ErrKindMissingField, Message: "required"})
+	}
+	if o.Payment.Currency == "" {
+		errs = append(errs, codec.FieldError{Path: "payment.currency", Kind: codec.ErrKindMissingField, Message: "required"})
+	}
+	if len(errs) > 0 {
+		return &codec.DecodeError{Errors: errs}
+	}
+	return checkTotals(o)
+}
+
+// importMessageID id по содержимому заказа: повторный импорт того же файла отсекается дедупликацией
+func importMessageID(o *db.FullOrder) (string, error) {
+	data, err := json.Marshal(o)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return "import:" + hex.EncodeToString(sum[:16]), nil
+}
+
+// runImportCommand cli: ./main import -file orders.ndjson [-mode kafka|db] [-dry-run] [-rejected rejected.ndjson]
+func runImportCommand(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	file := fs.String("file", "", "файл с заказами (.ndjson или .csv, можно .gz)")
+	format := fs.String("format", "", "ndjson или csv, по умолчанию по расширению файла")
+	mode := fs.String("mode", "kafka", "kafka — отправить в топик orders, db — записать в базу пачками")
+	dryRun := fs.Bool("dry-run", false, "только разобрать и проверить заказы, ничего не записывать")
+	rejectedPath := fs.String("rejected", "", "куда писать отклоненные заказы (ndjson), по умолчанию <file>.rejected.ndjson")
+	strict := fs.Bool("strict", false, "строгий разбор json: неизвестные и пропущенные поля — ошибка")
+	batchSize := fs.Int("batch", 500, "заказов в одной транзакции для -mode db")
+	workers := fs.Int("workers", 8, "параллельных отправок для -mode kafka")
+	brokers := fs.String("broker", "", "адрес кафки для -mode kafka, по умолчанию KAFKA_BROKER")
+	tenant := fs.String("tenant", "", "арендатор заказов: для -mode kafka уходит в заголовок TENANT_HEADER")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *file == "" {
+		return errors.New("-file is required")
+	}
+	if *mode != "kafka" && *mode != "db" {
+		return fmt.Errorf("unknown mode %q, expected kafka or db", *mode)
+	}
+	if *batchSize <= 0 || *workers <= 0 {
+		return errors.New("-batch and -workers must be positive")
+	}
+	tenantHeader := os.Getenv("TENANT_HEADER")
+	if *tenant != "" && *mode == "kafka" && tenantHeader == "" {
+		return errors.New("-tenant with -mode kafka requires TENANT_HEADER")
+	}
+
+	in, err := os.Open(*file)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	src, err := newOrderSource(in, *file, *format, *strict)
+	if err != nil {
+		return err
+	}
+
+	if *rejectedPath == "" {
+		*rejectedPath = *file + ".rejected.ndjson"
+	}
+	report, err := newRejectedReport(*rejectedPath, *file)
+	if err != nil {
+		return err
+	}
+	defer report.close()
+
+	ctx := context.Background()
+	stats := &importStats{}
+	var sink func(o *db.FullOrder, line int, raw []byte)
+	var finish func() error
+	switch {
+	case *dryRun:
+		sink = func(*db.FullOrder, int, []byte) {}
+		finish = func() error { return nil }
+	case *mode == "kafka":
+		cfg, err := kafka.ConfigFromEnv(broker)
+		if err != nil {
+			return err
+		}
+		if *brokers != "" {
+			cfg.Brokers = *brokers
+		}
+		producer, err := kafka.NewProducer(cfg)
+		if err != nil {
+			return err
+		}
+		defer producer.Close()
+		headers := map[string]string{}
+		if *tenant != "" {
+			headers[tenantHeader] = *tenant
+		}
+		sink, finish = kafkaImportSink(ctx, producer, *workers, headers, stats, report)
+	default:
+		if err := connectDB(ctx); err != nil {
+			return err
+		}
+		defer db.Close()
+		sink, finish = dbImportSink(ctx, filepath.Base(*file), *tenant, *batchSize, stats, report)
+	}
+
+	start := time.Now()
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(importProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				log.Printf("import: %s (%.0f orders/s)", stats, float64(stats.read.Load())/time.Since(start).Seconds())
+			}
+		}
+	}()
+
+	for {
+		order, line, raw, err := src.Next()
+		if err == io.EOF {
+			break
+		}
+		var de *codec.DecodeError
+		var me *db.MoneyError
+		if err != nil && !errors.As(err, &de) && !errors.As(err, &me) {
+			close(done)
+			return fmt.Errorf("read %s line %d: %w", *file, line, err)
+		}
+		stats.read.Add(1)
+		if err != nil {
+			report.add(line, "", "decode", err, raw)
+			stats.rejected.Add(1)
+			continue
+		}
+		if err := validateImported(order); err != nil {
+			report.add(line, order.Orders.OrderUID, "validation", err, raw)
+			stats.rejected.Add(1)
+			continue
+		}
+		stats.valid.Add(1)
+		sink(order, line, raw)
+	}
+	err = finish()
+	close(done)
+
+	log.Printf("import finished in %s: %s", time.Since(start).Round(time.Millisecond), stats)
+	if stats.rejected.Load() > 0 {
+		log.Printf("rejected orders written to %s", *rejectedPath)
+	}
+	if *dryRun {
+		log.Printf("dry run: nothing was written")
+	}
+	return err
+}
+
+func newOrderSource(in io.Reader, name, format string, strict bool) (orderSource, error) {
+	if strings.HasSuffix(name, ".gz") {
+		gz, err := gzip.NewReader(in)
+		if err != nil {
+			return nil, fmt.Errorf("open gzip: %w", err)
+		}
+		in, name = gz, strings.TrimSuffix(name, ".gz")
+	}
+	if format == "" {
+		format = strings.TrimPrefix(filepath.Ext(name), ".")
+	}
+	switch format {
+	case "ndjson", "jsonl", "json":
+		var strictTopics []string
+		if strict {
+			strictTopics = []string{topicName}
+		}
+		scanner := bufio.NewScanner(in)
+		scanner.Buffer(make([]byte, 64*1024), importMaxLine)
+		return &ndjsonSource{scanner: scanner, decoder: codec.NewDecoder(nil, strictTopics)}, nil
+	case "csv":
+		r, err := export.NewCSVReader(in)
+		if err != nil {
+			return nil, err
+		}
+		return csvSource{r}, nil
+	}
+	return nil, fmt.Errorf("unknown import format %q, expected ndjson or csv", format)
+}
+
+// kafkaImportSink отправка в топик orders; заказ уходит в воркер по order_uid, чтобы версии одного заказа не перемешались
+func kafkaImportSink(ctx context.Context, producer *kafka.Producer, workers int, headers map[string]string,
+	stats *importStats, report *rejectedReport) (func(*db.FullOrder, int, []byte), func() error) {
+	type job struct {
+		order *db.FullOrder
+		line  int
+		raw   []byte
+	}
+	queues := make([]chan job, workers)
+	var wg sync.WaitGroup
+	for i := range queues {
+		queues[i] = make(chan job, 100)
+		wg.Add(1)
+		go func(q <-chan job) {
+			defer wg.Done()
+			for j := range q {
+				err := publishImported(ctx, producer, j.order, headers)
+				if err != nil {
+					report.add(j.line, j.order.Orders.OrderUID, "publish", err, j.raw)
+					stats.rejected.Add(1)
+					continue
+				}
+				stats.written.Add(1)
+			}
+		}(queues[i])
+	}
+
+	sink := func(o *db.FullOrder, line int, raw []byte) {
+		h := fnv.New32a()
+		h.Write([]byte(o.Orders.OrderUID))
+		queues[h.Sum32()%uint32(workers)] <- job{order: o, line: line, raw: raw}
+	}
+	finish := func() error {
+		for _, q := range queues {
+			close(q)
+		}
+		wg.Wait()
+		return nil
+	}
+	return sink, finish
+}
+
+func publishImported(ctx context.Context, producer *kafka.Producer, o *db.FullOrder, headers map[string]string) error {
+	value, err := json.Marshal(o)
+	if err != nil {
+		return err
+	}
+	id, err := importMessageID(o)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+	h := map[string]string{
+		codec.HeaderContentType: codec.ContentTypeJSON,
+		"message_id":            id,
+	}
+	for k, v := range headers {
+		h[k] = v
+	}
+	return producer.Publish(ctx, topicName, []byte(o.Orders.OrderUID), value, h)
+}
+
+// dbImportSink запись пачками через db.InsertFullOrders, дубликаты и устаревшие версии считаются пропущенными
+func dbImportSink(ctx context.Context, fileName, tenant string, batchSize int, stats *importStats,
+	report *rejectedReport) (func(*db.FullOrder, int, []byte), func() error) {
+	var (
+		batch []db.BatchOrder
+		lines []int
+		raws  [][]byte
+		fatal error
+	)
+	flush := func() {
+		if len(batch) == 0 || fatal != nil {
+			return
+		}
+		dbCtx, cancel := context.WithTimeout(ctx, reportTimeout)
+		errs, err := db.InsertFullOrders(dbCtx, batch)
+		cancel()
+		if err != nil {
+			fatal = err
+			return
+		}
+		for i, err := range errs {
+			switch {
+			case err == nil:
+				stats.written.Add(1)
+			case errors.Is(err, db.ErrDuplicateMessage), errors.Is(err, db.ErrStaleOrder):
+				stats.skipped.Add(1)
+			default:
+				report.add(lines[i], batch[i].Order.Orders.OrderUID, "db", err, raws[i])
+				stats.rejected.Add(1)
+			}
+		}
+		batch, lines, raws = batch[:0], lines[:0], raws[:0]
+	}
+
+	sink := func(o *db.FullOrder, line int, raw []byte) {
+		id, err := importMessageID(o)
+		if err != nil {
+			report.add(line, o.Orders.OrderUID, "db", err, raw)
+			stats.rejected.Add(1)
+			return
+		}
+		if tenant != "" {
+			id = tenant + "/" + id // как у сообщения с заголовком арендатора, см. messageSource
+		}
+		batch = append(batch, db.BatchOrder{Order: o, Source: db.Source{
+			Kind: "import", MessageID: id, Location: fmt.Sprintf("%s:%d", fileName, line), Tenant: tenant}})
+		lines = append(lines, line)
+		raws = append(raws, raw)
+		if len(batch) >= batchSize {
+			flush()
+		}
+	}
+	finish := func() error {
+		flush()
+		return fatal
+	}
+	return sink, finish
+}
+
+// rejectedReport файл отклоненных заказов, создается только при первой ошибке
+type rejectedReport struct {
+	mu     sync.Mutex
+	path   string
+	source string
+	f      *os.File
+	enc    *json.Encoder
+}
+
+func newRejectedReport(path, source string) (*rejectedReport, error) {
+	// старый отчет от прошлого запуска только запутает
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return &rejectedReport{path: path, source: source}, nil
+}
+
+func (r *rejectedReport) add(line int, orderUID, stage string, err error, raw []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		f, fErr := os.Create(r.path)
+		if fErr != nil {
+			log.Printf("import: cannot write rejected report: %v", fErr)
+			return
+		}
+		r.f, r.enc = f, json.NewEncoder(f)
+	}
+	if wErr := r.enc.Encode(importRejected{File: r.source, Line: line, OrderUID: orderUID, Stage: stage,
+		Errors: codec.FieldErrors(err), Raw: string(raw)}); wErr != nil {
+		log.Printf("import: write rejected report: %v", wErr)
+	}
+}
+
+func (r *rejectedReport) close() {
+	if r.f != nil {
+		r.f.Close()
+	}
+}
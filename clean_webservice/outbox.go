@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	kafka "wb/kafka"
+	"wb/metrics"
+	db "wb/postgresql"
+)
+
+const (
+	eventsTopicName     = "order-events"
+	outboxPollInterval  = time.Second
+	outboxBatchSize     = 100
+	outboxRetention     = time.Hour
+	outboxCleanupPeriod = 10 * time.Minute
+)
+
+// runOutboxRelay публикует события из outbox в топик order-events
+// события идут по порядку id, при ошибке остальные события этого заказа в пачке не отправляются до ретрая
+func runOutboxRelay(ctx context.Context, producer *kafka.Producer) {
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+	cleanup := time.NewTicker(outboxCleanupPeriod)
+	defer cleanup.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Outbox relay stopped")
+			return
+		case <-cleanup.C:
+			dbCtx, cancel := context.WithTimeout(ctx, dbTimeout)
+			n, err := db.CleanupOutbox(dbCtx, outboxRetention)
+			cancel()
+			if err != nil {
+				log.Printf("Outbox cleanup error: %v", err)
+			} else if n > 0 {
+				log.Printf("Outbox cleanup: deleted %d delivered events", n)
+			}
+		case <-ticker.C:
+			relayOutboxBatch(ctx, producer)
+		}
+	}
+}
+
+func relayOutboxBatch(ctx context.Context, producer *kafka.Producer) {
+	dbCtx, cancel := context.WithTimeout(ctx, dbTimeout)
+	events, err := db.FetchOutbox(dbCtx, outboxBatchSize)
+	cancel()
+	if err != nil {
+		log.Printf("Outbox fetch error: %v", err)
+		return
+	}
+
+	blocked := make(map[string]bool)
+	for _, e := range events {
+		if blocked[e.OrderUID] {
+			continue
+		}
+		pubCtx, cancel := context.WithTimeout(ctx, dbTimeout)
+		err := producer.Publish(pubCtx, eventsTopicName, []byte(e.OrderUID), e.Payload,
+			map[string]string{"event_type": e.EventType})
+		cancel()
+
+		dbCtx, cancel = context.WithTimeout(ctx, dbTimeout)
+		if err != nil {
+			log.Printf("Outbox publish error (id=%d, attempt %d): %v", e.ID, e.Attempts+1, err)
+			metrics.Inc(`outbox_publish_failed_total`)
+			blocked[e.OrderUID] = true
+			if err := db.MarkOutboxFailed(dbCtx, e.ID, err); err != nil {
+				log.Printf("Outbox mark failed error: %v", err)
+			}
+		} else {
+			metrics.Inc(`outbox_published_total{event_type="` + e.EventType + `"}`)
+			if err := db.MarkOutboxSent(dbCtx, e.ID); err != nil {
+				// событие уже ушло, при следующей попытке уйдет повторно — консьюмеры должны быть идемпотентны
+				log.Printf("Outbox mark sent error: %v", err)
+				blocked[e.OrderUID] = true
+			}
+		}
+		cancel()
+	}
+}
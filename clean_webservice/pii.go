@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"wb/auth"
+	"wb/pii"
+	db "wb/postgresql"
+
+	"github.com/gin-gonic/gin"
+)
+
+// piiRotateBatch сколько заказов перешифровывается одной транзакцией
+const piiRotateBatch = 500
+
+// piiRolesFromEnv роли, которым персональные данные отдаются открытыми, PII_ROLES (по умолчанию admin)
+func piiRolesFromEnv() map[string]bool {
+	v := os.Getenv("PII_ROLES")
+	if v == "" {
+		v = "admin"
+	}
+	roles := make(map[string]bool)
+	for _, r := range strings.Split(v, ",") {
+		if r = strings.TrimSpace(r); r != "" {
+			roles[r] = true
+		}
+	}
+	return roles
+}
+
+var piiRoles = piiRolesFromEnv()
+
+// canSeePII вызывающему можно отдавать персональные данные доставки без маски
+func canSeePII(c *gin.Context) bool {
+	p := auth.FromContext(c)
+	if p == nil {
+		return false
+	}
+	for _, r := range p.Roles {
+		if piiRoles[r] {
+			return true
+		}
+	}
+	return false
+}
+
+// runPIICommand cli ключей шифрования персональных данных (файл из PII_KEY_FILE):
+// keygen — создать новый ключ и сделать его текущим (создает файл, если его нет),
+// rotate — перешифровать ключи данных заказов текущим ключом и зашифровать открытые данные
+func runPIICommand(args []string) error {
+	const usage = "usage: pii keygen | rotate"
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+	fs := flag.NewFlagSet("pii "+args[0], flag.ExitOnError)
+	file := fs.String("file", os.Getenv("PII_KEY_FILE"), "файл ключей")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *file == "" {
+		return errors.New("key file is not set: PII_KEY_FILE or -file")
+	}
+
+	switch args[0] {
+	case "keygen":
+		keys, err := pii.LoadKeyFile(*file)
+		if errors.Is(err, os.ErrNotExist) {
+			keys, err = &pii.KeyFile{}, nil
+		}
+		if err != nil {
+			return err
+		}
+		id, err := keys.AddKey()
+		if err != nil {
+			return err
+		}
+		if err := keys.Save(*file); err != nil {
+			return err
+		}
+		log.Printf("Key %s added to %s and made current; run `pii rotate` to rewrap data keys", id, *file)
+		return nil
+	case "rotate":
+		os.Setenv("PII_KEY_FILE", *file)
+		ctx := context.Background()
+		if err := connectDB(ctx); err != nil {
+			return err
+		}
+		defer db.Close()
+		n, err := db.RotatePIIKeys(ctx, piiRotateBatch)
+		if err != nil {
+			return fmt.Errorf("rotated %d orders: %w", n, err)
+		}
+		log.Printf("Rotated %d orders to key %s", n, db.PII.CurrentKeyID())
+		return nil
+	}
+	return errors.New(usage)
+}
@@ -0,0 +1,117 @@
+package pii
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// KeyFile локальный провайдер ключей: json файл с ключами AES-256 в base64 и id текущего ключа
+//
+//	{"current": "k20250301", "keys": {"k20250301": "base64...", "k20240101": "base64..."}}
+//
+// старые ключи остаются в файле, пока ими зашифрован хоть один ключ данных, в том числе в архиве
+type KeyFile struct {
+	Current string            `json:"current"`
+	Keys    map[string]string `json:"keys"`
+
+	keys map[string][]byte
+}
+
+// LoadKeyFile читает файл ключей и проверяет, что текущий ключ есть и все ключи нужной длины
+func LoadKeyFile(path string) (*KeyFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read key file: %w", err)
+	}
+	var f KeyFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parse key file %s: %w", path, err)
+	}
+	f.keys = make(map[string][]byte, len(f.Keys))
+	for id, v := range f.Keys {
+		key, err := base64.StdEncoding.DecodeString(v)
+		if err != nil || len(key) != dekSize {
+			return nil, fmt.Errorf("key file %s: key %q must be %d bytes in base64", path, id, dekSize)
+		}
+		f.keys[id] = key
+	}
+	if _, ok := f.keys[f.Current]; !ok {
+		return nil, fmt.Errorf("key file %s: current key %q: %w", path, f.Current, ErrUnknownKey)
+	}
+	return &f, nil
+}
+
+// AddKey создает новый ключ и делает его текущим, возвращает его id
+func (f *KeyFile) AddKey() (string, error) {
+	key := make([]byte, dekSize)
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("generate key: %w", err)
+	}
+	id := "k" + time.Now().UTC().Format("20060102T150405")
+	if f.Keys == nil {
+		f.Keys, f.keys = map[string]string{}, map[string][]byte{}
+	}
+	if _, ok := f.keys[id]; ok {
+		return "", fmt.Errorf("key %q already exists", id)
+	}
+	f.Keys[id] = base64.StdEncoding.EncodeToString(key)
+	f.keys[id] = key
+	f.Current = id
+	return id, nil
+}
+
+// Save записывает файл через временный, чтобы не оставить его наполовину записанным
+func (f *KeyFile) Save(path string) error {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (f *KeyFile) CurrentKeyID() string { return f.Current }
+
+func (f *KeyFile) Wrap(keyID string, dek []byte) ([]byte, error) {
+	aead, err := f.aead(keyID)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, dek, []byte(keyID)), nil
+}
+
+func (f *KeyFile) Unwrap(keyID string, wrapped []byte) ([]byte, error) {
+	aead, err := f.aead(keyID)
+	if err != nil {
+		return nil, err
+	}
+	n := aead.NonceSize()
+	if len(wrapped) < n {
+		return nil, fmt.Errorf("wrapped key too short")
+	}
+	dek, err := aead.Open(nil, wrapped[:n], wrapped[n:], []byte(keyID))
+	if err != nil {
+		return nil, fmt.Errorf("unwrap data key with %q: %w", keyID, err)
+	}
+	return dek, nil
+}
+
+func (f *KeyFile) aead(keyID string) (cipher.AEAD, error) {
+	key, ok := f.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("key %q: %w", keyID, ErrUnknownKey)
+	}
+	return newAEAD(key)
+}
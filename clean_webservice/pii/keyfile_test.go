@@ -0,0 +1,93 @@
+package pii
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeKeyFile файл ключей во временном каталоге теста
+func writeKeyFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "keys.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, dekSize))
+}
+
+func TestLoadKeyFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string // часть текста ошибки, пусто — файл корректен
+		wantErr error
+	}{
+		{name: "ok", content: `{"current": "k1", "keys": {"k1": "` + testKey(1) + `", "k0": "` + testKey(0) + `"}}`},
+		{name: "short key", content: `{"current": "k1", "keys": {"k1": "` + base64.StdEncoding.EncodeToString(make([]byte, 16)) + `"}}`,
+			want: "must be 32 bytes"},
+		{name: "long key", content: `{"current": "k1", "keys": {"k1": "` + base64.StdEncoding.EncodeToString(make([]byte, 33)) + `"}}`,
+			want: "must be 32 bytes"},
+		{name: "not base64", content: `{"current": "k1", "keys": {"k1": "not base64!"}}`, want: "must be 32 bytes"},
+		{name: "old key too short", content: `{"current": "k1", "keys": {"k1": "` + testKey(1) + `", "k0": "AAAA"}}`,
+			want: `key "k0"`},
+		{name: "current missing", content: `{"current": "k2", "keys": {"k1": "` + testKey(1) + `"}}`, wantErr: ErrUnknownKey},
+		{name: "broken json", content: `{"current":`, want: "parse key file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := LoadKeyFile(writeKeyFile(t, tt.content))
+			if tt.want == "" && tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("LoadKeyFile: %v", err)
+				}
+				if f.CurrentKeyID() != "k1" {
+					t.Errorf("current = %q, want k1", f.CurrentKeyID())
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("LoadKeyFile succeeded")
+			}
+			if tt.want != "" && !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("LoadKeyFile = %v, want %q", err, tt.want)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("LoadKeyFile = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+	if _, err := LoadKeyFile(filepath.Join(t.TempDir(), "missing.json")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("LoadKeyFile(missing) = %v, want not exist", err)
+	}
+}
+
+func TestKeyFileSaveAndReload(t *testing.T) {
+	path := writeKeyFile(t, `{"current": "k1", "keys": {"k1": "`+testKey(1)+`"}}`)
+	f, err := LoadKeyFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := f.AddKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := LoadKeyFile(path)
+	if err != nil {
+		t.Fatalf("LoadKeyFile after Save: %v", err)
+	}
+	if reloaded.CurrentKeyID() != id || len(reloaded.Keys) != 2 {
+		t.Errorf("reloaded current %q with %d keys, want %q with 2", reloaded.CurrentKeyID(), len(reloaded.Keys), id)
+	}
+}
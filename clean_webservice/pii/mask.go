@@ -0,0 +1,49 @@
+package pii
+
+import (
+	"strings"
+	"unicode"
+)
+
+const maskTail = "***"
+
+// MaskName первая буква каждого слова: "Test Testov" -> "T*** T***"
+func MaskName(v string) string {
+	words := strings.Fields(v)
+	for i, w := range words {
+		words[i] = string([]rune(w)[:1]) + maskTail
+	}
+	return strings.Join(words, " ")
+}
+
+// MaskPhone остаются код страны с плюсом и две последние цифры: "+9720000000" -> "+9*******00"
+func MaskPhone(v string) string {
+	r := []rune(v)
+	out := make([]rune, len(r))
+	for i, c := range r {
+		switch {
+		case !unicode.IsDigit(c), i < 2, i >= len(r)-2:
+			out[i] = c
+		default:
+			out[i] = '*'
+		}
+	}
+	return string(out)
+}
+
+// MaskEmail первая буква и домен: "test@gmail.com" -> "t***@gmail.com"
+func MaskEmail(v string) string {
+	local, domain, ok := strings.Cut(v, "@")
+	if !ok {
+		return MaskName(v)
+	}
+	return string([]rune(local)[:min(1, len([]rune(local)))]) + maskTail + "@" + domain
+}
+
+// MaskAddress адрес целиком скрывается, город и регион отдаются отдельными полями
+func MaskAddress(v string) string {
+	if v == "" {
+		return ""
+	}
+	return maskTail
+}
@@ -0,0 +1,37 @@
+package pii
+
+import "testing"
+
+func TestMask(t *testing.T) {
+	tests := []struct {
+		name string
+		mask func(string) string
+		in   string
+		want string
+	}{
+		{"name", MaskName, "Test Testov", "T*** T***"},
+		{"name empty", MaskName, "", ""},
+		{"name spaces", MaskName, "  ", ""},
+		{"name cyrillic", MaskName, "Тест Тестов", "Т*** Т***"},
+		{"name cjk", MaskName, "山田 太郎", "山*** 太***"},
+		{"phone", MaskPhone, "+9720000000", "+9*******00"},
+		{"phone empty", MaskPhone, "", ""},
+		{"phone short", MaskPhone, "12", "12"},
+		{"phone separators", MaskPhone, "+7 (912) 345-67-89", "+7 (***) ***-**-89"},
+		{"phone fullwidth digits", MaskPhone, "+７９１２３４５", "+７****４５"},
+		{"email", MaskEmail, "test@gmail.com", "t***@gmail.com"},
+		{"email empty", MaskEmail, "", ""},
+		{"email empty local", MaskEmail, "@gmail.com", "***@gmail.com"},
+		{"email cyrillic", MaskEmail, "тест@почта.рф", "т***@почта.рф"},
+		{"email without at", MaskEmail, "Тест", "Т***"},
+		{"address", MaskAddress, "Ploshad Mira 15", "***"},
+		{"address empty", MaskAddress, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.mask(tt.in); got != tt.want {
+				t.Errorf("mask(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
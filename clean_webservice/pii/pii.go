@@ -0,0 +1,155 @@
+// Package pii шифрование персональных данных конвертом: у каждого заказа свой ключ данных (DEK),
+// он хранится рядом с данными, зашифрованный ключом из KeyProvider (KEK). Смена KEK перешифровывает
+// только ключи данных, сами данные не трогаются
+package pii
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// sealedPrefix отличает зашифрованное значение от открытого, записанного до включения шифрования
+const sealedPrefix = "enc:v1:"
+
+const dekSize = 32
+
+var (
+	// ErrUnknownKey ключа с таким id нет у провайдера
+	ErrUnknownKey = errors.New("unknown key")
+	// ErrNoKey значение зашифровано, а ключ данных не задан
+	ErrNoKey = errors.New("no data key for sealed value")
+)
+
+// KeyProvider хранит ключи шифрования ключей
+type KeyProvider interface {
+	// CurrentKeyID ключ, которым шифруются новые ключи данных
+	CurrentKeyID() string
+	// Wrap шифрует ключ данных ключом keyID
+	Wrap(keyID string, dek []byte) ([]byte, error)
+	// Unwrap расшифровывает ключ данных
+	Unwrap(keyID string, wrapped []byte) ([]byte, error)
+}
+
+// Envelope ключ данных в зашифрованном виде и id ключа, которым он зашифрован
+type Envelope struct {
+	KeyID string `json:"key_id"`
+	DEK   []byte `json:"dek"`
+}
+
+// Cipher выдает ключи данных и открывает их через KeyProvider
+type Cipher struct {
+	keys KeyProvider
+}
+
+func New(keys KeyProvider) *Cipher {
+	return &Cipher{keys: keys}
+}
+
+// NewEnvelope новый ключ данных, зашифрованный текущим ключом
+func (c *Cipher) NewEnvelope() (*Envelope, error) {
+	dek := make([]byte, dekSize)
+	if _, err := rand.Read(dek); err != nil {
+		return nil, fmt.Errorf("generate data key: %w", err)
+	}
+	keyID := c.keys.CurrentKeyID()
+	wrapped, err := c.keys.Wrap(keyID, dek)
+	if err != nil {
+		return nil, err
+	}
+	return &Envelope{KeyID: keyID, DEK: wrapped}, nil
+}
+
+// Sealer шифратор значений ключом данных конверта
+func (c *Cipher) Sealer(env *Envelope) (*Sealer, error) {
+	dek, err := c.keys.Unwrap(env.KeyID, env.DEK)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(dek)
+	if err != nil {
+		return nil, err
+	}
+	return &Sealer{aead: aead}, nil
+}
+
+// Rewrap перешифровывает ключ данных текущим ключом; false — конверт уже на текущем ключе
+func (c *Cipher) Rewrap(env *Envelope) (*Envelope, bool, error) {
+	current := c.keys.CurrentKeyID()
+	if env.KeyID == current {
+		return env, false, nil
+	}
+	dek, err := c.keys.Unwrap(env.KeyID, env.DEK)
+	if err != nil {
+		return nil, false, err
+	}
+	wrapped, err := c.keys.Wrap(current, dek)
+	if err != nil {
+		return nil, false, err
+	}
+	return &Envelope{KeyID: current, DEK: wrapped}, true, nil
+}
+
+// CurrentKeyID ключ, которым шифруются новые ключи данных
+func (c *Cipher) CurrentKeyID() string {
+	return c.keys.CurrentKeyID()
+}
+
+// Sealer шифрует и расшифровывает строки одним ключом данных
+// nil Sealer (шифрование выключено) пропускает значения как есть
+type Sealer struct {
+	aead cipher.AEAD
+}
+
+// Seal шифрует значение; пустая строка остается пустой
+func (s *Sealer) Seal(v string) (string, error) {
+	if s == nil || v == "" || IsSealed(v) {
+		return v, nil
+	}
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("generate nonce: %w", err)
+	}
+	sealed := s.aead.Seal(nonce, nonce, []byte(v), nil)
+	return sealedPrefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Open расшифровывает значение; открытое значение (записанное до шифрования) возвращается как есть
+func (s *Sealer) Open(v string) (string, error) {
+	if !IsSealed(v) {
+		return v, nil
+	}
+	if s == nil {
+		return "", ErrNoKey
+	}
+	data, err := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(v, sealedPrefix))
+	if err != nil {
+		return "", fmt.Errorf("decode sealed value: %w", err)
+	}
+	n := s.aead.NonceSize()
+	if len(data) < n {
+		return "", errors.New("sealed value too short")
+	}
+	plain, err := s.aead.Open(nil, data[:n], data[n:], nil)
+	if err != nil {
+		return "", fmt.Errorf("open sealed value: %w", err)
+	}
+	return string(plain), nil
+}
+
+// IsSealed значение зашифровано Seal
+func IsSealed(v string) bool {
+	return strings.HasPrefix(v, sealedPrefix)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
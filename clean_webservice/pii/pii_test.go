@@ -0,0 +1,155 @@
+package pii
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func newTestCipher(t *testing.T) (*Cipher, *KeyFile) {
+	t.Helper()
+	keys, err := LoadKeyFile(writeKeyFile(t, `{"current": "k1", "keys": {"k1": "`+testKey(1)+`"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(keys), keys
+}
+
+func TestSealOpen(t *testing.T) {
+	c, _ := newTestCipher(t)
+	env, err := c.NewEnvelope()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := c.Sealer(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []string{"Test Testov", "+9720000000", "Тест Тестов", "東京都", "+7 (999) 123-45-67"} {
+		sealed, err := s.Seal(v)
+		if err != nil {
+			t.Fatalf("Seal(%q): %v", v, err)
+		}
+		if !IsSealed(sealed) || strings.Contains(sealed, v) {
+			t.Errorf("Seal(%q) = %q, want sealed value", v, sealed)
+		}
+		again, err := s.Seal(v)
+		if err != nil || again == sealed {
+			t.Errorf("Seal(%q) twice gave the same value, nonce must differ", v)
+		}
+		if resealed, _ := s.Seal(sealed); resealed != sealed {
+			t.Errorf("Seal of a sealed value changed it")
+		}
+		got, err := s.Open(sealed)
+		if err != nil || got != v {
+			t.Errorf("Open(Seal(%q)) = %q, %v", v, got, err)
+		}
+	}
+}
+
+func TestOpenPlaintext(t *testing.T) {
+	c, _ := newTestCipher(t)
+	env, err := c.NewEnvelope()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := c.Sealer(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var off *Sealer // шифрование выключено
+	for _, v := range []string{"", "Test Testov", "Тест"} {
+		if got, err := s.Open(v); err != nil || got != v {
+			t.Errorf("Open(%q) = %q, %v, want value as is", v, got, err)
+		}
+		if got, err := off.Open(v); err != nil || got != v {
+			t.Errorf("nil Open(%q) = %q, %v, want value as is", v, got, err)
+		}
+		if got, err := off.Seal(v); err != nil || got != v {
+			t.Errorf("nil Seal(%q) = %q, %v, want value as is", v, got, err)
+		}
+	}
+	if got, err := s.Seal(""); err != nil || got != "" {
+		t.Errorf("Seal(\"\") = %q, %v, want empty", got, err)
+	}
+
+	sealed, err := s.Seal("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := off.Open(sealed); !errors.Is(err, ErrNoKey) {
+		t.Errorf("nil Open(sealed) = %v, want ErrNoKey", err)
+	}
+	for _, broken := range []string{sealedPrefix + "!!!", sealedPrefix + "AAAA", sealed[:len(sealed)-2] + "AA"} {
+		if _, err := s.Open(broken); err == nil {
+			t.Errorf("Open(%q) succeeded", broken)
+		}
+	}
+}
+
+func TestRewrap(t *testing.T) {
+	c, keys := newTestCipher(t)
+	env, err := c.NewEnvelope()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := c.Sealer(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := s.Seal("Тест Тестов")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if same, changed, err := c.Rewrap(env); err != nil || changed || same != env {
+		t.Fatalf("Rewrap on current key = %v, %v, want unchanged", changed, err)
+	}
+	id, err := keys.AddKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rewrapped, changed, err := c.Rewrap(env)
+	if err != nil || !changed {
+		t.Fatalf("Rewrap = %v, %v, want changed", changed, err)
+	}
+	if rewrapped.KeyID != id || env.KeyID != "k1" {
+		t.Errorf("Rewrap key %q (old %q), want %q (old k1)", rewrapped.KeyID, env.KeyID, id)
+	}
+
+	// ключ данных тот же: значения, зашифрованные до ротации, открываются и через новый, и через старый конверт
+	for _, e := range []*Envelope{rewrapped, env} {
+		s, err := c.Sealer(e)
+		if err != nil {
+			t.Fatalf("Sealer(%s): %v", e.KeyID, err)
+		}
+		if got, err := s.Open(sealed); err != nil || got != "Тест Тестов" {
+			t.Errorf("Open with %s = %q, %v", e.KeyID, got, err)
+		}
+	}
+	// конверт привязан к id ключа: под чужим id он не открывается
+	if _, err := keys.Unwrap("k1", rewrapped.DEK); err == nil {
+		t.Error("Unwrap of new envelope with old key succeeded")
+	}
+}
+
+func TestUnknownKey(t *testing.T) {
+	c, keys := newTestCipher(t)
+	env, err := c.NewEnvelope()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lost := &Envelope{KeyID: "k0", DEK: env.DEK}
+	if _, err := c.Sealer(lost); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Sealer = %v, want ErrUnknownKey", err)
+	}
+	if _, _, err := c.Rewrap(lost); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Rewrap = %v, want ErrUnknownKey", err)
+	}
+	if _, err := keys.Wrap("k0", make([]byte, dekSize)); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Wrap = %v, want ErrUnknownKey", err)
+	}
+	if _, err := keys.Unwrap("k1", env.DEK[:4]); err == nil {
+		t.Error("Unwrap of truncated key succeeded")
+	}
+}
@@ -0,0 +1,363 @@
+package postgresql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"wb/pii"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	// ErrNotArchived заказа нет в архиве
+	ErrNotArchived = errors.New("order is not archived")
+	// ErrOrderExists заказ уже лежит в основных таблицах, восстанавливать нечего
+	ErrOrderExists = errors.New("order already exists")
+)
+
+// RestoredKeep сколько восстановленный заказ не уходит в архив повторно
+const RestoredKeep = 7 * 24 * time.Hour
+
+type (
+	// ArchivedOrder заказ в архиве: все, что нужно, чтобы вернуть его в основные таблицы
+	// персональные данные остаются зашифрованными ключом данных заказа из Envelope
+	ArchivedOrder struct {
+		Order      *FullOrder     `json:"order"`
+		Envelope   *pii.Envelope  `json:"envelope,omitempty"`
+		Tenant     string         `json:"tenant,omitempty"`
+		Status     *OrderStatus   `json:"status"`
+		History    []OrderVersion `json:"history"`
+		ArchivedAt time.Time      `json:"archived_at"`
+	}
+	// ArchiveEntry запись индекса архива archive.orders
+	ArchiveEntry struct {
+		OrderUID    string     `json:"order_uid"`
+		Tenant      string     `json:"tenant,omitempty"`
+		DateCreated time.Time  `json:"date_created"`
+		ArchivedAt  time.Time  `json:"archived_at"`
+		File        string     `json:"file,omitempty"`
+		RestoredAt  *time.Time `json:"restored_at,omitempty"`
+	}
+)
+
+// ArchiveFiles файловое хранилище архива; без него заказы хранятся в jsonb в archive.orders
+type ArchiveFiles interface {
+	// Append дописывает пачку заказов и возвращает имя файла; после возврата пачка уже на диске
+	Append(orders []ArchivedOrder) (string, error)
+	// Read находит заказ в файле
+	Read(file, orderUID string) (*ArchivedOrder, error)
+}
+
+// ArchiveOrders переносит в архив заказы, созданные раньше before, пачками по batchSize
+// каждая пачка — своя транзакция: заказ сначала сохраняется в архив, затем удаляется из основных таблиц
+func ArchiveOrders(ctx context.Context, before time.Time, batchSize int, files ArchiveFiles) (int, error) {
+	total := 0
+	for {
+		n, err := archiveBatch(ctx, before, batchSize, files)
+		total += n
+		if err != nil || n < batchSize {
+			return total, err
+		}
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+	}
+}
+
+func archiveBatch(ctx context.Context, before time.Time, batchSize int, files ArchiveFiles) (n int, err error) {
+	tx, err := Pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback(ctx)
+			return
+		}
+		err = tx.Commit(ctx)
+	}()
+
+	// SKIP LOCKED: заказ, который сейчас обновляется, уйдет в архив в следующий раз
+	rows, err := tx.Query(ctx, `
+		SELECT o.order_uid FROM orders o
+		WHERE o.date_created < $1 AND NOT EXISTS (
+			SELECT 1 FROM archive.orders a WHERE a.order_uid = o.order_uid AND a.restored_at > $3)
+		ORDER BY o.date_created
+		LIMIT $2
+		FOR UPDATE OF o SKIP LOCKED`, before, batchSize, time.Now().Add(-RestoredKeep))
+	if err != nil {
+		return 0, fmt.Errorf("select orders to archive: %w", err)
+	}
+	uids, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return 0, fmt.Errorf("select orders to archive: %w", err)
+	}
+	if len(uids) == 0 {
+		return 0, nil
+	}
+
+	now := time.Now()
+	archived := make([]ArchivedOrder, 0, len(uids))
+	for _, uid := range uids {
+		full, err := getFullOrder(ctx, tx, uid)
+		if err != nil {
+			return 0, fmt.Errorf("archive %s: %w", uid, err)
+		}
+		history, err := orderHistory(ctx, tx, uid)
+		if err != nil {
+			return 0, fmt.Errorf("archive %s: %w", uid, err)
+		}
+		env, err := orderEnvelope(ctx, tx, uid)
+		if err != nil {
+			return 0, err
+		}
+		s, _, err := sealerFor(env, false)
+		if err != nil {
+			return 0, fmt.Errorf("archive %s: %w", uid, err)
+		}
+		if full.Delivery, err = sealDelivery(full.Delivery, s); err != nil {
+			return 0, err
+		}
+		archived = append(archived, ArchivedOrder{
+			Order: full, Envelope: env, Tenant: full.Tenant, Status: full.Status, History: history, ArchivedAt: now,
+		})
+	}
+
+	var file string
+	if files != nil {
+		if file, err = files.Append(archived); err != nil {
+			return 0, fmt.Errorf("write archive file: %w", err)
+		}
+	}
+	for _, a := range archived {
+		var data []byte
+		if files == nil {
+			if data, err = json.Marshal(a); err != nil {
+				return 0, fmt.Errorf("archive %s: marshal: %w", a.Order.Orders.OrderUID, err)
+			}
+		}
+		_, err = tx.Exec(ctx, `
+			INSERT INTO archive.orders (order_uid, tenant, date_created, archived_at, file, data)
+			VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6)
+			ON CONFLICT (order_uid) DO UPDATE SET
+				tenant = EXCLUDED.tenant,
+				date_created = EXCLUDED.date_created,
+				archived_at = EXCLUDED.archived_at,
+				file = EXCLUDED.file,
+				data = EXCLUDED.data,
+				restored_at = NULL`,
+			a.Order.Orders.OrderUID, a.Tenant, a.Order.Orders.DateCreated, now, file, data)
+		if err != nil {
+			return 0, fmt.Errorf("archive %s: %w", a.Order.Orders.OrderUID, err)
+		}
+	}
+
+	// delivery, payment, items и лента статусов удаляются каскадом
+	if _, err = tx.Exec(ctx, `DELETE FROM order_history WHERE order_uid = ANY($1)`, uids); err != nil {
+		return 0, fmt.Errorf("delete archived history: %w", err)
+	}
+	if _, err = tx.Exec(ctx, `DELETE FROM orders WHERE order_uid = ANY($1)`, uids); err != nil {
+		return 0, fmt.Errorf("delete archived orders: %w", err)
+	}
+	return len(uids), nil
+}
+
+// GetArchiveEntry запись архива о заказе арендатора, ErrNotArchived если заказа в архиве нет
+func GetArchiveEntry(ctx context.Context, tenant, orderUID string) (*ArchiveEntry, error) {
+	var e ArchiveEntry
+	var file *string
+	err := Pool.QueryRow(ctx, `
+		SELECT order_uid, tenant, date_created, archived_at, file, restored_at
+		FROM archive.orders WHERE order_uid=$1 AND tenant=$2`, orderUID, tenant).
+		Scan(&e.OrderUID, &e.Tenant, &e.DateCreated, &e.ArchivedAt, &file, &e.RestoredAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("order %s: %w", orderUID, ErrNotArchived)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getArchiveEntry: %w", err)
+	}
+	if file != nil {
+		e.File = *file
+	}
+	return &e, nil
+}
+
+// RestoreOrder возвращает заказ арендатора из архива в основные таблицы вместе со статусами и историей
+// запись в архиве остается с restored_at: RestoredKeep заказ не архивируется повторно
+func RestoreOrder(ctx context.Context, tenant, orderUID string, files ArchiveFiles) (restored *FullOrder, err error) {
+	tx, err := Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback(ctx)
+			return
+		}
+		err = tx.Commit(ctx)
+	}()
+
+	if err := lockOrder(ctx, tx, orderUID); err != nil {
+		return nil, err
+	}
+	var (
+		file       *string
+		data       []byte
+		restoredAt *time.Time
+	)
+	err = tx.QueryRow(ctx, `
+		SELECT file, data, restored_at FROM archive.orders WHERE order_uid=$1 AND tenant=$2 FOR UPDATE`,
+		orderUID, tenant).Scan(&file, &data, &restoredAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("order %s: %w", orderUID, ErrNotArchived)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("select archive entry: %w", err)
+	}
+	var exists bool
+	if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM orders WHERE order_uid=$1)`, orderUID).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("check order: %w", err)
+	}
+	if exists {
+		return nil, fmt.Errorf("order %s: %w", orderUID, ErrOrderExists)
+	}
+
+	var a *ArchivedOrder
+	switch {
+	case data != nil:
+		a = &ArchivedOrder{}
+		if err := json.Unmarshal(data, a); err != nil {
+			return nil, fmt.Errorf("decode archived order %s: %w", orderUID, err)
+		}
+	case file != nil && files != nil:
+		if a, err = files.Read(*file, orderUID); err != nil {
+			return nil, fmt.Errorf("read archive file %s: %w", *file, err)
+		}
+	default:
+		return nil, fmt.Errorf("order %s archived to file %v, archive files are not configured", orderUID, file)
+	}
+	if err := a.Order.ApplyCurrency(); err != nil {
+		return nil, fmt.Errorf("restore %s: %w", orderUID, err)
+	}
+	s, env, err := sealerFor(a.Envelope, true)
+	if err != nil {
+		return nil, fmt.Errorf("restore %s: %w", orderUID, err)
+	}
+	if err := openDelivery(&a.Order.Delivery, s); err != nil {
+		return nil, fmt.Errorf("restore %s: %w", orderUID, err)
+	}
+	a.Envelope = env
+	if err := insertArchived(ctx, tx, a); err != nil {
+		return nil, fmt.Errorf("restore %s: %w", orderUID, err)
+	}
+	if _, err := tx.Exec(ctx, `UPDATE archive.orders SET restored_at = now() WHERE order_uid=$1`, orderUID); err != nil {
+		return nil, fmt.Errorf("mark restored: %w", err)
+	}
+	restored = a.Order
+	restored.Tenant, restored.Status = a.Tenant, a.Status
+	if restored.UpdatedAt, err = getOrderUpdatedAt(ctx, tx, orderUID); err != nil {
+		return nil, err
+	}
+	return restored, nil
+}
+
+// insertArchived пишет архивный заказ в основные таблицы как есть, без новых версий и событий
+// доставка приходит расшифрованной и шифруется ключом из a.Envelope
+func insertArchived(ctx context.Context, tx pgx.Tx, a *ArchivedOrder) error {
+	o := a.Order
+	s, _, err := sealerFor(a.Envelope, false)
+	if err != nil {
+		return err
+	}
+	delivery, err := sealDelivery(o.Delivery, s)
+	if err != nil {
+		return err
+	}
+	keyID, dek := envelopeColumns(a.Envelope)
+	created := o.Orders.DateCreated
+	status := StatusCreated
+	if a.Status != nil {
+		status = a.Status.Status
+	}
+	_, err = tx.Exec(ctx, `
+		INSERT INTO orders (order_uid, track_number, entry, locale, internal_signature, customer_id,
+			delivery_service, shardkey, sm_id, date_created, oof_shard, tenant, status)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13)`,
+		o.Orders.OrderUID, o.Orders.TrackNumber, o.Orders.Entry, o.Orders.Locale, o.Orders.InternalSignature,
+		o.Orders.CustomerID, o.Orders.DeliveryService, o.Orders.Shardkey, o.Orders.SmID, created, o.Orders.OofShard,
+		a.Tenant, status)
+	if err != nil {
+		return fmt.Errorf("insert order: %w", err)
+	}
+	_, err = tx.Exec(ctx, `
+		INSERT INTO delivery (order_uid, name, phone, zip, city, address, region, email, date_created, key_id, dek)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11)`,
+		o.Orders.OrderUID, delivery.Name, delivery.Phone, delivery.Zip, delivery.City,
+		delivery.Address, delivery.Region, delivery.Email, created, keyID, dek)
+	if err != nil {
+		return fmt.Errorf("insert delivery: %w", err)
+	}
+	_, err = tx.Exec(ctx, `
+		INSERT INTO payment (order_uid, transaction, request_id, currency, provider, amount, payment_dt, bank,
+			delivery_cost, goods_total, custom_fee, date_created)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12)`,
+		o.Orders.OrderUID, o.Payment.Transaction, o.Payment.RequestID, o.Payment.Currency, o.Payment.Provider,
+		o.Payment.Amount, o.Payment.PaymentDT, o.Payment.Bank, o.Payment.DeliveryCost, o.Payment.GoodsTotal,
+		o.Payment.CustomFee, created)
+	if err != nil {
+		return fmt.Errorf("insert payment: %w", err)
+	}
+	for _, item := range o.Items {
+		lifecycle := StatusCreated
+		if s, ok := a.Status.itemStatus(item.ChrtID); ok {
+			lifecycle = s
+		}
+		_, err = tx.Exec(ctx, `
+			INSERT INTO items (order_uid, chrt_id, track_number, price, rid, name, sale, size, total_price,
+				nm_id, brand, status, lifecycle_status, date_created)
+			VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14)`,
+			o.Orders.OrderUID, item.ChrtID, item.TrackNumber, item.Price, item.Rid, item.Name, item.Sale,
+			item.Size, item.TotalPrice, item.NmID, item.Brand, item.Status, lifecycle, created)
+		if err != nil {
+			return fmt.Errorf("insert item (chrt_id=%d): %w", item.ChrtID, err)
+		}
+	}
+	if a.Status != nil {
+		for _, c := range a.Status.Timeline {
+			_, err = tx.Exec(ctx, `
+				INSERT INTO order_status_history (order_uid, chrt_id, from_status, to_status, changed_at, source,
+					reason, date_created)
+				VALUES ($1,$2,$3,$4,$5,$6,$7,$8)`,
+				o.Orders.OrderUID, c.ChrtID, c.From, c.To, c.ChangedAt, c.Source, c.Reason, created)
+			if err != nil {
+				return fmt.Errorf("insert status change: %w", err)
+			}
+		}
+	}
+	for _, v := range a.History {
+		diff, err := json.Marshal(v.Diff)
+		if err != nil {
+			return fmt.Errorf("marshal history diff: %w", err)
+		}
+		_, err = tx.Exec(ctx, `
+			INSERT INTO order_history (order_uid, version, source, source_ref, changed_at, data, diff)
+			VALUES ($1,$2,$3,$4,$5,$6,$7)`,
+			o.Orders.OrderUID, v.Version, v.Source, v.SourceRef, v.ChangedAt, []byte(v.Order), diff)
+		if err != nil {
+			return fmt.Errorf("insert history version %d: %w", v.Version, err)
+		}
+	}
+	return nil
+}
+
+func (s *OrderStatus) itemStatus(chrtID int64) (Status, bool) {
+	if s == nil {
+		return "", false
+	}
+	st, ok := s.Items[chrtID]
+	return st, ok
+}
@@ -0,0 +1,76 @@
+package postgresql
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// AuditRecord запись журнала доступа
+type AuditRecord struct {
+	ID       int64     `json:"id"`
+	At       time.Time `json:"at"`
+	Subject  string    `json:"subject"`
+	Roles    string    `json:"roles"`
+	Method   string    `json:"method"`
+	Action   string    `json:"action"`
+	OrderUID *string   `json:"order_uid,omitempty"`
+	Tenant   string    `json:"tenant"`
+	Status   int       `json:"status"`
+	IP       string    `json:"ip"`
+}
+
+// AuditFilter отбор записей журнала, пустые поля не ограничивают
+type AuditFilter struct {
+	OrderUID string
+	Subject  string
+	Limit    int
+}
+
+// InsertAudit пишет пачку записей журнала одним запросом
+func InsertAudit(ctx context.Context, records []AuditRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	batch := &pgx.Batch{}
+	for _, r := range records {
+		batch.Queue(`
+			INSERT INTO audit_log (at, subject, roles, method, action, order_uid, tenant, status, ip)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+			r.At, r.Subject, r.Roles, r.Method, r.Action, r.OrderUID, r.Tenant, r.Status, r.IP)
+	}
+	if err := Pool.SendBatch(ctx, batch).Close(); err != nil {
+		return fmt.Errorf("insert audit (%d records): %w", len(records), err)
+	}
+	return nil
+}
+
+// ListAudit последние записи журнала, новые первыми
+func ListAudit(ctx context.Context, f AuditFilter) ([]AuditRecord, error) {
+	if f.Limit <= 0 {
+		f.Limit = 100
+	}
+	rows, err := Pool.Query(ctx, `
+		SELECT id, at, subject, roles, method, action, order_uid, tenant, status, ip
+		FROM audit_log
+		WHERE ($1 = '' OR order_uid = $1) AND ($2 = '' OR subject = $2)
+		ORDER BY at DESC, id DESC
+		LIMIT $3`, f.OrderUID, f.Subject, f.Limit)
+	if err != nil {
+		return nil, fmt.Errorf("listAudit query: %w", err)
+	}
+	defer rows.Close()
+
+	var records []AuditRecord
+	for rows.Next() {
+		var r AuditRecord
+		if err := rows.Scan(&r.ID, &r.At, &r.Subject, &r.Roles, &r.Method, &r.Action, &r.OrderUID,
+			&r.Tenant, &r.Status, &r.IP); err != nil {
+			return nil, fmt.Errorf("listAudit scan: %w", err)
+		}
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
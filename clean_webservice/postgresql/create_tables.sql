@@ -16,13 +16,13 @@ CREATE TABLE IF NOT EXISTS orders (
 -- Таблица доставки
 CREATE TABLE IF NOT EXISTS delivery (
     order_uid VARCHAR(255) PRIMARY KEY REFERENCES orders(order_uid) ON DELETE CASCADE,
-    name VARCHAR(255) NOT NULL,
-    phone VARCHAR(50) NOT NULL,
+    name TEXT NOT NULL,
+    phone TEXT NOT NULL,
     zip VARCHAR(20) NOT NULL,
     city VARCHAR(100) NOT NULL,
     address TEXT NOT NULL,
     region VARCHAR(100) NOT NULL,
-    email VARCHAR(255) NOT NULL
+    email TEXT NOT NULL
 );
 
 -- Таблица платежей
@@ -32,12 +32,12 @@ CREATE TABLE IF NOT EXISTS payment (
     request_id VARCHAR(255),
     currency VARCHAR(10) NOT NULL,
     provider VARCHAR(50) NOT NULL,
-    amount INTEGER NOT NULL,
+    amount NUMERIC(20,4) NOT NULL,
     payment_dt BIGINT NOT NULL,
     bank VARCHAR(100) NOT NULL,
-    delivery_cost INTEGER NOT NULL,
-    goods_total INTEGER NOT NULL,
-    custom_fee INTEGER NOT NULL
+    delivery_cost NUMERIC(20,4) NOT NULL,
+    goods_total NUMERIC(20,4) NOT NULL,
+    custom_fee NUMERIC(20,4) NOT NULL
 );
 
 -- Таблица товаров (items)
@@ -46,12 +46,12 @@ CREATE TABLE IF NOT EXISTS items (
     order_uid VARCHAR(255) NOT NULL REFERENCES orders(order_uid) ON DELETE CASCADE,
     chrt_id BIGINT NOT NULL,
     track_number VARCHAR(255) NOT NULL,
-    price INTEGER NOT NULL,
+    price NUMERIC(20,4) NOT NULL,
     rid VARCHAR(255) NOT NULL,
     name VARCHAR(255) NOT NULL,
     sale INTEGER NOT NULL,
     size VARCHAR(50) NOT NULL,
-    total_price INTEGER NOT NULL,
+    total_price NUMERIC(20,4) NOT NULL,
     nm_id BIGINT NOT NULL,
     brand VARCHAR(255) NOT NULL,
     status INTEGER NOT NULL
@@ -59,3 +59,144 @@ CREATE TABLE IF NOT EXISTS items (
 
 -- Уникальный индекс для предотвращения дубликатов товаров в одном заказе
 CREATE UNIQUE INDEX IF NOT EXISTS idx_items_order_chrt ON items(order_uid, chrt_id);
+
+-- Обработанные сообщения из кафки, нужны для идемпотентной вставки
+CREATE TABLE IF NOT EXISTS processed_messages (
+    message_id VARCHAR(255) PRIMARY KEY,
+    order_uid VARCHAR(255) NOT NULL,
+    processed_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Старые id удаляются по DEDUP_RETENTION, индекс для этой выборки
+CREATE INDEX IF NOT EXISTS idx_processed_messages_at ON processed_messages(processed_at);
+
+-- Мягкое удаление товаров, пропавших из повторно присланного заказа
+ALTER TABLE items ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+-- История версий заказа: снимок, источник и изменения по полям
+CREATE TABLE IF NOT EXISTS order_history (
+    id BIGSERIAL PRIMARY KEY,
+    order_uid VARCHAR(255) NOT NULL,
+    version INTEGER NOT NULL,
+    source VARCHAR(20) NOT NULL,
+    source_ref VARCHAR(255) NOT NULL,
+    changed_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    data JSONB NOT NULL,
+    diff JSONB NOT NULL,
+    UNIQUE (order_uid, version)
+);
+
+-- Статусы жизненного цикла заказа и товаров
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'created';
+ALTER TABLE items ADD COLUMN IF NOT EXISTS lifecycle_status VARCHAR(20) NOT NULL DEFAULT 'created';
+
+-- Лента переходов статусов, chrt_id заполнен для статуса отдельного товара
+CREATE TABLE IF NOT EXISTS order_status_history (
+    id BIGSERIAL PRIMARY KEY,
+    order_uid VARCHAR(255) NOT NULL REFERENCES orders(order_uid) ON DELETE CASCADE,
+    chrt_id BIGINT,
+    from_status VARCHAR(20),
+    to_status VARCHAR(20) NOT NULL,
+    changed_at TIMESTAMPTZ NOT NULL,
+    source VARCHAR(255) NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_status_history_order ON order_status_history(order_uid, changed_at);
+
+-- Transactional outbox: события о заказах, которые relay публикует в выходной топик
+CREATE TABLE IF NOT EXISTS outbox (
+    id BIGSERIAL PRIMARY KEY,
+    order_uid VARCHAR(255) NOT NULL,
+    event_type VARCHAR(50) NOT NULL,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    sent_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_pending ON outbox(id) WHERE sent_at IS NULL;
+
+-- Отчеты в базовой валюте выбирают платежи по дате
+CREATE INDEX IF NOT EXISTS idx_payment_dt ON payment(payment_dt);
+
+-- Витрины для /stats: агрегаты по дням, пересчитываются по расписанию (RefreshStats)
+CREATE TABLE IF NOT EXISTS stats_orders_daily (
+    day DATE NOT NULL,
+    currency VARCHAR(10) NOT NULL,
+    delivery_service VARCHAR(100) NOT NULL,
+    provider VARCHAR(50) NOT NULL,
+    bank VARCHAR(100) NOT NULL,
+    region VARCHAR(100) NOT NULL,
+    orders BIGINT NOT NULL,
+    revenue NUMERIC(24,4) NOT NULL,
+    refreshed_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_stats_orders_daily_day ON stats_orders_daily(day);
+
+CREATE TABLE IF NOT EXISTS stats_brands_daily (
+    day DATE NOT NULL,
+    currency VARCHAR(10) NOT NULL,
+    brand VARCHAR(255) NOT NULL,
+    orders BIGINT NOT NULL,
+    revenue NUMERIC(24,4) NOT NULL,
+    refreshed_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_stats_brands_daily_day ON stats_brands_daily(day);
+
+-- Арендатор заказа: из топика или заголовка сообщения, пустой — заказ без арендатора
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS tenant VARCHAR(100) NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_orders_tenant ON orders(tenant, date_created);
+
+-- Витрины статистики считаются по арендаторам
+ALTER TABLE stats_orders_daily ADD COLUMN IF NOT EXISTS tenant VARCHAR(100) NOT NULL DEFAULT '';
+ALTER TABLE stats_brands_daily ADD COLUMN IF NOT EXISTS tenant VARCHAR(100) NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS idx_stats_orders_daily_tenant ON stats_orders_daily(tenant, day);
+CREATE INDEX IF NOT EXISTS idx_stats_brands_daily_tenant ON stats_brands_daily(tenant, day);
+
+-- Причина перехода, например отмены заказа
+ALTER TABLE order_status_history ADD COLUMN IF NOT EXISTS reason TEXT;
+
+-- Выборка последних заказов (прогрев кэша, архивация) идет по индексу, а не сортировкой всей таблицы
+CREATE INDEX IF NOT EXISTS idx_orders_date_created ON orders(date_created);
+
+-- Архив старых заказов: индекс всех архивных заказов, сам заказ в data или в файле file
+CREATE SCHEMA IF NOT EXISTS archive;
+
+CREATE TABLE IF NOT EXISTS archive.orders (
+    order_uid VARCHAR(255) PRIMARY KEY,
+    tenant VARCHAR(100) NOT NULL DEFAULT '',
+    date_created TIMESTAMPTZ NOT NULL,
+    archived_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    file TEXT,
+    data JSONB,
+    restored_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_archive_orders_tenant ON archive.orders(tenant, date_created);
+
+-- Персональные данные доставки шифруются (колонки name, phone, email в TEXT переводит migrateColumnTypes),
+-- key_id и dek — ключ данных заказа, зашифрованный ключом key_id (NULL — данные открыты)
+ALTER TABLE delivery ADD COLUMN IF NOT EXISTS key_id VARCHAR(100);
+ALTER TABLE delivery ADD COLUMN IF NOT EXISTS dek BYTEA;
+
+-- Журнал доступа к заказам: кто, когда и какой заказ смотрел или выгружал
+CREATE TABLE IF NOT EXISTS audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    subject VARCHAR(255) NOT NULL,
+    roles TEXT NOT NULL DEFAULT '',
+    method VARCHAR(20) NOT NULL DEFAULT '',
+    action VARCHAR(50) NOT NULL,
+    order_uid VARCHAR(255),
+    tenant VARCHAR(100) NOT NULL DEFAULT '',
+    status INT NOT NULL,
+    ip VARCHAR(64) NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_order ON audit_log(order_uid, at);
+CREATE INDEX IF NOT EXISTS idx_audit_log_subject ON audit_log(subject, at);
@@ -0,0 +1,177 @@
+package postgresql
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// exportBatchSize сколько заказов читается из курсора за один FETCH
+const exportBatchSize = 500
+
+// ExportFilter фильтр выгрузки, пустые поля не ограничивают выборку
+type ExportFilter struct {
+	From, To        time.Time // по date_created, To не включается
+	DeliveryService string
+	Currency        string
+	Status          Status
+	Tenant          *string // nil — все арендаторы, пустая строка — заказы без арендатора
+}
+
+func (f ExportFilter) where() (string, []any) {
+	var (
+		conds []string
+		args  []any
+	)
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, strings.Replace(cond, "?", "$"+strconv.Itoa(len(args)), 1))
+	}
+	if !f.From.IsZero() {
+		add("o.date_created >= ?", f.From)
+	}
+	if !f.To.IsZero() {
+		add("o.date_created < ?", f.To)
+	}
+	if f.DeliveryService != "" {
+		add("o.delivery_service = ?", f.DeliveryService)
+	}
+	if f.Currency != "" {
+		add("p.currency = ?", f.Currency)
+	}
+	if f.Status != "" {
+		add("o.status = ?", f.Status)
+	}
+	if f.Tenant != nil {
+		add("o.tenant = ?", *f.Tenant)
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return "WHERE " + strings.Join(conds, " AND "), args
+}
+
+// ForEachOrder перебирает заказы по фильтру через серверный курсор, в памяти держится одна пачка заказов
+// заказы идут по date_created, статус заполняется без ленты переходов
+func ForEachOrder(ctx context.Context, f ExportFilter, fn func(*FullOrder) error) error {
+	// курсор живет только внутри транзакции, repeatable read дает согласованный снимок на всю выгрузку
+	tx, err := Pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	where, args := f.where()
+	_, err = tx.Exec(ctx, `
+		DECLARE export_orders NO SCROLL CURSOR FOR
+		SELECT o.order_uid, o.track_number, o.entry, o.locale, o.internal_signature, o.customer_id,
+		       o.delivery_service, o.shardkey, o.sm_id, o.date_created, o.oof_shard, o.status,
+		       d.name, d.phone, d.zip, d.city, d.address, d.region, d.email, d.key_id, d.dek,
+		       p.transaction, p.request_id, p.currency, p.provider, p.amount, p.payment_dt, p.bank,
+		       p.delivery_cost, p.goods_total, p.custom_fee
+		FROM orders o
+		JOIN delivery d ON d.order_uid = o.order_uid AND d.date_created = o.date_created
+		JOIN payment p ON p.order_uid = o.order_uid AND p.date_created = o.date_created
+		`+where+`
+		ORDER BY o.date_created, o.order_uid`, args...)
+	if err != nil {
+		return fmt.Errorf("declare export cursor: %w", err)
+	}
+
+	for {
+		batch, err := fetchExportBatch(ctx, tx)
+		if err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := attachItems(ctx, tx, batch); err != nil {
+			return err
+		}
+		for _, o := range batch {
+			if err := o.ApplyCurrency(); err != nil {
+				return fmt.Errorf("export order %s: %w", o.Orders.OrderUID, err)
+			}
+			if err := fn(o); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func fetchExportBatch(ctx context.Context, tx pgx.Tx) ([]*FullOrder, error) {
+	rows, err := tx.Query(ctx, `FETCH `+strconv.Itoa(exportBatchSize)+` FROM export_orders`)
+	if err != nil {
+		return nil, fmt.Errorf("fetch export cursor: %w", err)
+	}
+	defer rows.Close()
+
+	var batch []*FullOrder
+	for rows.Next() {
+		var (
+			o      FullOrder
+			status Status
+			keyID  *string
+			dek    []byte
+		)
+		if err := rows.Scan(&o.Orders.OrderUID, &o.Orders.TrackNumber, &o.Orders.Entry, &o.Orders.Locale,
+			&o.Orders.InternalSignature, &o.Orders.CustomerID, &o.Orders.DeliveryService, &o.Orders.Shardkey,
+			&o.Orders.SmID, &o.Orders.DateCreated, &o.Orders.OofShard, &status,
+			&o.Delivery.Name, &o.Delivery.Phone, &o.Delivery.Zip, &o.Delivery.City, &o.Delivery.Address,
+			&o.Delivery.Region, &o.Delivery.Email, &keyID, &dek,
+			&o.Payment.Transaction, &o.Payment.RequestID, &o.Payment.Currency, &o.Payment.Provider,
+			&o.Payment.Amount, &o.Payment.PaymentDT, &o.Payment.Bank,
+			&o.Payment.DeliveryCost, &o.Payment.GoodsTotal, &o.Payment.CustomFee); err != nil {
+			return nil, fmt.Errorf("fetch export scan: %w", err)
+		}
+		o.Delivery.OrderUID = o.Orders.OrderUID
+		if err := openDeliveryRow(&o.Delivery, keyID, dek); err != nil {
+			return nil, fmt.Errorf("fetch export: %w", err)
+		}
+		o.Payment.OrderUID = o.Orders.OrderUID
+		o.Status = &OrderStatus{Status: status}
+		batch = append(batch, &o)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("fetch export rows error: %w", err)
+	}
+	return batch, nil
+}
+
+// attachItems подгружает товары всей пачки одним запросом
+func attachItems(ctx context.Context, tx pgx.Tx, batch []*FullOrder) error {
+	uids := make([]string, len(batch))
+	byUID := make(map[string]*FullOrder, len(batch))
+	for i, o := range batch {
+		uids[i] = o.Orders.OrderUID
+		byUID[o.Orders.OrderUID] = o
+	}
+	rows, err := tx.Query(ctx, `
+		SELECT order_uid, chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status
+		FROM items WHERE order_uid = ANY($1) AND deleted_at IS NULL
+		ORDER BY order_uid, id`, uids)
+	if err != nil {
+		return fmt.Errorf("export items query: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var i Item
+		if err := rows.Scan(
+			&i.OrderUID, &i.ChrtID, &i.TrackNumber, &i.Price, &i.Rid,
+			&i.Name, &i.Sale, &i.Size, &i.TotalPrice, &i.NmID, &i.Brand, &i.Status,
+		); err != nil {
+			return fmt.Errorf("export items scan: %w", err)
+		}
+		o := byUID[i.OrderUID]
+		o.Items = append(o.Items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("export items rows error: %w", err)
+	}
+	return nil
+}
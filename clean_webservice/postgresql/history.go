@@ -0,0 +1,197 @@
+package postgresql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"wb/pii"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type (
+	// FieldChange изменение одного поля между версиями заказа
+	// поле записывается путем вида payment.amount или items[1111].price (в скобках chrt_id)
+	FieldChange struct {
+		Field string `json:"field"`
+		Old   any    `json:"old"`
+		New   any    `json:"new"`
+	}
+	// OrderVersion одна версия заказа из order_history
+	OrderVersion struct {
+		Version   int             `json:"version"`
+		Source    string          `json:"source"`
+		SourceRef string          `json:"source_ref"`
+		ChangedAt time.Time       `json:"changed_at"`
+		Diff      []FieldChange   `json:"diff"`
+		Order     json.RawMessage `json:"order"`
+	}
+)
+
+// DiffOrders сравнивает две версии заказа по полям, prev == nil значит заказа еще не было
+func DiffOrders(prev, next *FullOrder) ([]FieldChange, error) {
+	prevFields, err := flattenOrder(prev)
+	if err != nil {
+		return nil, err
+	}
+	nextFields, err := flattenOrder(next)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []FieldChange{}
+	for field, newValue := range nextFields {
+		if oldValue, ok := prevFields[field]; !ok || !reflect.DeepEqual(oldValue, newValue) {
+			changes = append(changes, FieldChange{Field: field, Old: oldValue, New: newValue})
+		}
+	}
+	for field, oldValue := range prevFields {
+		if _, ok := nextFields[field]; !ok {
+			changes = append(changes, FieldChange{Field: field, Old: oldValue})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes, nil
+}
+
+// flattenOrder раскладывает заказ в плоскую мапу путь -> значение
+// товары индексируются по chrt_id, а не по позиции, чтобы перестановка не считалась изменением
+func flattenOrder(o *FullOrder) (map[string]any, error) {
+	fields := make(map[string]any)
+	if o == nil {
+		return fields, nil
+	}
+	// из базы время приходит в локальной зоне и с точностью до микросекунд, приводим к одному виду
+	normalized := *o
+	normalized.Orders.DateCreated = o.Orders.DateCreated.UTC().Truncate(time.Microsecond)
+	data, err := json.Marshal(&normalized)
+	if err != nil {
+		return nil, fmt.Errorf("flattenOrder: marshal: %w", err)
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("flattenOrder: unmarshal: %w", err)
+	}
+	items, _ := doc["items"].([]any)
+	delete(doc, "items")
+	flatten(fields, "", doc)
+	for _, item := range items {
+		m, _ := item.(map[string]any)
+		flatten(fields, fmt.Sprintf("items[%v]", m["chrt_id"]), m)
+	}
+	return fields, nil
+}
+
+func flatten(dst map[string]any, prefix string, value any) {
+	m, ok := value.(map[string]any)
+	if !ok {
+		dst[prefix] = value
+		return
+	}
+	for k, v := range m {
+		if prefix != "" {
+			k = prefix + "." + k
+		}
+		flatten(dst, k, v)
+	}
+}
+
+// insertHistory пишет новую версию заказа, если она чем-то отличается от предыдущей, и возвращает diff
+// персональные данные в снимке и изменениях шифруются ключом данных заказа
+func insertHistory(ctx context.Context, tx pgx.Tx, prev, next *FullOrder, src Source, s *pii.Sealer) ([]FieldChange, error) {
+	diff, err := DiffOrders(prev, next)
+	if err != nil {
+		return nil, fmt.Errorf("insert history: %w", err)
+	}
+	if len(diff) == 0 {
+		return nil, nil
+	}
+	orderJSON, err := json.Marshal(next)
+	if err != nil {
+		return nil, fmt.Errorf("insert history: marshal order: %w", err)
+	}
+	sealed := []OrderVersion{{Diff: append([]FieldChange(nil), diff...), Order: orderJSON}}
+	if err := sealVersions(sealed, s); err != nil {
+		return nil, fmt.Errorf("insert history: %w", err)
+	}
+	diffJSON, err := json.Marshal(sealed[0].Diff)
+	if err != nil {
+		return nil, fmt.Errorf("insert history: marshal diff: %w", err)
+	}
+	_, err = tx.Exec(ctx, `
+		INSERT INTO order_history (order_uid, version, source, source_ref, data, diff)
+		SELECT $1, COALESCE(MAX(version), 0) + 1, $2, $3, $4, $5
+		FROM order_history WHERE order_uid=$1`,
+		next.Orders.OrderUID, src.Kind, src.Ref(), []byte(sealed[0].Order), diffJSON)
+	if err != nil {
+		return nil, fmt.Errorf("insert history (order_uid=%s): %w", next.Orders.OrderUID, err)
+	}
+	return diff, nil
+}
+
+// GetOrderHistory возвращает все версии заказа арендатора, от первой к последней
+func GetOrderHistory(ctx context.Context, tenant, orderUID string) ([]OrderVersion, error) {
+	rows, err := Pool.Query(ctx, `
+		SELECT h.version, h.source, h.source_ref, h.changed_at, h.diff, h.data
+		FROM order_history h JOIN orders o ON o.order_uid = h.order_uid
+		WHERE h.order_uid=$1 AND o.tenant=$2
+		ORDER BY h.version`, orderUID, tenant)
+	if err != nil {
+		return nil, fmt.Errorf("getOrderHistory query: %w", err)
+	}
+	versions, err := scanVersions(rows)
+	if err != nil || len(versions) == 0 {
+		return versions, err
+	}
+	env, err := orderEnvelope(ctx, Pool, orderUID)
+	if err != nil {
+		return nil, err
+	}
+	s, _, err := sealerFor(env, false)
+	if err != nil {
+		return nil, fmt.Errorf("getOrderHistory: %w", err)
+	}
+	if err := openVersions(versions, s); err != nil {
+		return nil, fmt.Errorf("getOrderHistory: %w", err)
+	}
+	return versions, nil
+}
+
+// orderHistory все версии заказа без проверки арендатора, для архивации; данные остаются зашифрованными
+func orderHistory(ctx context.Context, q querier, orderUID string) ([]OrderVersion, error) {
+	rows, err := q.Query(ctx, `
+		SELECT version, source, source_ref, changed_at, diff, data
+		FROM order_history WHERE order_uid=$1
+		ORDER BY version`, orderUID)
+	if err != nil {
+		return nil, fmt.Errorf("getOrderHistory query: %w", err)
+	}
+	return scanVersions(rows)
+}
+
+func scanVersions(rows pgx.Rows) ([]OrderVersion, error) {
+	defer rows.Close()
+
+	var versions []OrderVersion
+	for rows.Next() {
+		var (
+			v        OrderVersion
+			diffJSON []byte
+		)
+		if err := rows.Scan(&v.Version, &v.Source, &v.SourceRef, &v.ChangedAt, &diffJSON, &v.Order); err != nil {
+			return nil, fmt.Errorf("getOrderHistory scan: %w", err)
+		}
+		if err := json.Unmarshal(diffJSON, &v.Diff); err != nil {
+			return nil, fmt.Errorf("getOrderHistory diff: %w", err)
+		}
+		versions = append(versions, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("getOrderHistory rows error: %w", err)
+	}
+	return versions, nil
+}
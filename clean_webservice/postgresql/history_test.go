@@ -0,0 +1,101 @@
+package postgresql
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func historyOrder() *FullOrder {
+	return &FullOrder{
+		Orders: Orders{OrderUID: "b563feb7b2b84b6test", TrackNumber: "WBILMTESTTRACK",
+			DateCreated: time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC)},
+		Delivery: Delivery{Name: "Test Testov", City: "Kiryat Mozkin"},
+		Payment: Payment{Currency: "USD", Amount: NewMoney(181700, "USD"), GoodsTotal: NewMoney(31700, "USD"),
+			DeliveryCost: NewMoney(150000, "USD")},
+		Items: []Item{
+			{ChrtID: 1111, Price: NewMoney(45300, "USD"), TotalPrice: NewMoney(31700, "USD"), Name: "Mascaras"},
+			{ChrtID: 2222, Price: NewMoney(10000, "USD"), TotalPrice: NewMoney(10000, "USD"), Name: "Lipstick"},
+		},
+	}
+}
+
+func TestDiffOrders(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(o *FullOrder)
+		want   []FieldChange
+	}{
+		{"unchanged", func(*FullOrder) {}, []FieldChange{}},
+		{"items reordered", func(o *FullOrder) {
+			o.Items[0], o.Items[1] = o.Items[1], o.Items[0]
+		}, []FieldChange{}},
+		{"date_created in other zone", func(o *FullOrder) {
+			o.Orders.DateCreated = o.Orders.DateCreated.In(time.FixedZone("MSK", 3*3600))
+		}, []FieldChange{}},
+		{"same amount with other scale", func(o *FullOrder) {
+			o.Payment.Amount = Money{Minor: 18170000, Scale: 4, Currency: "USD"}
+		}, []FieldChange{}},
+		{"payment amount changed", func(o *FullOrder) {
+			o.Payment.Amount = NewMoney(181750, "USD")
+		}, []FieldChange{{Field: "payment.amount", Old: 1817.0, New: 1817.5}}},
+		{"item price changed", func(o *FullOrder) {
+			o.Items[1].Price = NewMoney(9900, "USD")
+		}, []FieldChange{{Field: "items[2222].price", Old: 100.0, New: 99.0}}},
+		{"item removed", func(o *FullOrder) {
+			o.Items = o.Items[:1]
+		}, []FieldChange{
+			{Field: "items[2222].brand", Old: ""},
+			{Field: "items[2222].chrt_id", Old: 2222.0},
+			{Field: "items[2222].name", Old: "Lipstick"},
+			{Field: "items[2222].nm_id", Old: 0.0},
+			{Field: "items[2222].order_uid", Old: ""},
+			{Field: "items[2222].price", Old: 100.0},
+			{Field: "items[2222].rid", Old: ""},
+			{Field: "items[2222].sale", Old: 0.0},
+			{Field: "items[2222].size", Old: ""},
+			{Field: "items[2222].status", Old: 0.0},
+			{Field: "items[2222].total_price", Old: 100.0},
+			{Field: "items[2222].track_number", Old: ""},
+		}},
+		{"nested field changed", func(o *FullOrder) {
+			o.Delivery.City = "Moscow"
+			o.Orders.TrackNumber = "WBILMTESTTRACK2"
+		}, []FieldChange{
+			{Field: "delivery.city", Old: "Kiryat Mozkin", New: "Moscow"},
+			{Field: "orders.track_number", Old: "WBILMTESTTRACK", New: "WBILMTESTTRACK2"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := historyOrder()
+			tt.modify(next)
+			got, err := DiffOrders(historyOrder(), next)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DiffOrders =\n%v\nwant\n%v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffOrdersNew(t *testing.T) {
+	got, err := DiffOrders(nil, historyOrder())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := make(map[string]bool)
+	for _, c := range got {
+		if c.Old != nil {
+			t.Errorf("new order change %s has old value %v", c.Field, c.Old)
+		}
+		fields[c.Field] = true
+	}
+	for _, f := range []string{"orders.order_uid", "payment.amount", "items[1111].price", "items[2222].name"} {
+		if !fields[f] {
+			t.Errorf("new order diff has no %s", f)
+		}
+	}
+}
@@ -0,0 +1,334 @@
+package postgresql
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Money денежная сумма в минимальных единицах: Minor=1234, Scale=2 это 12.34
+// в json и в базе сумма пишется в основных единицах валюты, как и раньше (1000, 12.34)
+type Money struct {
+	Minor    int64
+	Scale    int
+	Currency string
+}
+
+// MaxMoneyScale больше знаков после запятой в int64 не помещается: 10^19 уже переполняет
+const MaxMoneyScale = 18
+
+var (
+	ErrMoneyOverflow  = errors.New("money overflow")
+	ErrMoneyPrecision = errors.New("money precision loss")
+	ErrMoneyCurrency  = errors.New("money currency mismatch")
+	ErrMoneyScale     = errors.New("money scale out of range")
+	// ErrTotalsMismatch суммы в payment не сходятся с товарами
+	ErrTotalsMismatch = errors.New("payment totals mismatch")
+)
+
+// знаков после запятой у валют, которые отличаются от стандартных двух
+var currencyScales = map[string]int{
+	"JPY": 0, "KRW": 0, "VND": 0, "CLP": 0, "ISK": 0, "UGX": 0,
+	"BHD": 3, "KWD": 3, "JOD": 3, "OMR": 3, "TND": 3, "IQD": 3, "LYD": 3,
+}
+
+// CurrencyScale сколько знаков после запятой у минимальной единицы валюты
+func CurrencyScale(currency string) int {
+	if s, ok := currencyScales[strings.ToUpper(currency)]; ok {
+		return s
+	}
+	return 2
+}
+
+// NewMoney сумма в минимальных единицах валюты (копейки, центы)
+func NewMoney(minor int64, currency string) Money {
+	return Money{Minor: minor, Scale: CurrencyScale(currency), Currency: currency}
+}
+
+// ParseMoney разбирает десятичную строку в основных единицах: "1000", "12.34", "-0.5"
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	intPart, fracPart, _ := strings.Cut(s, ".")
+	neg := strings.HasPrefix(intPart, "-")
+	intPart = strings.TrimPrefix(intPart, "-")
+	if intPart == "" && fracPart == "" || strings.ContainsAny(intPart+fracPart, "+-eE") {
+		return Money{}, fmt.Errorf("parse money %q: invalid decimal", s)
+	}
+	if len(fracPart) > MaxMoneyScale {
+		return Money{}, fmt.Errorf("parse money %q: %w", s, ErrMoneyScale)
+	}
+	digits := intPart + fracPart
+	if digits == "" {
+		digits = "0"
+	}
+	minor, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		if errors.Is(err, strconv.ErrRange) {
+			return Money{}, fmt.Errorf("parse money %q: %w", s, ErrMoneyOverflow)
+		}
+		return Money{}, fmt.Errorf("parse money %q: invalid decimal", s)
+	}
+	if neg {
+		minor = -minor
+	}
+	return Money{Minor: minor, Scale: len(fracPart)}, nil
+}
+
+// pow10 10^n для n от 0 до MaxMoneyScale, границы проверяет вызывающий код
+func pow10(n int) int64 {
+	p := int64(1)
+	for i := 0; i < n; i++ {
+		p *= 10
+	}
+	return p
+}
+
+// Rescale приводит сумму к другому числу знаков, отбрасывать ненулевые знаки нельзя
+func (m Money) Rescale(scale int) (Money, error) {
+	switch {
+	case scale < 0 || scale > MaxMoneyScale || m.Scale < 0 || m.Scale > MaxMoneyScale:
+		return Money{}, fmt.Errorf("rescale %s to %d digits: %w", m, scale, ErrMoneyScale)
+	case scale == m.Scale:
+		return m, nil
+	case scale > m.Scale:
+		mul := pow10(scale - m.Scale)
+		if m.Minor > math.MaxInt64/mul || m.Minor < math.MinInt64/mul {
+			return Money{}, fmt.Errorf("rescale %s: %w", m, ErrMoneyOverflow)
+		}
+		return Money{Minor: m.Minor * mul, Scale: scale, Currency: m.Currency}, nil
+	default:
+		div := pow10(m.Scale - scale)
+		if m.Minor%div != 0 {
+			return Money{}, fmt.Errorf("rescale %s to %d digits: %w", m, scale, ErrMoneyPrecision)
+		}
+		return Money{Minor: m.Minor / div, Scale: scale, Currency: m.Currency}, nil
+	}
+}
+
+// WithCurrency проставляет валюту и приводит сумму к ее минимальным единицам
+func (m Money) WithCurrency(currency string) (Money, error) {
+	r, err := m.Rescale(CurrencyScale(currency))
+	if err != nil {
+		return Money{}, fmt.Errorf("%s: %w", currency, err)
+	}
+	r.Currency = currency
+	return r, nil
+}
+
+// Add складывает суммы одной валюты (пустая валюта совместима с любой)
+func (m Money) Add(o Money) (Money, error) {
+	if m.Currency != "" && o.Currency != "" && m.Currency != o.Currency {
+		return Money{}, fmt.Errorf("add %s %s + %s %s: %w", m, m.Currency, o, o.Currency, ErrMoneyCurrency)
+	}
+	scale := max(m.Scale, o.Scale)
+	a, err := m.Rescale(scale)
+	if err != nil {
+		return Money{}, err
+	}
+	b, err := o.Rescale(scale)
+	if err != nil {
+		return Money{}, err
+	}
+	if (b.Minor > 0 && a.Minor > math.MaxInt64-b.Minor) || (b.Minor < 0 && a.Minor < math.MinInt64-b.Minor) {
+		return Money{}, fmt.Errorf("add %s + %s: %w", m, o, ErrMoneyOverflow)
+	}
+	currency := m.Currency
+	if currency == "" {
+		currency = o.Currency
+	}
+	return Money{Minor: a.Minor + b.Minor, Scale: scale, Currency: currency}, nil
+}
+
+// Div делит сумму на n с округлением до минимальной единицы (половина — от нуля), нужна для среднего чека
+func (m Money) Div(n int64) Money {
+	if n == 0 {
+		return Money{Scale: m.Scale, Currency: m.Currency}
+	}
+	q, r := m.Minor/n, m.Minor%n
+	if absInt64(r)*2 >= absInt64(n) {
+		if (m.Minor < 0) != (n < 0) {
+			q--
+		} else {
+			q++
+		}
+	}
+	return Money{Minor: q, Scale: m.Scale, Currency: m.Currency}
+}
+
+// Cmp сравнивает суммы без учета валюты: -1, 0, 1
+func (m Money) Cmp(o Money) int {
+	scale := max(m.Scale, o.Scale)
+	a, errA := m.Rescale(scale)
+	b, errB := o.Rescale(scale)
+	if errA != nil || errB != nil {
+		// переполнение при выравнивании, сравниваем приближенно
+		return cmpFloat(m.Float64(), o.Float64())
+	}
+	switch {
+	case a.Minor < b.Minor:
+		return -1
+	case a.Minor > b.Minor:
+		return 1
+	}
+	return 0
+}
+
+func cmpFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// Float64 приближенное значение в основных единицах, только для отчетов
+func (m Money) Float64() float64 {
+	return float64(m.Minor) / math.Pow10(m.Scale)
+}
+
+// String сумма в основных единицах со всеми знаками после запятой: 12.30
+func (m Money) String() string {
+	minor := m.Minor
+	sign := ""
+	if minor < 0 {
+		sign = "-"
+	}
+	abs := strconv.FormatUint(uint64(absInt64(minor)), 10)
+	if m.Scale <= 0 {
+		return sign + abs
+	}
+	if len(abs) <= m.Scale {
+		abs = strings.Repeat("0", m.Scale-len(abs)+1) + abs
+	}
+	return sign + abs[:len(abs)-m.Scale] + "." + abs[len(abs)-m.Scale:]
+}
+
+func absInt64(v int64) uint64 {
+	if v < 0 {
+		return uint64(-(v + 1)) + 1
+	}
+	return uint64(v)
+}
+
+// MarshalJSON пишет число в основных единицах без лишних нулей: целые суммы выглядят как раньше (1000)
+func (m Money) MarshalJSON() ([]byte, error) {
+	s := m.String()
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	return []byte(s), nil
+}
+
+// UnmarshalJSON принимает число или строку с десятичной суммой, валюту проставляет ApplyCurrency
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "null" {
+		return nil
+	}
+	parsed, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// Scan читает NUMERIC из базы (pgx отдает его строкой)
+func (m *Money) Scan(src any) error {
+	switch v := src.(type) {
+	case string:
+		parsed, err := ParseMoney(v)
+		if err != nil {
+			return err
+		}
+		*m = parsed
+	case int64:
+		*m = Money{Minor: v}
+	case nil:
+		*m = Money{}
+	default:
+		return fmt.Errorf("scan money: unsupported type %T", src)
+	}
+	return nil
+}
+
+// Value пишет сумму в NUMERIC
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+// MoneyError ошибка в конкретном денежном поле заказа
+type MoneyError struct {
+	Path string
+	Err  error
+}
+
+func (e *MoneyError) Error() string { return e.Path + ": " + e.Err.Error() }
+func (e *MoneyError) Unwrap() error { return e.Err }
+
+type moneyField struct {
+	path string
+	m    *Money
+}
+
+func (o *FullOrder) moneyFields() []moneyField {
+	fields := []moneyField{
+		{"payment.amount", &o.Payment.Amount},
+		{"payment.delivery_cost", &o.Payment.DeliveryCost},
+		{"payment.goods_total", &o.Payment.GoodsTotal},
+		{"payment.custom_fee", &o.Payment.CustomFee},
+	}
+	for i := range o.Items {
+		fields = append(fields,
+			moneyField{fmt.Sprintf("items[%d].price", i), &o.Items[i].Price},
+			moneyField{fmt.Sprintf("items[%d].total_price", i), &o.Items[i].TotalPrice})
+	}
+	return fields
+}
+
+// ApplyCurrency проставляет всем суммам заказа валюту платежа и приводит их к ее минимальным единицам
+// сумма с большим числом знаков, чем есть у валюты (12.345 USD), считается ошибкой
+func (o *FullOrder) ApplyCurrency() error {
+	for _, f := range o.moneyFields() {
+		m, err := f.m.WithCurrency(o.Payment.Currency)
+		if err != nil {
+			return &MoneyError{Path: f.path, Err: err}
+		}
+		*f.m = m
+	}
+	return nil
+}
+
+// ValidateTotals проверяет, что goods_total равен сумме total_price товаров,
+// а amount = goods_total + delivery_cost + custom_fee
+func ValidateTotals(o *FullOrder) error {
+	itemsTotal := Money{Currency: o.Payment.Currency}
+	for i, item := range o.Items {
+		var err error
+		if itemsTotal, err = itemsTotal.Add(item.TotalPrice); err != nil {
+			return &MoneyError{Path: fmt.Sprintf("items[%d].total_price", i), Err: err}
+		}
+	}
+	if itemsTotal.Cmp(o.Payment.GoodsTotal) != 0 {
+		return &MoneyError{Path: "payment.goods_total", Err: fmt.Errorf("%w: goods_total %s, items sum %s",
+			ErrTotalsMismatch, o.Payment.GoodsTotal, itemsTotal)}
+	}
+
+	expected := o.Payment.GoodsTotal
+	for _, m := range []Money{o.Payment.DeliveryCost, o.Payment.CustomFee} {
+		var err error
+		if expected, err = expected.Add(m); err != nil {
+			return &MoneyError{Path: "payment.amount", Err: err}
+		}
+	}
+	if expected.Cmp(o.Payment.Amount) != 0 {
+		return &MoneyError{Path: "payment.amount", Err: fmt.Errorf("%w: amount %s, goods_total+delivery_cost+custom_fee %s",
+			ErrTotalsMismatch, o.Payment.Amount, expected)}
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package postgresql
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Money
+		wantErr error // конкретная причина ошибки
+		err     bool  // любая ошибка разбора
+	}{
+		{in: "1000", want: Money{Minor: 1000}},
+		{in: "12.34", want: Money{Minor: 1234, Scale: 2}},
+		{in: " 12.30 ", want: Money{Minor: 1230, Scale: 2}},
+		{in: "-0.5", want: Money{Minor: -5, Scale: 1}},
+		{in: ".5", want: Money{Minor: 5, Scale: 1}},
+		{in: "7.", want: Money{Minor: 7}},
+		{in: "0.000000000000000001", want: Money{Minor: 1, Scale: 18}},
+		{in: "9223372036854775807", want: Money{Minor: math.MaxInt64}},
+		{in: "-9223372036854775807", want: Money{Minor: -math.MaxInt64}},
+		{in: "9223372036854775808", wantErr: ErrMoneyOverflow},
+		{in: "92233720368547758.08", wantErr: ErrMoneyOverflow},
+		{in: "0.0000000000000000001", wantErr: ErrMoneyScale},
+		{in: "", err: true},
+		{in: "-", err: true},
+		{in: "1e3", err: true},
+		{in: "+1", err: true},
+		{in: "1.-2", err: true},
+		{in: "12,34", err: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseMoney(tt.in)
+		switch {
+		case tt.wantErr != nil:
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ParseMoney(%q) error = %v, want %v", tt.in, err, tt.wantErr)
+			}
+		case tt.err:
+			if err == nil {
+				t.Errorf("ParseMoney(%q) = %v, want error", tt.in, got)
+			}
+		case err != nil:
+			t.Errorf("ParseMoney(%q) error: %v", tt.in, err)
+		case got != tt.want:
+			t.Errorf("ParseMoney(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRescale(t *testing.T) {
+	tests := []struct {
+		m       Money
+		scale   int
+		want    Money
+		wantErr error
+	}{
+		{m: Money{Minor: 1234, Scale: 2}, scale: 2, want: Money{Minor: 1234, Scale: 2}},
+		{m: Money{Minor: 5, Scale: 1, Currency: "USD"}, scale: 2, want: Money{Minor: 50, Scale: 2, Currency: "USD"}},
+		{m: Money{Minor: -5, Scale: 1}, scale: 3, want: Money{Minor: -500, Scale: 3}},
+		{m: Money{Minor: 1200, Scale: 2}, scale: 0, want: Money{Minor: 12}},
+		{m: Money{Minor: -1200, Scale: 2}, scale: 1, want: Money{Minor: -120, Scale: 1}},
+		{m: Money{Minor: 1}, scale: 18, want: Money{Minor: 1e18, Scale: 18}},
+		{m: Money{Minor: 1234, Scale: 2}, scale: 1, wantErr: ErrMoneyPrecision},
+		{m: Money{Minor: -1, Scale: 3}, scale: 2, wantErr: ErrMoneyPrecision},
+		{m: Money{Minor: math.MaxInt64 / 10}, scale: 2, wantErr: ErrMoneyOverflow},
+		{m: Money{Minor: math.MinInt64 / 10}, scale: 2, wantErr: ErrMoneyOverflow},
+		{m: Money{Minor: 10}, scale: 18, wantErr: ErrMoneyOverflow},
+		{m: Money{Minor: 1}, scale: 19, wantErr: ErrMoneyScale},
+		{m: Money{Minor: 1, Scale: 19}, scale: 2, wantErr: ErrMoneyScale},
+		{m: Money{Minor: 1}, scale: -1, wantErr: ErrMoneyScale},
+	}
+	for _, tt := range tests {
+		got, err := tt.m.Rescale(tt.scale)
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("%+v.Rescale(%d) error = %v, want %v", tt.m, tt.scale, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%+v.Rescale(%d) = %+v, %v, want %+v", tt.m, tt.scale, got, err, tt.want)
+		}
+	}
+}
+
+func TestAdd(t *testing.T) {
+	tests := []struct {
+		a, b    Money
+		want    Money
+		wantErr error
+	}{
+		{a: NewMoney(1050, "USD"), b: NewMoney(250, "USD"), want: NewMoney(1300, "USD")},
+		{a: NewMoney(1050, "USD"), b: NewMoney(-2050, "USD"), want: NewMoney(-1000, "USD")},
+		{a: Money{Minor: 5, Scale: 1}, b: Money{Minor: 25, Scale: 2, Currency: "EUR"}, want: Money{Minor: 75, Scale: 2, Currency: "EUR"}},
+		{a: Money{Currency: "RUB", Scale: 2}, b: Money{Minor: 3}, want: Money{Minor: 300, Scale: 2, Currency: "RUB"}},
+		{a: NewMoney(100, "USD"), b: NewMoney(100, "EUR"), wantErr: ErrMoneyCurrency},
+		{a: Money{Minor: math.MaxInt64}, b: Money{Minor: 1}, wantErr: ErrMoneyOverflow},
+		{a: Money{Minor: math.MinInt64}, b: Money{Minor: -1}, wantErr: ErrMoneyOverflow},
+		{a: Money{Minor: math.MaxInt64}, b: Money{Minor: 1, Scale: 1}, wantErr: ErrMoneyOverflow},
+	}
+	for _, tt := range tests {
+		got, err := tt.a.Add(tt.b)
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("%+v.Add(%+v) error = %v, want %v", tt.a, tt.b, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%+v.Add(%+v) = %+v, %v, want %+v", tt.a, tt.b, got, err, tt.want)
+		}
+	}
+}
+
+func TestDiv(t *testing.T) {
+	tests := []struct {
+		m    Money
+		n    int64
+		want int64
+	}{
+		{Money{Minor: 1000, Scale: 2}, 4, 250},
+		{Money{Minor: 1000, Scale: 2}, 3, 333},
+		{Money{Minor: 1001, Scale: 2}, 2, 501}, // половина — от нуля
+		{Money{Minor: 1003, Scale: 2}, 2, 502},
+		{Money{Minor: 2000, Scale: 2}, 3, 667},
+		{Money{Minor: -1001, Scale: 2}, 2, -501},
+		{Money{Minor: -2000, Scale: 2}, 3, -667},
+		{Money{Minor: 1001, Scale: 2}, -2, -501},
+		{Money{Minor: -1001, Scale: 2}, -2, 501},
+		{Money{Minor: math.MaxInt64}, 2, math.MaxInt64/2 + 1},
+		{Money{Minor: math.MinInt64}, 3, math.MinInt64/3 - 1},
+		{Money{Minor: 1234, Scale: 2}, 0, 0},
+	}
+	for _, tt := range tests {
+		got := tt.m.Div(tt.n)
+		if got.Minor != tt.want || got.Scale != tt.m.Scale {
+			t.Errorf("%+v.Div(%d) = %+v, want minor %d", tt.m, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTotals(t *testing.T) {
+	order := func(currency string, amount, delivery, fee int64, items ...int64) *FullOrder {
+		o := &FullOrder{Payment: Payment{
+			Currency:     currency,
+			Amount:       NewMoney(amount, currency),
+			DeliveryCost: NewMoney(delivery, currency),
+			CustomFee:    NewMoney(fee, currency),
+		}}
+		var goods int64
+		for _, total := range items {
+			goods += total
+			o.Items = append(o.Items, Item{TotalPrice: NewMoney(total, currency)})
+		}
+		o.Payment.GoodsTotal = NewMoney(goods, currency)
+		return o
+	}
+	tests := []struct {
+		name     string
+		order    *FullOrder
+		wantErr  error
+		wantPath string
+	}{
+		{name: "ok", order: order("USD", 181750, 150000, 0, 31710, 40)},
+		{name: "no items", order: order("RUB", 500, 500, 0)},
+		{name: "refund line", order: order("USD", 1000, 0, 0, 1500, -500)},
+		{name: "fee counted", order: order("KWD", 1250, 250, 1000)},
+		{
+			name: "goods total mismatch",
+			order: func() *FullOrder {
+				o := order("USD", 1000, 0, 0, 1000)
+				o.Payment.GoodsTotal = NewMoney(999, "USD")
+				o.Payment.Amount = NewMoney(999, "USD")
+				return o
+			}(),
+			wantErr: ErrTotalsMismatch, wantPath: "payment.goods_total",
+		},
+		{name: "amount mismatch", order: order("USD", 1001, 0, 0, 1000), wantErr: ErrTotalsMismatch, wantPath: "payment.amount"},
+		{
+			name: "item in other currency",
+			order: func() *FullOrder {
+				o := order("USD", 1000, 0, 0, 1000)
+				o.Items[0].TotalPrice.Currency = "EUR"
+				return o
+			}(),
+			wantErr: ErrMoneyCurrency, wantPath: "items[0].total_price",
+		},
+		{name: "items overflow", order: order("USD", 0, 0, 0, math.MaxInt64, 1), wantErr: ErrMoneyOverflow, wantPath: "items[1].total_price"},
+		{name: "amount overflow", order: order("USD", 0, math.MaxInt64, 0, 1), wantErr: ErrMoneyOverflow, wantPath: "payment.amount"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateTotals(tt.order)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("ValidateTotals: %v", err)
+				}
+				return
+			}
+			var me *MoneyError
+			if !errors.Is(err, tt.wantErr) || !errors.As(err, &me) || me.Path != tt.wantPath {
+				t.Errorf("ValidateTotals = %v, want %v at %s", err, tt.wantErr, tt.wantPath)
+			}
+		})
+	}
+}
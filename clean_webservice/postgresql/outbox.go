@@ -0,0 +1,155 @@
+package postgresql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	EventOrderCreated = "order.created"
+	EventOrderUpdated = "order.updated"
+)
+
+// OutboxEvent событие, записанное в outbox в одной транзакции с заказом
+type OutboxEvent struct {
+	ID        int64
+	OrderUID  string
+	EventType string
+	Payload   []byte
+	Attempts  int
+}
+
+// OrderEvent событие в топике order-events: контракт с другими командами, а не модель хранения.
+// Поля добавляются сюда только явно, новые колонки заказа, ключи шифрования и персональные данные
+// в событие сами не попадают
+type OrderEvent struct {
+	EventType   string    `json:"event_type"` // order.created или order.updated
+	OrderUID    string    `json:"order_uid"`
+	Tenant      string    `json:"tenant,omitempty"`
+	Status      Status    `json:"status"`
+	DateCreated time.Time `json:"date_created"`
+	OccurredAt  time.Time `json:"occurred_at"`
+	Totals      Totals    `json:"totals"`
+	ItemsCount  int       `json:"items_count"`
+	// пути измененных полей (payment.amount, items[1111].price), только у order.updated; значения не передаются
+	ChangedFields []string `json:"changed_fields,omitempty"`
+}
+
+// Totals суммы заказа, десятичными строками в валюте оплаты
+type Totals struct {
+	Currency     string `json:"currency"`
+	Amount       Money  `json:"amount"`
+	GoodsTotal   Money  `json:"goods_total"`
+	DeliveryCost Money  `json:"delivery_cost"`
+	CustomFee    Money  `json:"custom_fee"`
+}
+
+func insertOutbox(ctx context.Context, tx pgx.Tx, eventType string, order *FullOrder, status Status,
+	diff []FieldChange) error {
+	payload, err := json.Marshal(newOrderEvent(eventType, order, status, diff, time.Now().UTC()))
+	if err != nil {
+		return fmt.Errorf("insert outbox: marshal: %w", err)
+	}
+	_, err = tx.Exec(ctx, `
+		INSERT INTO outbox (order_uid, event_type, payload) VALUES ($1, $2, $3)`,
+		order.Orders.OrderUID, eventType, payload)
+	if err != nil {
+		return fmt.Errorf("insert outbox (order_uid=%s): %w", order.Orders.OrderUID, err)
+	}
+	return nil
+}
+
+// newOrderEvent событие по заказу; из diff берутся только пути полей, старые и новые значения
+// (в том числе персональные данные доставки) в outbox и топик не попадают
+func newOrderEvent(eventType string, order *FullOrder, status Status, diff []FieldChange, at time.Time) OrderEvent {
+	ev := OrderEvent{
+		EventType:   eventType,
+		OrderUID:    order.Orders.OrderUID,
+		Tenant:      order.Tenant,
+		Status:      status,
+		DateCreated: order.Orders.DateCreated.UTC(),
+		OccurredAt:  at,
+		Totals: Totals{
+			Currency:     order.Payment.Currency,
+			Amount:       order.Payment.Amount,
+			GoodsTotal:   order.Payment.GoodsTotal,
+			DeliveryCost: order.Payment.DeliveryCost,
+			CustomFee:    order.Payment.CustomFee,
+		},
+		ItemsCount: len(order.Items),
+	}
+	for _, c := range diff {
+		ev.ChangedFields = append(ev.ChangedFields, c.Field)
+	}
+	return ev
+}
+
+// FetchOutbox берет неотправленные события в порядке записи
+// событие пропускается, если более раннее событие того же заказа еще ждет ретрая, чтобы не нарушить порядок
+// рассчитано на один relay: без блокировок строк, два экземпляра могут отправить событие дважды
+func FetchOutbox(ctx context.Context, limit int) ([]OutboxEvent, error) {
+	rows, err := Pool.Query(ctx, `
+		SELECT o.id, o.order_uid, o.event_type, o.payload, o.attempts
+		FROM outbox o
+		WHERE o.sent_at IS NULL AND o.next_attempt_at <= now()
+		  AND NOT EXISTS (
+			SELECT 1 FROM outbox p
+			WHERE p.order_uid = o.order_uid AND p.sent_at IS NULL AND p.id < o.id AND p.next_attempt_at > now()
+		  )
+		ORDER BY o.id
+		LIMIT $1`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("fetchOutbox query: %w", err)
+	}
+	defer rows.Close()
+
+	var events []OutboxEvent
+	for rows.Next() {
+		var e OutboxEvent
+		if err := rows.Scan(&e.ID, &e.OrderUID, &e.EventType, &e.Payload, &e.Attempts); err != nil {
+			return nil, fmt.Errorf("fetchOutbox scan: %w", err)
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("fetchOutbox rows error: %w", err)
+	}
+	return events, nil
+}
+
+// MarkOutboxSent помечает событие доставленным
+func MarkOutboxSent(ctx context.Context, id int64) error {
+	if _, err := Pool.Exec(ctx, `UPDATE outbox SET sent_at = now() WHERE id=$1`, id); err != nil {
+		return fmt.Errorf("markOutboxSent: %w", err)
+	}
+	return nil
+}
+
+// MarkOutboxFailed откладывает следующую попытку с экспоненциальной задержкой (не больше 5 минут)
+func MarkOutboxFailed(ctx context.Context, id int64, sendErr error) error {
+	_, err := Pool.Exec(ctx, `
+		UPDATE outbox SET
+			attempts = attempts + 1,
+			last_error = $2,
+			next_attempt_at = now() + LEAST(power(2, attempts), 300) * interval '1 second'
+		WHERE id=$1`, id, sendErr.Error())
+	if err != nil {
+		return fmt.Errorf("markOutboxFailed: %w", err)
+	}
+	return nil
+}
+
+// CleanupOutbox удаляет доставленные события старше olderThan
+func CleanupOutbox(ctx context.Context, olderThan time.Duration) (int64, error) {
+	tag, err := Pool.Exec(ctx, `
+		DELETE FROM outbox WHERE sent_at IS NOT NULL AND sent_at < now() - $1 * interval '1 second'`,
+		olderThan.Seconds())
+	if err != nil {
+		return 0, fmt.Errorf("cleanupOutbox: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
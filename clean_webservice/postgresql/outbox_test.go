@@ -0,0 +1,76 @@
+package postgresql
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testEventOrder() *FullOrder {
+	return &FullOrder{
+		Orders: Orders{OrderUID: "b563feb7b2b84b6test", CustomerID: "test",
+			DateCreated: time.Date(2025, 3, 1, 3, 0, 0, 0, time.FixedZone("MSK", 3*3600))},
+		Delivery: Delivery{
+			OrderUID: "b563feb7b2b84b6test",
+			Name:     "Тест Тестов",
+			Phone:    "+9720000000",
+			Email:    "test@gmail.com",
+			Address:  "Ploshad Mira 15",
+			City:     "Kiryat Mozkin",
+		},
+		Payment: Payment{Transaction: "b563feb7b2b84b6test", Currency: "USD", Amount: NewMoney(181700, "USD"),
+			GoodsTotal: NewMoney(31700, "USD"), DeliveryCost: NewMoney(150000, "USD"), CustomFee: NewMoney(0, "USD")},
+		Items:  []Item{{ChrtID: 9934930, Name: "Mascaras", Price: NewMoney(45300, "USD")}},
+		Tenant: "acme",
+	}
+}
+
+func TestOrderEventContract(t *testing.T) {
+	at := time.Date(2025, 3, 2, 10, 0, 0, 0, time.UTC)
+	data, err := json.Marshal(newOrderEvent(EventOrderCreated, testEventOrder(), StatusCreated, nil, at))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"event_type":"order.created","order_uid":"b563feb7b2b84b6test","tenant":"acme","status":"created",` +
+		`"date_created":"2025-03-01T00:00:00Z","occurred_at":"2025-03-02T10:00:00Z",` +
+		`"totals":{"currency":"USD","amount":1817,"goods_total":317,"delivery_cost":1500,"custom_fee":0},` +
+		`"items_count":1}`
+	if string(data) != want {
+		t.Errorf("order.created =\n%s\nwant\n%s", data, want)
+	}
+}
+
+func TestOrderEventHasNoPII(t *testing.T) {
+	diff := []FieldChange{
+		{Field: "delivery.address", Old: "Lenina 1", New: "Ploshad Mira 15"},
+		{Field: "delivery.email", Old: "ivan@mail.ru", New: "test@gmail.com"},
+		{Field: "delivery.name", Old: "Иван Иванов", New: "Тест Тестов"},
+		{Field: "delivery.phone", Old: "+9721111111", New: "+9720000000"},
+		{Field: "items[9934930].price", Old: 400, New: 453},
+	}
+	for _, tt := range []struct {
+		event string
+		diff  []FieldChange
+	}{{EventOrderCreated, nil}, {EventOrderUpdated, diff}} {
+		ev := newOrderEvent(tt.event, testEventOrder(), StatusPaid, tt.diff, time.Now())
+		payload, err := json.Marshal(ev)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, plain := range []string{"Тест", "Иван", "0000000", "1111111", "test@", "ivan@", "Ploshad", "Lenina",
+			"Mascaras", "customer_id"} {
+			if strings.Contains(string(payload), plain) {
+				t.Errorf("%s payload contains %q: %s", tt.event, plain, payload)
+			}
+		}
+		var fields []string
+		for _, c := range tt.diff {
+			fields = append(fields, c.Field)
+		}
+		if !slices.Equal(ev.ChangedFields, fields) {
+			t.Errorf("%s changed_fields = %v, want %v", tt.event, ev.ChangedFields, fields)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// таблицы, секционированные по date_created вместе с orders: у них date_created — копия из заказа,
+// внешний ключ (order_uid, date_created) держит их в той же секции, что и заказ
+var partitionedChildren = []string{"delivery", "payment", "items", "order_status_history"}
+
+const (
+	// PartitionsAhead на сколько месяцев вперед заводятся секции
+	PartitionsAhead = 3
+	// при переносе в секционированные таблицы месяцы старше этого уходят в default секцию
+	partitionsBack = 60
+)
+
+var partitionNameRe = regexp.MustCompile(`^orders_p(\d{4})_(\d{2})$`)
+
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+func partitionName(table string, month time.Time) string {
+	return fmt.Sprintf("%s_p%04d_%02d", table, month.Year(), int(month.Month()))
+}
+
+// createPartition секция месяца для таблицы и всех дочерних; suffix — временный суффикс имен при миграции
+func createPartition(ctx context.Context, tx pgx.Tx, month time.Time, suffix string) error {
+	from, to := month.Format(time.RFC3339), month.AddDate(0, 1, 0).Format(time.RFC3339)
+	for _, table := range append([]string{"orders"}, partitionedChildren...) {
+		_, err := tx.Exec(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s PARTITION OF %s%s FOR VALUES FROM ('%s') TO ('%s')`,
+			partitionName(table, month), table, suffix, from, to))
+		if err != nil {
+			return fmt.Errorf("create partition %s: %w", partitionName(table, month), err)
+		}
+	}
+	return nil
+}
+
+// migratePartitions переносит orders и дочерние таблицы в секционированные по месяцам date_created
+// выполняется один раз, на уже секционированной базе ничего не делает
+func migratePartitions(ctx context.Context) (err error) {
+	var kind string
+	if err := Pool.QueryRow(ctx, `SELECT relkind::text FROM pg_class WHERE oid = 'orders'::regclass`).Scan(&kind); err != nil {
+		return fmt.Errorf("check orders partitioning: %w", err)
+	}
+	if kind == "p" {
+		return nil
+	}
+	log.Println("Migrating orders to partitioned tables")
+	start := time.Now()
+
+	tx, err := Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback(ctx)
+			return
+		}
+		err = tx.Commit(ctx)
+	}()
+
+	exec := func(query string, args ...any) {
+		if err != nil {
+			return
+		}
+		if _, e := tx.Exec(ctx, query, args...); e != nil {
+			err = fmt.Errorf("migrate partitions: %w\nquery: %s", e, query)
+		}
+	}
+
+	exec(`LOCK TABLE orders, delivery, payment, items, order_status_history IN ACCESS EXCLUSIVE MODE`)
+	// последовательности id живут дольше старых таблиц
+	sequences := map[string]string{}
+	for _, table := range []string{"items", "order_status_history"} {
+		var seq *string
+		if err == nil {
+			err = tx.QueryRow(ctx, `SELECT pg_get_serial_sequence($1, 'id')`, table).Scan(&seq)
+		}
+		if seq != nil {
+			sequences[table] = *seq
+			exec(`ALTER SEQUENCE ` + *seq + ` OWNED BY NONE`)
+		}
+	}
+
+	exec(`CREATE TABLE orders_new (LIKE orders INCLUDING DEFAULTS) PARTITION BY RANGE (date_created)`)
+	for _, table := range partitionedChildren {
+		exec(fmt.Sprintf(`CREATE TABLE %[1]s_new (LIKE %[1]s INCLUDING DEFAULTS, date_created TIMESTAMPTZ NOT NULL)
+			PARTITION BY RANGE (date_created)`, table))
+	}
+	if err != nil {
+		return err
+	}
+
+	// секции на каждый месяц с заказами, более старые и далекие даты — в default
+	rows, err := tx.Query(ctx, `SELECT DISTINCT date_trunc('month', date_created AT TIME ZONE 'UTC') FROM orders`)
+	if err != nil {
+		return fmt.Errorf("select order months: %w", err)
+	}
+	months, err := pgx.CollectRows(rows, pgx.RowTo[time.Time])
+	if err != nil {
+		return fmt.Errorf("select order months: %w", err)
+	}
+	now := monthStart(time.Now())
+	for m := -1; m <= PartitionsAhead; m++ {
+		months = append(months, now.AddDate(0, m, 0))
+	}
+	for _, month := range months {
+		month = monthStart(month)
+		if month.Before(now.AddDate(0, -partitionsBack, 0)) || month.After(now.AddDate(0, PartitionsAhead, 0)) {
+			continue
+		}
+		if err = createPartition(ctx, tx, month, "_new"); err != nil {
+			return err
+		}
+	}
+	for _, table := range append([]string{"orders"}, partitionedChildren...) {
+		exec(fmt.Sprintf(`CREATE TABLE %[1]s_default PARTITION OF %[1]s_new DEFAULT`, table))
+	}
+
+	exec(`INSERT INTO orders_new SELECT * FROM orders`)
+	for _, table := range partitionedChildren {
+		exec(fmt.Sprintf(`INSERT INTO %[1]s_new SELECT c.*, o.date_created FROM %[1]s c
+			JOIN orders o ON o.order_uid = c.order_uid`, table))
+	}
+	exec(`DROP TABLE order_status_history, items, payment, delivery, orders`)
+	for _, table := range append([]string{"orders"}, partitionedChildren...) {
+		exec(fmt.Sprintf(`ALTER TABLE %[1]s_new RENAME TO %[1]s`, table))
+	}
+	for table, seq := range sequences {
+		exec(`ALTER SEQUENCE ` + seq + ` OWNED BY ` + table + `.id`)
+	}
+
+	// ключи секционированной таблицы обязаны включать date_created
+	exec(`ALTER TABLE orders ADD PRIMARY KEY (order_uid, date_created)`)
+	exec(`ALTER TABLE delivery ADD PRIMARY KEY (order_uid, date_created)`)
+	exec(`ALTER TABLE payment ADD PRIMARY KEY (order_uid, date_created)`)
+	exec(`ALTER TABLE items ADD PRIMARY KEY (id, date_created)`)
+	exec(`ALTER TABLE order_status_history ADD PRIMARY KEY (id, date_created)`)
+	for _, table := range partitionedChildren {
+		exec(`ALTER TABLE ` + table + ` ADD FOREIGN KEY (order_uid, date_created)
+			REFERENCES orders(order_uid, date_created) ON DELETE CASCADE`)
+	}
+	exec(`CREATE UNIQUE INDEX idx_items_order_chrt ON items(order_uid, chrt_id, date_created)`)
+	exec(`CREATE INDEX idx_order_status_history_order ON order_status_history(order_uid, changed_at)`)
+	exec(`CREATE INDEX idx_payment_dt ON payment(payment_dt)`)
+	exec(`CREATE INDEX idx_orders_tenant ON orders(tenant, date_created)`)
+	exec(`CREATE INDEX idx_orders_date_created ON orders(date_created)`)
+	if err != nil {
+		return err
+	}
+	log.Printf("Orders migrated to partitioned tables in %s", time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// EnsurePartitions заводит секции с прошлого месяца на PartitionsAhead вперед
+// если в default секции уже есть заказы нужного месяца, секция не создается, заказы остаются в default
+func EnsurePartitions(ctx context.Context, now time.Time) error {
+	now = monthStart(now)
+	for m := -1; m <= PartitionsAhead; m++ {
+		month := now.AddDate(0, m, 0)
+		tx, err := Pool.Begin(ctx)
+		if err != nil {
+			return fmt.Errorf("begin transaction: %w", err)
+		}
+		if err := createPartition(ctx, tx, month, ""); err != nil {
+			tx.Rollback(ctx)
+			log.Printf("Warning: %v", err)
+			continue
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return fmt.Errorf("commit partitions: %w", err)
+		}
+	}
+	return nil
+}
+
+// DropPartitionsBefore удаляет пустые секции месяцев, целиком закончившихся до before
+// секции пустеют после архивации, их удаление возвращает место без VACUUM
+func DropPartitionsBefore(ctx context.Context, before time.Time) ([]string, error) {
+	rows, err := Pool.Query(ctx, `
+		SELECT c.relname FROM pg_inherits i JOIN pg_class c ON c.oid = i.inhrelid
+		WHERE i.inhparent = 'orders'::regclass`)
+	if err != nil {
+		return nil, fmt.Errorf("list partitions: %w", err)
+	}
+	names, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("list partitions: %w", err)
+	}
+
+	var dropped []string
+	for _, name := range names {
+		m := partitionNameRe.FindStringSubmatch(name)
+		if m == nil {
+			continue
+		}
+		month, err := time.Parse("2006-01", m[1]+"-"+m[2])
+		if err != nil || month.AddDate(0, 1, 0).After(before) {
+			continue
+		}
+		if err := dropPartition(ctx, month); err != nil {
+			if errors.Is(err, errPartitionNotEmpty) {
+				continue
+			}
+			return dropped, err
+		}
+		dropped = append(dropped, name)
+	}
+	return dropped, nil
+}
+
+var errPartitionNotEmpty = errors.New("partition is not empty")
+
+func dropPartition(ctx context.Context, month time.Time) (err error) {
+	tx, err := Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback(ctx)
+			return
+		}
+		err = tx.Commit(ctx)
+	}()
+
+	orders := partitionName("orders", month)
+	var empty bool
+	if err := tx.QueryRow(ctx, `SELECT NOT EXISTS (SELECT 1 FROM `+orders+`)`).Scan(&empty); err != nil {
+		return fmt.Errorf("check partition %s: %w", orders, err)
+	}
+	if !empty {
+		return errPartitionNotEmpty
+	}
+	// сначала секции дочерних таблиц, они ссылаются на секцию заказов
+	for _, table := range partitionedChildren {
+		if _, err := tx.Exec(ctx, `DROP TABLE IF EXISTS `+partitionName(table, month)); err != nil {
+			return fmt.Errorf("drop partition %s: %w", partitionName(table, month), err)
+		}
+	}
+	if _, err := tx.Exec(ctx, `ALTER TABLE orders DETACH PARTITION `+orders); err != nil {
+		return fmt.Errorf("detach partition %s: %w", orders, err)
+	}
+	if _, err := tx.Exec(ctx, `DROP TABLE `+orders); err != nil {
+		return fmt.Errorf("drop partition %s: %w", orders, err)
+	}
+	return nil
+}
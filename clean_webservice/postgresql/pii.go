@@ -0,0 +1,327 @@
+package postgresql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"wb/pii"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// PII шифрование персональных данных доставки; nil — данные пишутся открытыми, как раньше
+var PII *pii.Cipher
+
+// поля доставки с персональными данными; в истории они лежат по путям delivery.<поле>
+var piiFields = map[string]func(string) string{
+	"name":    pii.MaskName,
+	"phone":   pii.MaskPhone,
+	"email":   pii.MaskEmail,
+	"address": pii.MaskAddress,
+}
+
+func (d *Delivery) piiValues() []*string {
+	return []*string{&d.Name, &d.Phone, &d.Email, &d.Address}
+}
+
+// Masked копия доставки со скрытыми персональными данными
+func (d Delivery) Masked() Delivery {
+	d.Name = pii.MaskName(d.Name)
+	d.Phone = pii.MaskPhone(d.Phone)
+	d.Email = pii.MaskEmail(d.Email)
+	d.Address = pii.MaskAddress(d.Address)
+	return d
+}
+
+func envelope(keyID *string, dek []byte) *pii.Envelope {
+	if keyID == nil {
+		return nil
+	}
+	return &pii.Envelope{KeyID: *keyID, DEK: dek}
+}
+
+// envelopeColumns значения key_id и dek для записи в delivery
+func envelopeColumns(env *pii.Envelope) (*string, []byte) {
+	if env == nil {
+		return nil, nil
+	}
+	return &env.KeyID, env.DEK
+}
+
+// orderEnvelope ключ данных заказа из delivery, nil — данные заказа не зашифрованы или заказа нет
+func orderEnvelope(ctx context.Context, q querier, orderUID string) (*pii.Envelope, error) {
+	var (
+		keyID *string
+		dek   []byte
+	)
+	err := q.QueryRow(ctx, `SELECT key_id, dek FROM delivery WHERE order_uid=$1`, orderUID).Scan(&keyID, &dek)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("select data key (order_uid=%s): %w", orderUID, err)
+	}
+	return envelope(keyID, dek), nil
+}
+
+// sealerFor шифратор данных заказа по его конверту; create — завести новый ключ данных, если у заказа его нет
+// и шифрование включено. Возвращает конверт, который нужно записать вместе с данными
+func sealerFor(env *pii.Envelope, create bool) (*pii.Sealer, *pii.Envelope, error) {
+	if env == nil {
+		if PII == nil || !create {
+			return nil, nil, nil
+		}
+		var err error
+		if env, err = PII.NewEnvelope(); err != nil {
+			return nil, nil, err
+		}
+	}
+	if PII == nil {
+		return nil, nil, fmt.Errorf("data encrypted with key %q, PII_KEY_FILE is not set: %w", env.KeyID, pii.ErrNoKey)
+	}
+	s, err := PII.Sealer(env)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s, env, nil
+}
+
+func sealDelivery(d Delivery, s *pii.Sealer) (Delivery, error) {
+	for _, v := range d.piiValues() {
+		var err error
+		if *v, err = s.Seal(*v); err != nil {
+			return d, fmt.Errorf("seal delivery (order_uid=%s): %w", d.OrderUID, err)
+		}
+	}
+	return d, nil
+}
+
+func openDelivery(d *Delivery, s *pii.Sealer) error {
+	for _, v := range d.piiValues() {
+		var err error
+		if *v, err = s.Open(*v); err != nil {
+			return fmt.Errorf("open delivery (order_uid=%s): %w", d.OrderUID, err)
+		}
+	}
+	return nil
+}
+
+// openDeliveryRow расшифровывает доставку, прочитанную вместе с key_id и dek
+func openDeliveryRow(d *Delivery, keyID *string, dek []byte) error {
+	s, _, err := sealerFor(envelope(keyID, dek), false)
+	if err != nil {
+		return fmt.Errorf("open delivery (order_uid=%s): %w", d.OrderUID, err)
+	}
+	return openDelivery(d, s)
+}
+
+// mapVersionsPII применяет fn к персональным данным в снимках и изменениях истории
+func mapVersionsPII(versions []OrderVersion, fn func(field, v string) (string, error)) error {
+	apply := func(field string, v any) (any, error) {
+		s, ok := v.(string)
+		if !ok {
+			return v, nil
+		}
+		return fn(field, s)
+	}
+	for i := range versions {
+		ver := &versions[i]
+		for j, c := range ver.Diff {
+			field, ok := strings.CutPrefix(c.Field, "delivery.")
+			if _, known := piiFields[field]; !ok || !known {
+				continue
+			}
+			var err error
+			if c.Old, err = apply(field, c.Old); err != nil {
+				return fmt.Errorf("history version %d: %w", ver.Version, err)
+			}
+			if c.New, err = apply(field, c.New); err != nil {
+				return fmt.Errorf("history version %d: %w", ver.Version, err)
+			}
+			ver.Diff[j] = c
+		}
+		if len(ver.Order) == 0 {
+			continue
+		}
+		var doc map[string]json.RawMessage
+		if err := json.Unmarshal(ver.Order, &doc); err != nil {
+			return fmt.Errorf("history version %d: %w", ver.Version, err)
+		}
+		var delivery map[string]any
+		if err := json.Unmarshal(doc["delivery"], &delivery); err != nil || delivery == nil {
+			continue
+		}
+		for field := range piiFields {
+			v, err := apply(field, delivery[field])
+			if err != nil {
+				return fmt.Errorf("history version %d: %w", ver.Version, err)
+			}
+			if v != nil {
+				delivery[field] = v
+			}
+		}
+		var err error
+		if doc["delivery"], err = json.Marshal(delivery); err != nil {
+			return err
+		}
+		if ver.Order, err = json.Marshal(doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MaskHistory скрывает персональные данные в снимках и изменениях истории
+func MaskHistory(versions []OrderVersion) {
+	mapVersionsPII(versions, func(field, v string) (string, error) {
+		return piiFields[field](v), nil
+	})
+}
+
+func sealVersions(versions []OrderVersion, s *pii.Sealer) error {
+	return mapVersionsPII(versions, func(_, v string) (string, error) { return s.Seal(v) })
+}
+
+func openVersions(versions []OrderVersion, s *pii.Sealer) error {
+	return mapVersionsPII(versions, func(_, v string) (string, error) { return s.Open(v) })
+}
+
+// RotatePIIKeys перешифровывает ключи данных заказов текущим ключом и шифрует данные,
+// записанные до включения шифрования, вместе с их историей. Возвращает число обработанных заказов
+func RotatePIIKeys(ctx context.Context, batchSize int) (int, error) {
+	if PII == nil {
+		return 0, fmt.Errorf("PII_KEY_FILE is not set: %w", pii.ErrNoKey)
+	}
+	total := 0
+	for {
+		n, err := rotateBatch(ctx, batchSize)
+		total += n
+		if err != nil || n < batchSize {
+			return total, err
+		}
+	}
+}
+
+func rotateBatch(ctx context.Context, batchSize int) (n int, err error) {
+	tx, err := Pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback(ctx)
+			return
+		}
+		err = tx.Commit(ctx)
+	}()
+
+	rows, err := tx.Query(ctx, `
+		SELECT order_uid, name, phone, email, address, key_id, dek FROM delivery
+		WHERE key_id IS NULL OR key_id <> $1
+		LIMIT $2
+		FOR UPDATE`, PII.CurrentKeyID(), batchSize)
+	if err != nil {
+		return 0, fmt.Errorf("select data keys: %w", err)
+	}
+	type row struct {
+		d     Delivery
+		keyID *string
+		dek   []byte
+	}
+	var batch []row
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.d.OrderUID, &r.d.Name, &r.d.Phone, &r.d.Email, &r.d.Address, &r.keyID, &r.dek); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("select data keys: %w", err)
+		}
+		batch = append(batch, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("select data keys: %w", err)
+	}
+
+	for _, r := range batch {
+		if env := envelope(r.keyID, r.dek); env != nil {
+			rewrapped, _, err := PII.Rewrap(env)
+			if err != nil {
+				return 0, fmt.Errorf("rewrap data key (order_uid=%s): %w", r.d.OrderUID, err)
+			}
+			keyID, dek := envelopeColumns(rewrapped)
+			if _, err := tx.Exec(ctx, `UPDATE delivery SET key_id=$2, dek=$3 WHERE order_uid=$1`,
+				r.d.OrderUID, keyID, dek); err != nil {
+				return 0, fmt.Errorf("update data key (order_uid=%s): %w", r.d.OrderUID, err)
+			}
+			continue
+		}
+		if err := encryptOrder(ctx, tx, r.d); err != nil {
+			return 0, err
+		}
+	}
+	return len(batch), nil
+}
+
+// encryptOrder шифрует открытые данные доставки заказа и его историю новым ключом данных
+func encryptOrder(ctx context.Context, tx pgx.Tx, d Delivery) error {
+	s, env, err := sealerFor(nil, true)
+	if err != nil {
+		return err
+	}
+	sealed, err := sealDelivery(d, s)
+	if err != nil {
+		return err
+	}
+	keyID, dek := envelopeColumns(env)
+	_, err = tx.Exec(ctx, `UPDATE delivery SET name=$2, phone=$3, email=$4, address=$5, key_id=$6, dek=$7
+		WHERE order_uid=$1`, d.OrderUID, sealed.Name, sealed.Phone, sealed.Email, sealed.Address, keyID, dek)
+	if err != nil {
+		return fmt.Errorf("encrypt delivery (order_uid=%s): %w", d.OrderUID, err)
+	}
+
+	rows, err := tx.Query(ctx, `SELECT id, version, data, diff FROM order_history WHERE order_uid=$1`, d.OrderUID)
+	if err != nil {
+		return fmt.Errorf("select history (order_uid=%s): %w", d.OrderUID, err)
+	}
+	var (
+		ids      []int64
+		versions []OrderVersion
+	)
+	for rows.Next() {
+		var (
+			id       int64
+			v        OrderVersion
+			diffJSON []byte
+		)
+		if err := rows.Scan(&id, &v.Version, &v.Order, &diffJSON); err != nil {
+			rows.Close()
+			return fmt.Errorf("select history (order_uid=%s): %w", d.OrderUID, err)
+		}
+		if err := json.Unmarshal(diffJSON, &v.Diff); err != nil {
+			rows.Close()
+			return fmt.Errorf("history diff (order_uid=%s): %w", d.OrderUID, err)
+		}
+		ids, versions = append(ids, id), append(versions, v)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("select history (order_uid=%s): %w", d.OrderUID, err)
+	}
+	if err := sealVersions(versions, s); err != nil {
+		return fmt.Errorf("encrypt history (order_uid=%s): %w", d.OrderUID, err)
+	}
+	for i, v := range versions {
+		diff, err := json.Marshal(v.Diff)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `UPDATE order_history SET data=$2, diff=$3 WHERE id=$1`,
+			ids[i], []byte(v.Order), diff); err != nil {
+			return fmt.Errorf("encrypt history (order_uid=%s): %w", d.OrderUID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package postgresql
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// PaymentRow сумма платежа заказа для отчетов
+type PaymentRow struct {
+	OrderUID  string
+	Amount    Money
+	PaymentDT time.Time
+}
+
+// ForEachPayment перебирает платежи заказов арендатора с payment_dt в [from, to) по порядку времени,
+// без загрузки всех строк в память; limit <= 0 — без ограничения
+func ForEachPayment(ctx context.Context, tenant string, from, to time.Time, limit int, fn func(PaymentRow) error) error {
+	query := `
+		SELECT p.order_uid, p.currency, p.amount, p.payment_dt FROM payment p
+		JOIN orders o ON o.order_uid = p.order_uid AND o.date_created = p.date_created
+		WHERE o.tenant = $1 AND p.payment_dt >= $2 AND p.payment_dt < $3
+		ORDER BY p.payment_dt, p.order_uid`
+	args := []any{tenant, from.Unix(), to.Unix()}
+	if limit > 0 {
+		query += ` LIMIT $4`
+		args = append(args, limit)
+	}
+	rows, err := Pool.Query(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("forEachPayment query: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			p        PaymentRow
+			currency string
+			dt       int64
+		)
+		if err := rows.Scan(&p.OrderUID, &currency, &p.Amount, &dt); err != nil {
+			return fmt.Errorf("forEachPayment scan: %w", err)
+		}
+		if p.Amount, err = p.Amount.WithCurrency(currency); err != nil {
+			return fmt.Errorf("forEachPayment order %s: %w", p.OrderUID, err)
+		}
+		p.PaymentDT = time.Unix(dt, 0).UTC()
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("forEachPayment rows error: %w", err)
+	}
+	return nil
+}
@@ -2,19 +2,34 @@ package postgresql
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"os"
 	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 var (
 	connStr string
 	Pool    *pgxpool.Pool
+	// KeepDeletedItems если true, товары, пропавшие из обновленного заказа, не удаляются,
+	// а помечаются deleted_at и остаются в базе как история
+	KeepDeletedItems bool
+)
+
+var (
+	// ErrDuplicateMessage сообщение с таким id уже было обработано (повторная доставка)
+	ErrDuplicateMessage = errors.New("duplicate message")
+	// ErrStaleOrder в базе уже лежит более новая версия заказа
+	ErrStaleOrder = errors.New("stale order version")
+	// ErrTenantMismatch заказ с таким order_uid принадлежит другому арендатору
+	ErrTenantMismatch = errors.New("order belongs to another tenant")
 )
 
 type (
@@ -47,23 +62,23 @@ type (
 		RequestID    *string `json:"request_id,omitempty"`
 		Currency     string  `json:"currency"`
 		Provider     string  `json:"provider"`
-		Amount       int32   `json:"amount"`
+		Amount       Money   `json:"amount"`
 		PaymentDT    int64   `json:"payment_dt"`
 		Bank         string  `json:"bank"`
-		DeliveryCost int32   `json:"delivery_cost"`
-		GoodsTotal   int32   `json:"goods_total"`
-		CustomFee    int32   `json:"custom_fee"`
+		DeliveryCost Money   `json:"delivery_cost"`
+		GoodsTotal   Money   `json:"goods_total"`
+		CustomFee    Money   `json:"custom_fee"`
 	}
 	Item struct {
 		OrderUID    string `json:"order_uid"`
 		ChrtID      int64  `json:"chrt_id"`
 		TrackNumber string `json:"track_number"`
-		Price       int32  `json:"price"`
+		Price       Money  `json:"price"`
 		Rid         string `json:"rid"`
 		Name        string `json:"name"`
 		Sale        int32  `json:"sale"`
 		Size        string `json:"size"`
-		TotalPrice  int32  `json:"total_price"`
+		TotalPrice  Money  `json:"total_price"`
 		NmID        int64  `json:"nm_id"`
 		Brand       string `json:"brand"`
 		Status      int32  `json:"status"`
@@ -73,6 +88,12 @@ type (
 		Delivery Delivery `json:"delivery"`
 		Payment  Payment  `json:"payment"`
 		Items    []Item   `json:"items"`
+		// статус ведется сервисом по событиям, а не приходит в сообщении заказа
+		Status *OrderStatus `json:"-"`
+		// арендатор определяется источником (топик, заголовок), а не телом сообщения
+		Tenant string `json:"-"`
+		// время последнего изменения заказа или его статуса, для Last-Modified
+		UpdatedAt time.Time `json:"-"`
 	}
 )
 
@@ -98,6 +119,44 @@ func Close() {
 	}
 }
 
+// Ping проверяет, что база отвечает: берет соединение из пула и выполняет пустой запрос
+func Ping(ctx context.Context) error {
+	return Pool.Ping(ctx)
+}
+
+// IsUnavailable ошибка говорит о недоступности базы (нет соединения, таймаут, база перезапускается),
+// а не о проблеме с самими данными: такую операцию имеет смысл повторить позже
+func IsUnavailable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) || pgconn.SafeToRetry(err) || pgconn.Timeout(err) {
+		return true
+	}
+	var connErr *pgconn.ConnectError
+	if errors.As(err, &connErr) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// 08 — ошибки соединения, 53 — нехватка ресурсов, 57P0x — сервер останавливается или перезапускается
+		return strings.HasPrefix(pgErr.Code, "08") || strings.HasPrefix(pgErr.Code, "53") ||
+			strings.HasPrefix(pgErr.Code, "57P0")
+	}
+	return false
+}
+
+// IsTransient конфликт транзакций (40001 serialization_failure, 40P01 deadlock_detected):
+// данные в порядке, повтор той же операции пройдет
+func IsTransient(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && (pgErr.Code == "40001" || pgErr.Code == "40P01")
+}
+
 func readCreateTables() string {
 	data, err := os.ReadFile("postgresql/create_tables.sql")
 	if err != nil {
@@ -117,65 +176,163 @@ func CreateTables(ctx context.Context) error {
 			return fmt.Errorf("exec query #%d failed: %w\nquery: %s", i+1, err, q)
 		}
 	}
+	// типы меняются до перевода на секции, чтобы ALTER не переписывал каждую секцию
+	if err := migrateColumnTypes(ctx); err != nil {
+		return err
+	}
+	if err := migratePartitions(ctx); err != nil {
+		return err
+	}
+	if err := EnsurePartitions(ctx, time.Now()); err != nil {
+		return err
+	}
 	log.Println("All create table queries executed successfully")
 	return nil
 }
 
+// columnTypes колонки, чей тип поменялся после создания таблиц: суммы были INTEGER, который переполнялся
+// и не хранил дробные суммы, а зашифрованные персональные данные длиннее прежних VARCHAR
+var columnTypes = []struct{ table, column, dataType, sqlType string }{
+	{"payment", "amount", "numeric", "NUMERIC(20,4)"},
+	{"payment", "delivery_cost", "numeric", "NUMERIC(20,4)"},
+	{"payment", "goods_total", "numeric", "NUMERIC(20,4)"},
+	{"payment", "custom_fee", "numeric", "NUMERIC(20,4)"},
+	{"items", "price", "numeric", "NUMERIC(20,4)"},
+	{"items", "total_price", "numeric", "NUMERIC(20,4)"},
+	{"delivery", "name", "text", "TEXT"},
+	{"delivery", "phone", "text", "TEXT"},
+	{"delivery", "address", "text", "TEXT"},
+	{"delivery", "email", "text", "TEXT"},
+}
+
+// migrateColumnTypes меняет тип колонки, только если он еще прежний: ALTER TYPE берет эксклюзивную блокировку
+// и может переписать таблицу, поэтому на каждом старте его не выполняем
+func migrateColumnTypes(ctx context.Context) error {
+	for _, c := range columnTypes {
+		var dataType string
+		err := Pool.QueryRow(ctx, `
+			SELECT data_type FROM information_schema.columns
+			WHERE table_schema = current_schema() AND table_name = $1 AND column_name = $2`,
+			c.table, c.column).Scan(&dataType)
+		if err != nil {
+			return fmt.Errorf("column type %s.%s: %w", c.table, c.column, err)
+		}
+		if dataType == c.dataType {
+			continue
+		}
+		log.Printf("Migrating %s.%s from %s to %s", c.table, c.column, dataType, c.sqlType)
+		if _, err := Pool.Exec(ctx, `ALTER TABLE `+c.table+` ALTER COLUMN `+c.column+` TYPE `+c.sqlType); err != nil {
+			return fmt.Errorf("migrate %s.%s to %s: %w", c.table, c.column, c.sqlType, err)
+		}
+	}
+	return nil
+}
+
+// querier общий интерфейс пула и транзакции, чтобы читать заказ и внутри InsertFullOrder
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
 // функция собирает выходную структуру, из мелких функций по таблицам
 func GetFullOrder(ctx context.Context, orderUID string) (*FullOrder, error) {
-	order, err := getOrder(ctx, orderUID)
+	return getFullOrder(ctx, Pool, orderUID)
+}
+
+func getFullOrder(ctx context.Context, q querier, orderUID string) (*FullOrder, error) {
+	order, tenant, err := getOrder(ctx, q, orderUID)
+	if err != nil {
+		return nil, err
+	}
+	delivery, err := getDelivery(ctx, q, orderUID)
+	if err != nil {
+		return nil, err
+	}
+	payment, err := getPayment(ctx, q, orderUID)
 	if err != nil {
 		return nil, err
 	}
-	delivery, err := getDelivery(ctx, orderUID)
+	items, err := getItems(ctx, q, orderUID)
 	if err != nil {
 		return nil, err
 	}
-	payment, err := getPayment(ctx, orderUID)
+	status, err := getOrderStatus(ctx, q, orderUID)
 	if err != nil {
 		return nil, err
 	}
-	items, err := getItems(ctx, orderUID)
+	updatedAt, err := getOrderUpdatedAt(ctx, q, orderUID)
 	if err != nil {
 		return nil, err
 	}
-	return &FullOrder{
-		Orders:   *order,
-		Delivery: *delivery,
-		Payment:  *payment,
-		Items:    items,
-	}, nil
+	full := &FullOrder{
+		Orders:    *order,
+		Delivery:  *delivery,
+		Payment:   *payment,
+		Items:     items,
+		Status:    status,
+		Tenant:    tenant,
+		UpdatedAt: updatedAt,
+	}
+	// NUMERIC приходит с 4 знаками, приводим суммы к минимальным единицам валюты
+	if err := full.ApplyCurrency(); err != nil {
+		return nil, fmt.Errorf("getFullOrder: %w", err)
+	}
+	return full, nil
 }
 
-func getOrder(ctx context.Context, orderUID string) (*Orders, error) {
-	var o Orders
-	err := Pool.QueryRow(ctx, `
+func getOrder(ctx context.Context, q querier, orderUID string) (*Orders, string, error) {
+	var (
+		o      Orders
+		tenant string
+	)
+	err := q.QueryRow(ctx, `
 		SELECT order_uid, track_number, entry, locale, internal_signature, customer_id,
-		       delivery_service, shardkey, sm_id, date_created, oof_shard
+		       delivery_service, shardkey, sm_id, date_created, oof_shard, tenant
 		FROM orders WHERE order_uid=$1`, orderUID).
 		Scan(&o.OrderUID, &o.TrackNumber, &o.Entry, &o.Locale, &o.InternalSignature,
-			&o.CustomerID, &o.DeliveryService, &o.Shardkey, &o.SmID, &o.DateCreated, &o.OofShard)
+			&o.CustomerID, &o.DeliveryService, &o.Shardkey, &o.SmID, &o.DateCreated, &o.OofShard, &tenant)
+	if err != nil {
+		return nil, "", fmt.Errorf("getOrder: %w", err)
+	}
+	return &o, tenant, nil
+}
+
+// getOrderUpdatedAt последнее изменение заказа: новая версия в истории или смена статуса
+func getOrderUpdatedAt(ctx context.Context, q querier, orderUID string) (time.Time, error) {
+	var t time.Time
+	err := q.QueryRow(ctx, `
+		SELECT GREATEST(o.date_created,
+			(SELECT max(changed_at) FROM order_history WHERE order_uid = o.order_uid),
+			(SELECT max(changed_at) FROM order_status_history WHERE order_uid = o.order_uid))
+		FROM orders o WHERE o.order_uid=$1`, orderUID).Scan(&t)
 	if err != nil {
-		return nil, fmt.Errorf("getOrder: %w", err)
+		return t, fmt.Errorf("getOrderUpdatedAt: %w", err)
 	}
-	return &o, nil
+	return t, nil
 }
 
-func getDelivery(ctx context.Context, orderUID string) (*Delivery, error) {
-	var d Delivery
-	err := Pool.QueryRow(ctx, `
-		SELECT order_uid, name, phone, zip, city, address, region, email
+func getDelivery(ctx context.Context, q querier, orderUID string) (*Delivery, error) {
+	var (
+		d     Delivery
+		keyID *string
+		dek   []byte
+	)
+	err := q.QueryRow(ctx, `
+		SELECT order_uid, name, phone, zip, city, address, region, email, key_id, dek
 		FROM delivery WHERE order_uid=$1`, orderUID).
-		Scan(&d.OrderUID, &d.Name, &d.Phone, &d.Zip, &d.City, &d.Address, &d.Region, &d.Email)
+		Scan(&d.OrderUID, &d.Name, &d.Phone, &d.Zip, &d.City, &d.Address, &d.Region, &d.Email, &keyID, &dek)
 	if err != nil {
 		return nil, fmt.Errorf("getDelivery: %w", err)
 	}
+	if err := openDeliveryRow(&d, keyID, dek); err != nil {
+		return nil, fmt.Errorf("getDelivery: %w", err)
+	}
 	return &d, nil
 }
 
-func getPayment(ctx context.Context, orderUID string) (*Payment, error) {
+func getPayment(ctx context.Context, q querier, orderUID string) (*Payment, error) {
 	var p Payment
-	err := Pool.QueryRow(ctx, `
+	err := q.QueryRow(ctx, `
 		SELECT order_uid, transaction, request_id, currency, provider, amount, payment_dt, bank, delivery_cost, goods_total, custom_fee
 		FROM payment WHERE order_uid=$1`, orderUID).
 		Scan(&p.OrderUID, &p.Transaction, &p.RequestID, &p.Currency, &p.Provider,
@@ -186,10 +343,10 @@ func getPayment(ctx context.Context, orderUID string) (*Payment, error) {
 	return &p, nil
 }
 
-func getItems(ctx context.Context, orderUID string) ([]Item, error) {
-	rows, err := Pool.Query(ctx, `
+func getItems(ctx context.Context, q querier, orderUID string) ([]Item, error) {
+	rows, err := q.Query(ctx, `
 		SELECT order_uid, chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status
-		FROM items WHERE order_uid=$1`, orderUID)
+		FROM items WHERE order_uid=$1 AND deleted_at IS NULL`, orderUID)
 	if err != nil {
 		return nil, fmt.Errorf("getItems query: %w", err)
 	}
@@ -218,7 +375,110 @@ func insertOrUpdate(ctx context.Context, tx pgx.Tx, query string, args ...interf
 	return err
 }
 
-func InsertFullOrder(ctx context.Context, order *FullOrder) (err error) {
+// Source откуда пришла версия заказа: сообщение кафки или http запрос пользователя
+type Source struct {
+	Kind      string // kafka, http или import
+	MessageID string // id сообщения кафки, по нему дедупликация, для http пустой
+	Topic     string
+	Partition int32
+	Offset    int64
+	User      string // кто прислал заказ через http
+	Location  string // файл и строка, откуда заказ загружен командой import
+	Replay    bool   // сообщение перечитано командой replay: уже обработанный id не считается дублем
+	Tenant    string // арендатор, от имени которого пришел заказ или событие
+}
+
+// Ref короткое описание источника для истории
+func (s Source) Ref() string {
+	switch s.Kind {
+	case "kafka":
+		return fmt.Sprintf("%s/%d/%d", s.Topic, s.Partition, s.Offset)
+	case "import":
+		return s.Location
+	}
+	return s.User
+}
+
+// checkIdempotency помечает сообщение обработанным и сверяет версию заказа с той, что уже в базе
+// версией считается date_created: более старый заказ, пришедший с опозданием, не должен затереть новый
+// пустой messageID значит, что заказ пришел не из кафки и дедупликация не нужна
+// заказ другого арендатора не перезаписывается: ErrTenantMismatch
+func checkIdempotency(ctx context.Context, tx pgx.Tx, order *FullOrder, src Source) error {
+	if err := markProcessed(ctx, tx, src, order.Orders.OrderUID); err != nil {
+		return err
+	}
+	if err := lockOrder(ctx, tx, order.Orders.OrderUID); err != nil {
+		return err
+	}
+
+	var (
+		current time.Time
+		tenant  string
+	)
+	err := tx.QueryRow(ctx, `SELECT date_created, tenant FROM orders WHERE order_uid=$1 FOR UPDATE`,
+		order.Orders.OrderUID).Scan(&current, &tenant)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("select current version: %w", err)
+	}
+	if tenant != src.Tenant {
+		return fmt.Errorf("order %s: tenant %q: %w", order.Orders.OrderUID, src.Tenant, ErrTenantMismatch)
+	}
+	if order.Orders.DateCreated.Before(current) {
+		return fmt.Errorf("order %s: incoming %s older than stored %s: %w", order.Orders.OrderUID,
+			order.Orders.DateCreated.Format(time.RFC3339), current.Format(time.RFC3339), ErrStaleOrder)
+	}
+	return nil
+}
+
+// lockOrder блокирует order_uid до конца транзакции: в секционированной orders ключ (order_uid, date_created),
+// и одновременную вставку двух версий нового заказа первичный ключ уже не остановит
+func lockOrder(ctx context.Context, tx pgx.Tx, orderUID string) error {
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, orderUID); err != nil {
+		return fmt.Errorf("lock order %s: %w", orderUID, err)
+	}
+	return nil
+}
+
+// PurgeProcessedMessages удаляет id сообщений, обработанных раньше before: такие сообщения уже ушли из топика
+// по его retention и повторно прийти не могут
+func PurgeProcessedMessages(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := Pool.Exec(ctx, `DELETE FROM processed_messages WHERE processed_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("purge processed messages: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// markProcessed запоминает id сообщения, повторная доставка возвращает ErrDuplicateMessage
+// при replay время обработки обновляется, и заказ пишется заново
+func markProcessed(ctx context.Context, tx pgx.Tx, src Source, orderUID string) error {
+	if src.MessageID == "" {
+		return nil
+	}
+	query := `
+		INSERT INTO processed_messages (message_id, order_uid) VALUES ($1, $2)
+		ON CONFLICT (message_id) DO NOTHING`
+	if src.Replay {
+		query = `
+		INSERT INTO processed_messages (message_id, order_uid) VALUES ($1, $2)
+		ON CONFLICT (message_id) DO UPDATE SET processed_at = now()`
+	}
+	tag, err := tx.Exec(ctx, query, src.MessageID, orderUID)
+	if err != nil {
+		return fmt.Errorf("mark message processed: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("message %s: %w", src.MessageID, ErrDuplicateMessage)
+	}
+	return nil
+}
+
+// InsertFullOrder вставляет или обновляет заказ целиком в одной транзакции и пишет версию в историю
+// повторы сообщений и устаревшие версии возвращают ErrDuplicateMessage/ErrStaleOrder
+func InsertFullOrder(ctx context.Context, order *FullOrder, src Source) (err error) {
 
 	log.Printf("InsertFullOrder: start inserting order %s", order.Orders.OrderUID)
 	tx, err := Pool.Begin(ctx)
@@ -243,48 +503,123 @@ func InsertFullOrder(ctx context.Context, order *FullOrder) (err error) {
 		}
 	}()
 
-	err = insertOrUpdate(ctx, tx, `
-		INSERT INTO orders (order_uid, track_number, entry, locale, internal_signature, customer_id,
-			delivery_service, shardkey, sm_id, date_created, oof_shard)
-		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11)
-		ON CONFLICT (order_uid) DO UPDATE SET
-			track_number = EXCLUDED.track_number,
-			entry = EXCLUDED.entry,
-			locale = EXCLUDED.locale,
-			internal_signature = EXCLUDED.internal_signature,
-			customer_id = EXCLUDED.customer_id,
-			delivery_service = EXCLUDED.delivery_service,
-			shardkey = EXCLUDED.shardkey,
-			sm_id = EXCLUDED.sm_id,
-			date_created = EXCLUDED.date_created,
-			oof_shard = EXCLUDED.oof_shard
-	`, order.Orders.OrderUID, order.Orders.TrackNumber, order.Orders.Entry, order.Orders.Locale, order.Orders.InternalSignature,
-		order.Orders.CustomerID, order.Orders.DeliveryService, order.Orders.Shardkey, order.Orders.SmID, order.Orders.DateCreated, order.Orders.OofShard)
+	if err = upsertFullOrder(ctx, tx, order, src); err != nil {
+		return err
+	}
+	log.Printf("InsertFullOrder: finished inserting order %s successfully", order.Orders.OrderUID)
+	return nil
+}
+
+// BatchOrder заказ пачки вместе с источником
+type BatchOrder struct {
+	Order  *FullOrder
+	Source Source
+}
+
+// InsertFullOrders пишет пачку заказов одной транзакцией, каждый заказ в своем savepoint:
+// ошибка одного заказа откатывает только его, ошибки возвращаются по индексам пачки
+// второй результат — ошибка всей пачки (транзакция не началась или не закоммитилась)
+func InsertFullOrders(ctx context.Context, batch []BatchOrder) (errs []error, err error) {
+	tx, err := Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			if rbErr := tx.Rollback(ctx); rbErr != nil {
+				err = fmt.Errorf("rollback error: %v, original error: %w", rbErr, err)
+			}
+			return
+		}
+		err = tx.Commit(ctx)
+	}()
+
+	errs = make([]error, len(batch))
+	for i, b := range batch {
+		sp, err := tx.Begin(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("savepoint: %w", err)
+		}
+		if errs[i] = upsertFullOrder(ctx, sp, b.Order, b.Source); errs[i] != nil {
+			if err := sp.Rollback(ctx); err != nil {
+				return nil, fmt.Errorf("rollback to savepoint: %w", err)
+			}
+			continue
+		}
+		if err := sp.Commit(ctx); err != nil {
+			return nil, fmt.Errorf("release savepoint: %w", err)
+		}
+	}
+	return errs, nil
+}
+
+// upsertFullOrder вставка или обновление заказа внутри уже открытой транзакции
+func upsertFullOrder(ctx context.Context, tx pgx.Tx, order *FullOrder, src Source) error {
+	if err := checkIdempotency(ctx, tx, order, src); err != nil {
+		return err
+	}
+	order.Tenant = src.Tenant
+
+	prev, err := getFullOrder(ctx, tx, order.Orders.OrderUID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		prev, err = nil, nil
+	}
+	if err != nil {
+		return fmt.Errorf("load previous version: %w", err)
+	}
+
+	if prev == nil {
+		err = insertOrUpdate(ctx, tx, `
+			INSERT INTO orders (order_uid, track_number, entry, locale, internal_signature, customer_id,
+				delivery_service, shardkey, sm_id, date_created, oof_shard, tenant)
+			VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12)
+		`, order.Orders.OrderUID, order.Orders.TrackNumber, order.Orders.Entry, order.Orders.Locale, order.Orders.InternalSignature,
+			order.Orders.CustomerID, order.Orders.DeliveryService, order.Orders.Shardkey, order.Orders.SmID, order.Orders.DateCreated, order.Orders.OofShard,
+			src.Tenant)
+	} else {
+		err = updateOrder(ctx, tx, &order.Orders, prev.Orders.DateCreated)
+	}
 	if err != nil {
 		return fmt.Errorf("insert order: %w", err)
 	}
 
+	// персональные данные шифруются ключом данных заказа, у нового заказа он создается
+	env, err := orderEnvelope(ctx, tx, order.Orders.OrderUID)
+	if err != nil {
+		return err
+	}
+	sealer, env, err := sealerFor(env, true)
+	if err != nil {
+		return fmt.Errorf("order %s: %w", order.Orders.OrderUID, err)
+	}
+	delivery, err := sealDelivery(order.Delivery, sealer)
+	if err != nil {
+		return err
+	}
+	keyID, dek := envelopeColumns(env)
 	err = insertOrUpdate(ctx, tx, `
-		INSERT INTO delivery (order_uid, name, phone, zip, city, address, region, email)
-		VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
-		ON CONFLICT (order_uid) DO UPDATE SET
+		INSERT INTO delivery (order_uid, name, phone, zip, city, address, region, email, date_created, key_id, dek)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11)
+		ON CONFLICT (order_uid, date_created) DO UPDATE SET
 			name = EXCLUDED.name,
 			phone = EXCLUDED.phone,
 			zip = EXCLUDED.zip,
 			city = EXCLUDED.city,
 			address = EXCLUDED.address,
 			region = EXCLUDED.region,
-			email = EXCLUDED.email
-	`, order.Delivery.OrderUID, order.Delivery.Name, order.Delivery.Phone, order.Delivery.Zip, order.Delivery.City,
-		order.Delivery.Address, order.Delivery.Region, order.Delivery.Email)
+			email = EXCLUDED.email,
+			key_id = EXCLUDED.key_id,
+			dek = EXCLUDED.dek
+	`, delivery.OrderUID, delivery.Name, delivery.Phone, delivery.Zip, delivery.City,
+		delivery.Address, delivery.Region, delivery.Email, order.Orders.DateCreated, keyID, dek)
 	if err != nil {
 		return fmt.Errorf("insert delivery: %w", err)
 	}
 
 	err = insertOrUpdate(ctx, tx, `
-		INSERT INTO payment (order_uid, transaction, request_id, currency, provider, amount, payment_dt, bank, delivery_cost, goods_total, custom_fee)
-		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11)
-		ON CONFLICT (order_uid) DO UPDATE SET
+		INSERT INTO payment (order_uid, transaction, request_id, currency, provider, amount, payment_dt, bank, delivery_cost, goods_total, custom_fee, date_created)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12)
+		ON CONFLICT (order_uid, date_created) DO UPDATE SET
 			transaction = EXCLUDED.transaction,
 			request_id = EXCLUDED.request_id,
 			currency = EXCLUDED.currency,
@@ -297,7 +632,7 @@ func InsertFullOrder(ctx context.Context, order *FullOrder) (err error) {
 			custom_fee = EXCLUDED.custom_fee
 	`, order.Payment.OrderUID, order.Payment.Transaction, order.Payment.RequestID, order.Payment.Currency,
 		order.Payment.Provider, order.Payment.Amount, order.Payment.PaymentDT, order.Payment.Bank,
-		order.Payment.DeliveryCost, order.Payment.GoodsTotal, order.Payment.CustomFee)
+		order.Payment.DeliveryCost, order.Payment.GoodsTotal, order.Payment.CustomFee, order.Orders.DateCreated)
 	if err != nil {
 		return fmt.Errorf("insert payment: %w", err)
 	}
@@ -305,11 +640,11 @@ func InsertFullOrder(ctx context.Context, order *FullOrder) (err error) {
 	for _, item := range order.Items {
 		err = insertOrUpdate(ctx, tx, `
 			INSERT INTO items (
-				order_uid, chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status
+				order_uid, chrt_id, track_number, price, rid, name, sale, size, total_price, nm_id, brand, status, date_created
 			) VALUES (
-				$1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12
+				$1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13
 			)
-			ON CONFLICT (order_uid, chrt_id) DO UPDATE SET
+			ON CONFLICT (order_uid, chrt_id, date_created) DO UPDATE SET
 				track_number = EXCLUDED.track_number,
 				price = EXCLUDED.price,
 				rid = EXCLUDED.rid,
@@ -319,14 +654,86 @@ func InsertFullOrder(ctx context.Context, order *FullOrder) (err error) {
 				total_price = EXCLUDED.total_price,
 				nm_id = EXCLUDED.nm_id,
 				brand = EXCLUDED.brand,
-				status = EXCLUDED.status
+				status = EXCLUDED.status,
+				deleted_at = NULL
 		`, item.OrderUID, item.ChrtID, item.TrackNumber, item.Price, item.Rid, item.Name,
-			item.Sale, item.Size, item.TotalPrice, item.NmID, item.Brand, item.Status)
+			item.Sale, item.Size, item.TotalPrice, item.NmID, item.Brand, item.Status, order.Orders.DateCreated)
 		if err != nil {
 			return fmt.Errorf("insert item (order_uid=%s, chrt_id=%d): %w", item.OrderUID, item.ChrtID, err)
 		}
 	}
 
-	log.Printf("InsertFullOrder: finished inserting order %s successfully", order.Orders.OrderUID)
+	if err = removeMissingItems(ctx, tx, order); err != nil {
+		return err
+	}
+
+	diff, err := insertHistory(ctx, tx, prev, order, src, sealer)
+	if err != nil {
+		return err
+	}
+
+	if prev == nil {
+		// новый заказ стартует в created, фиксируем это в ленте статусов
+		if err = insertStatusChange(ctx, tx, order.Orders.OrderUID, nil, nil, StatusCreated, time.Now(), "", src); err != nil {
+			return err
+		}
+		err = insertOutbox(ctx, tx, EventOrderCreated, order, StatusCreated, nil)
+	} else if len(diff) > 0 {
+		err = insertOutbox(ctx, tx, EventOrderUpdated, order, prev.Status.Status, diff)
+	}
+	return err
+}
+
+// updateOrder обновляет заказ; date_created входит в ключ секционированной orders, и при ее смене
+// строка заказа вставляется заново, дочерние строки переезжают на нее, а старая удаляется:
+// обновление ключа через секции в Postgres 14 удаляет и вставляет строку, и каскад снес бы дочерние строки
+func updateOrder(ctx context.Context, tx pgx.Tx, o *Orders, prevCreated time.Time) error {
+	if o.DateCreated.Equal(prevCreated) {
+		_, err := tx.Exec(ctx, `
+			UPDATE orders SET track_number=$2, entry=$3, locale=$4, internal_signature=$5, customer_id=$6,
+				delivery_service=$7, shardkey=$8, sm_id=$9, oof_shard=$10
+			WHERE order_uid=$1`, o.OrderUID, o.TrackNumber, o.Entry, o.Locale, o.InternalSignature,
+			o.CustomerID, o.DeliveryService, o.Shardkey, o.SmID, o.OofShard)
+		return err
+	}
+	_, err := tx.Exec(ctx, `
+		INSERT INTO orders (order_uid, track_number, entry, locale, internal_signature, customer_id,
+			delivery_service, shardkey, sm_id, date_created, oof_shard, tenant, status)
+		SELECT $1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11, tenant, status
+		FROM orders WHERE order_uid=$1 AND date_created=$12`, o.OrderUID, o.TrackNumber, o.Entry, o.Locale,
+		o.InternalSignature, o.CustomerID, o.DeliveryService, o.Shardkey, o.SmID, o.DateCreated, o.OofShard, prevCreated)
+	if err != nil {
+		return err
+	}
+	for _, table := range partitionedChildren {
+		_, err := tx.Exec(ctx, `UPDATE `+table+` SET date_created=$2 WHERE order_uid=$1 AND date_created=$3`,
+			o.OrderUID, o.DateCreated, prevCreated)
+		if err != nil {
+			return fmt.Errorf("move %s: %w", table, err)
+		}
+	}
+	_, err = tx.Exec(ctx, `DELETE FROM orders WHERE order_uid=$1 AND date_created=$2`, o.OrderUID, prevCreated)
+	return err
+}
+
+// removeMissingItems убирает товары, которых нет в новой версии заказа
+// набор товаров в сообщении считается полным, поэтому все остальные chrt_id заказа лишние
+func removeMissingItems(ctx context.Context, tx pgx.Tx, order *FullOrder) error {
+	chrtIDs := make([]int64, 0, len(order.Items))
+	for _, item := range order.Items {
+		chrtIDs = append(chrtIDs, item.ChrtID)
+	}
+	query := `DELETE FROM items WHERE order_uid=$1 AND NOT (chrt_id = ANY($2))`
+	if KeepDeletedItems {
+		query = `UPDATE items SET deleted_at = now()
+			WHERE order_uid=$1 AND NOT (chrt_id = ANY($2)) AND deleted_at IS NULL`
+	}
+	tag, err := tx.Exec(ctx, query, order.Orders.OrderUID, chrtIDs)
+	if err != nil {
+		return fmt.Errorf("remove missing items (order_uid=%s): %w", order.Orders.OrderUID, err)
+	}
+	if tag.RowsAffected() > 0 {
+		log.Printf("InsertFullOrder: removed %d items missing from order %s", tag.RowsAffected(), order.Orders.OrderUID)
+	}
 	return nil
 }
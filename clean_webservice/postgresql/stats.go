@@ -0,0 +1,116 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrUnknownDimension нет такой группировки для статистики
+var ErrUnknownDimension = errors.New("unknown stats dimension")
+
+// StatsRow агрегат по одному значению группировки в одной валюте, суммы разных валют не складываются
+type StatsRow struct {
+	Key      string `json:"key"`
+	Currency string `json:"currency"`
+	Orders   int64  `json:"orders"`
+	Revenue  Money  `json:"revenue"`
+	AvgCheck Money  `json:"avg_check"`
+}
+
+// statsDimensions группировка -> витрина и выражение для ключа; пользовательский ввод в sql не попадает
+var statsDimensions = map[string]struct{ table, key string }{
+	"total":            {"stats_orders_daily", "'total'"},
+	"day":              {"stats_orders_daily", "to_char(day, 'YYYY-MM-DD')"},
+	"week":             {"stats_orders_daily", "to_char(date_trunc('week', day), 'YYYY-MM-DD')"},
+	"delivery_service": {"stats_orders_daily", "delivery_service"},
+	"provider":         {"stats_orders_daily", "provider"},
+	"bank":             {"stats_orders_daily", "bank"},
+	"region":           {"stats_orders_daily", "region"},
+	"brand":            {"stats_brands_daily", "brand"},
+}
+
+// RefreshStats пересчитывает витрины целиком в одной транзакции, читатели до коммита видят старые данные
+// у бренда выручка — сумма total_price его товаров, заказ с товарами нескольких брендов считается в каждом
+func RefreshStats(ctx context.Context) (err error) {
+	tx, err := Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			if rbErr := tx.Rollback(ctx); rbErr != nil {
+				err = fmt.Errorf("rollback error: %v, original error: %w", rbErr, err)
+			}
+			return
+		}
+		err = tx.Commit(ctx)
+	}()
+
+	queries := []string{
+		`DELETE FROM stats_orders_daily`,
+		`INSERT INTO stats_orders_daily (tenant, day, currency, delivery_service, provider, bank, region, orders, revenue)
+		SELECT o.tenant, (o.date_created AT TIME ZONE 'UTC')::date, p.currency, o.delivery_service, p.provider, p.bank,
+			d.region, COUNT(*), SUM(p.amount)
+		FROM orders o
+		JOIN payment p ON p.order_uid = o.order_uid AND p.date_created = o.date_created
+		JOIN delivery d ON d.order_uid = o.order_uid AND d.date_created = o.date_created
+		GROUP BY 1, 2, 3, 4, 5, 6, 7`,
+		`DELETE FROM stats_brands_daily`,
+		`INSERT INTO stats_brands_daily (tenant, day, currency, brand, orders, revenue)
+		SELECT o.tenant, (o.date_created AT TIME ZONE 'UTC')::date, p.currency, i.brand,
+			COUNT(DISTINCT i.order_uid), SUM(i.total_price)
+		FROM items i
+		JOIN orders o ON o.order_uid = i.order_uid AND o.date_created = i.date_created
+		JOIN payment p ON p.order_uid = i.order_uid AND p.date_created = i.date_created
+		WHERE i.deleted_at IS NULL
+		GROUP BY 1, 2, 3, 4`,
+	}
+	for _, q := range queries {
+		if _, err = tx.Exec(ctx, q); err != nil {
+			return fmt.Errorf("refresh stats: %w", err)
+		}
+	}
+	return nil
+}
+
+// GetStats агрегаты заказов арендатора за дни [from, to) по группировке dimension: day, week, delivery_service,
+// provider, bank, region, brand; refreshedAt — время последнего пересчета витрины, nil если она еще пустая
+func GetStats(ctx context.Context, tenant, dimension string, from, to time.Time) (rows []StatsRow, refreshedAt *time.Time, err error) {
+	dim, ok := statsDimensions[dimension]
+	if !ok {
+		return nil, nil, fmt.Errorf("%q: %w", dimension, ErrUnknownDimension)
+	}
+	if err := Pool.QueryRow(ctx, `SELECT MAX(refreshed_at) FROM `+dim.table).Scan(&refreshedAt); err != nil {
+		return nil, nil, fmt.Errorf("getStats refreshed_at: %w", err)
+	}
+
+	r, err := Pool.Query(ctx, `
+		SELECT `+dim.key+`, currency, SUM(orders), SUM(revenue)
+		FROM `+dim.table+`
+		WHERE tenant = $1 AND day >= $2 AND day < $3
+		GROUP BY 1, 2
+		ORDER BY 1, 2`, tenant, from, to)
+	if err != nil {
+		return nil, nil, fmt.Errorf("getStats query: %w", err)
+	}
+	defer r.Close()
+	rows = []StatsRow{}
+	for r.Next() {
+		var s StatsRow
+		if err := r.Scan(&s.Key, &s.Currency, &s.Orders, &s.Revenue); err != nil {
+			return nil, nil, fmt.Errorf("getStats scan: %w", err)
+		}
+		// у NUMERIC(24,4) всегда 4 знака, хвостовые нули отбрасываются по шкале валюты
+		if s.Revenue, err = s.Revenue.WithCurrency(s.Currency); err != nil {
+			return nil, nil, fmt.Errorf("getStats %s/%s: %w", s.Key, s.Currency, err)
+		}
+		s.AvgCheck = s.Revenue.Div(s.Orders)
+		rows = append(rows, s)
+	}
+	if err := r.Err(); err != nil {
+		return nil, nil, fmt.Errorf("getStats rows error: %w", err)
+	}
+	return rows, refreshedAt, nil
+}
@@ -0,0 +1,215 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Status статус жизненного цикла заказа или отдельного товара
+type Status string
+
+const (
+	StatusCreated   Status = "created"
+	StatusPaid      Status = "paid"
+	StatusShipped   Status = "shipped"
+	StatusDelivered Status = "delivered"
+	StatusCancelled Status = "cancelled"
+	StatusReturned  Status = "returned"
+)
+
+var (
+	// ErrInvalidTransition переход между статусами не разрешен
+	ErrInvalidTransition = errors.New("invalid status transition")
+	// ErrOrderNotFound заказа или товара из события нет в базе (или товар удален)
+	ErrOrderNotFound = errors.New("order not found")
+)
+
+// разрешенные переходы, cancelled и returned конечные
+var transitions = map[Status][]Status{
+	StatusCreated:   {StatusPaid, StatusCancelled},
+	StatusPaid:      {StatusShipped, StatusCancelled},
+	StatusShipped:   {StatusDelivered, StatusReturned},
+	StatusDelivered: {StatusReturned},
+}
+
+// Valid известен ли такой статус
+func (s Status) Valid() bool {
+	switch s {
+	case StatusCreated, StatusPaid, StatusShipped, StatusDelivered, StatusCancelled, StatusReturned:
+		return true
+	}
+	return false
+}
+
+// CanTransitionTo можно ли перейти из s в next
+func (s Status) CanTransitionTo(next Status) bool {
+	for _, allowed := range transitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+type (
+	// StatusEvent событие смены статуса из топика статусов
+	// если ChrtID задан, меняется статус одного товара, иначе всего заказа
+	StatusEvent struct {
+		OrderUID  string    `json:"order_uid"`
+		ChrtID    *int64    `json:"chrt_id,omitempty"`
+		Status    Status    `json:"status"`
+		ChangedAt time.Time `json:"changed_at,omitempty"` // не задано — время обработки события
+		Reason    string    `json:"reason,omitempty"`
+	}
+	// StatusChange запись в ленте смены статусов
+	StatusChange struct {
+		ChrtID    *int64    `json:"chrt_id,omitempty"`
+		From      *Status   `json:"from,omitempty"`
+		To        Status    `json:"to"`
+		ChangedAt time.Time `json:"changed_at"`
+		Source    string    `json:"source"`
+		Reason    *string   `json:"reason,omitempty"`
+	}
+	// OrderStatus текущий статус заказа, статусы товаров и лента переходов
+	OrderStatus struct {
+		Status   Status           `json:"status"`
+		Items    map[int64]Status `json:"items"`
+		Timeline []StatusChange   `json:"timeline"`
+	}
+)
+
+// ApplyStatusChange проверяет переход по state machine и записывает новый статус вместе с временем перехода
+// повтор того же статуса ничего не меняет, запрещенный переход возвращает ErrInvalidTransition,
+// событие для заказа другого арендатора — ErrTenantMismatch, для неизвестного заказа или товара — ErrOrderNotFound
+func ApplyStatusChange(ctx context.Context, ev StatusEvent, src Source) (err error) {
+	if !ev.Status.Valid() {
+		return fmt.Errorf("unknown status %q: %w", ev.Status, ErrInvalidTransition)
+	}
+	if ev.ChangedAt.IsZero() {
+		ev.ChangedAt = time.Now()
+	}
+
+	tx, err := Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			if rbErr := tx.Rollback(ctx); rbErr != nil {
+				err = fmt.Errorf("rollback error: %v, original error: %w", rbErr, err)
+			}
+			return
+		}
+		err = tx.Commit(ctx)
+	}()
+
+	if err = markProcessed(ctx, tx, src, ev.OrderUID); err != nil {
+		return err
+	}
+
+	var (
+		current Status
+		tenant  string
+	)
+	if ev.ChrtID == nil {
+		err = tx.QueryRow(ctx, `SELECT status, tenant FROM orders WHERE order_uid=$1 FOR UPDATE`,
+			ev.OrderUID).Scan(&current, &tenant)
+	} else {
+		err = tx.QueryRow(ctx, `
+			SELECT i.lifecycle_status, o.tenant FROM items i JOIN orders o ON o.order_uid = i.order_uid
+			WHERE i.order_uid=$1 AND i.chrt_id=$2 AND i.deleted_at IS NULL FOR UPDATE OF i`,
+			ev.OrderUID, *ev.ChrtID).Scan(&current, &tenant)
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		if ev.ChrtID != nil {
+			return fmt.Errorf("order %s item %d: %w", ev.OrderUID, *ev.ChrtID, ErrOrderNotFound)
+		}
+		return fmt.Errorf("order %s: %w", ev.OrderUID, ErrOrderNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("select current status (order_uid=%s): %w", ev.OrderUID, err)
+	}
+	if tenant != src.Tenant {
+		return fmt.Errorf("order %s: tenant %q: %w", ev.OrderUID, src.Tenant, ErrTenantMismatch)
+	}
+	if current == ev.Status {
+		return nil
+	}
+	if !current.CanTransitionTo(ev.Status) {
+		return fmt.Errorf("order %s: %s -> %s: %w", ev.OrderUID, current, ev.Status, ErrInvalidTransition)
+	}
+
+	if ev.ChrtID == nil {
+		_, err = tx.Exec(ctx, `UPDATE orders SET status=$2 WHERE order_uid=$1`, ev.OrderUID, ev.Status)
+	} else {
+		_, err = tx.Exec(ctx, `UPDATE items SET lifecycle_status=$3 WHERE order_uid=$1 AND chrt_id=$2`,
+			ev.OrderUID, *ev.ChrtID, ev.Status)
+	}
+	if err != nil {
+		return fmt.Errorf("update status (order_uid=%s): %w", ev.OrderUID, err)
+	}
+	return insertStatusChange(ctx, tx, ev.OrderUID, ev.ChrtID, &current, ev.Status, ev.ChangedAt, ev.Reason, src)
+}
+
+func insertStatusChange(ctx context.Context, tx pgx.Tx, orderUID string, chrtID *int64, from *Status, to Status,
+	changedAt time.Time, reason string, src Source) error {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO order_status_history (order_uid, chrt_id, from_status, to_status, changed_at, source, reason, date_created)
+		SELECT $1,$2,$3,$4,$5,$6,NULLIF($7, ''), date_created FROM orders WHERE order_uid=$1`, orderUID, chrtID, from, to, changedAt, src.Kind+":"+src.Ref(), reason)
+	if err != nil {
+		return fmt.Errorf("insert status change (order_uid=%s): %w", orderUID, err)
+	}
+	return nil
+}
+
+func getOrderStatus(ctx context.Context, q querier, orderUID string) (*OrderStatus, error) {
+	st := &OrderStatus{Items: make(map[int64]Status), Timeline: []StatusChange{}}
+	if err := q.QueryRow(ctx, `SELECT status FROM orders WHERE order_uid=$1`, orderUID).Scan(&st.Status); err != nil {
+		return nil, fmt.Errorf("getOrderStatus: %w", err)
+	}
+
+	rows, err := q.Query(ctx, `
+		SELECT chrt_id, lifecycle_status FROM items WHERE order_uid=$1 AND deleted_at IS NULL`, orderUID)
+	if err != nil {
+		return nil, fmt.Errorf("getOrderStatus items query: %w", err)
+	}
+	for rows.Next() {
+		var (
+			chrtID int64
+			status Status
+		)
+		if err := rows.Scan(&chrtID, &status); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("getOrderStatus items scan: %w", err)
+		}
+		st.Items[chrtID] = status
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("getOrderStatus items rows error: %w", err)
+	}
+
+	rows, err = q.Query(ctx, `
+		SELECT chrt_id, from_status, to_status, changed_at, source, reason
+		FROM order_status_history WHERE order_uid=$1
+		ORDER BY changed_at, id`, orderUID)
+	if err != nil {
+		return nil, fmt.Errorf("getOrderStatus timeline query: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c StatusChange
+		if err := rows.Scan(&c.ChrtID, &c.From, &c.To, &c.ChangedAt, &c.Source, &c.Reason); err != nil {
+			return nil, fmt.Errorf("getOrderStatus timeline scan: %w", err)
+		}
+		st.Timeline = append(st.Timeline, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("getOrderStatus timeline rows error: %w", err)
+	}
+	return st, nil
+}
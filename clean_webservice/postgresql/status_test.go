@@ -0,0 +1,48 @@
+package postgresql
+
+import "testing"
+
+func TestCanTransitionTo(t *testing.T) {
+	all := []Status{StatusCreated, StatusPaid, StatusShipped, StatusDelivered, StatusCancelled, StatusReturned}
+	allowed := map[[2]Status]bool{
+		{StatusCreated, StatusPaid}:       true,
+		{StatusCreated, StatusCancelled}:  true,
+		{StatusPaid, StatusShipped}:       true,
+		{StatusPaid, StatusCancelled}:     true,
+		{StatusShipped, StatusDelivered}:  true,
+		{StatusShipped, StatusReturned}:   true,
+		{StatusDelivered, StatusReturned}: true,
+	}
+	// каждая пара статусов: разрешены только переходы из таблицы, из cancelled и returned — никуда,
+	// тот же статус переходом не считается (ApplyStatusChange обрабатывает его как повтор до проверки)
+	for _, from := range all {
+		for _, to := range all {
+			want := allowed[[2]Status{from, to}]
+			if got := from.CanTransitionTo(to); got != want {
+				t.Errorf("%s.CanTransitionTo(%s) = %v, want %v", from, to, got, want)
+			}
+		}
+	}
+	for _, terminal := range []Status{StatusCancelled, StatusReturned} {
+		if len(transitions[terminal]) != 0 {
+			t.Errorf("%s must be terminal, has %v", terminal, transitions[terminal])
+		}
+	}
+
+	unknown := []Status{"", "lost", "Created", "PAID"}
+	for _, s := range unknown {
+		if s.Valid() {
+			t.Errorf("Status(%q).Valid() = true", s)
+		}
+		for _, known := range all {
+			if s.CanTransitionTo(known) || known.CanTransitionTo(s) {
+				t.Errorf("transition between %q and %s allowed", s, known)
+			}
+		}
+	}
+	for _, s := range all {
+		if !s.Valid() {
+			t.Errorf("%s.Valid() = false", s)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	db "wb/postgresql"
+)
+
+// GenConfig параметры генерации заказов
+type GenConfig struct {
+	MinItems, MaxItems int
+	Currencies         []string
+	Locales            []string
+	InvalidRatio       float64       // доля заведомо битых сообщений, 0..1
+	Spread             time.Duration // date_created равномерно в [now-Spread, now]
+}
+
+// Generator детерминированный при одинаковом seed генератор заказов
+type Generator struct {
+	rnd *rand.Rand
+	cfg GenConfig
+	seq int64
+}
+
+func NewGenerator(seed int64, cfg GenConfig) *Generator {
+	return &Generator{rnd: rand.New(rand.NewSource(seed)), cfg: cfg}
+}
+
+// город, регион, телефонный код и почтовый индекс по локали
+type place struct {
+	city, region, phone, zip string
+}
+
+var (
+	places = map[string][]place{
+		"ru": {{"Moscow", "Moscow Region", "+7", "101000"}, {"Saint Petersburg", "Leningrad Region", "+7", "190000"},
+			{"Kazan", "Tatarstan", "+7", "420000"}, {"Novosibirsk", "Novosibirsk Region", "+7", "630000"}},
+		"en": {{"New York", "NY", "+1", "10001"}, {"Austin", "TX", "+1", "73301"}, {"London", "Greater London", "+44", "EC1A"},
+			{"Seattle", "WA", "+1", "98101"}},
+		"kz": {{"Almaty", "Almaty Region", "+7", "050000"}, {"Astana", "Akmola Region", "+7", "010000"}},
+		"de": {{"Berlin", "Berlin", "+49", "10115"}, {"Munich", "Bavaria", "+49", "80331"}},
+	}
+	firstNames       = []string{"Anna", "Ivan", "Maria", "John", "Aigerim", "Dmitry", "Emma", "Lukas", "Olga", "Michael"}
+	lastNames        = []string{"Ivanova", "Petrov", "Smith", "Muller", "Nurlanova", "Sidorov", "Brown", "Schmidt"}
+	streets          = []string{"Lenina", "Nevsky pr.", "5th Avenue", "Baker st.", "Abaya", "Unter den Linden"}
+	deliveryServices = []string{"meest", "DHL", "FedEx", "UPS", "CDEK", "wb-courier"}
+	providers        = []string{"wbpay", "Visa", "Mastercard", "PayPal", "Mir"}
+	banks            = []string{"alpha", "sber", "tinkoff", "vtb", "Chase", "Kaspi"}
+	products         = []struct{ name, brand string }{
+		{"Mascaras", "Vivienne Sabo"}, {"Sneakers", "Nike"}, {"Glasses", "RayBan"}, {"Watch", "Casio"},
+		{"Backpack", "Xiaomi"}, {"Laptop", "Dell"}, {"Wireless Mouse", "Logitech"}, {"T-shirt", "Adidas"},
+		{"Headphones", "Sony"}, {"Mechanical Keyboard", "Corsair"}, {"Dress", "Zarina"}, {"Jeans", "Levi's"},
+	}
+	sizes = []string{"0", "XS", "S", "M", "L", "XL", "42", "44"}
+	// примерная стоимость доллара в валюте, чтобы цены выглядели правдоподобно
+	usdRates = map[string]float64{"USD": 1, "EUR": 0.9, "RUB": 90, "KZT": 500, "JPY": 150, "GBP": 0.8}
+)
+
+// invalidKinds виды битых сообщений: syntax, type_mismatch и precision консьюмер отклоняет всегда,
+// missing_field — при STRICT_DECODING_TOPICS=orders, totals — при MONEY_VALIDATION=reject
+var invalidKinds = []string{"syntax", "missing_field", "type_mismatch", "precision", "totals"}
+
+func (g *Generator) pick(list []string) string { return list[g.rnd.Intn(len(list))] }
+
+func (g *Generator) id(n int) string {
+	const alphabet = "0123456789abcdefghijklmnopqrstuvwxyz"
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = alphabet[g.rnd.Intn(len(alphabet))]
+	}
+	return string(b)
+}
+
+// Next следующий заказ; с вероятностью InvalidRatio вместо заказа отдается битый json и его вид
+func (g *Generator) Next() (order *db.FullOrder, invalid []byte, kind string) {
+	g.seq++
+	order = g.order()
+	if g.cfg.InvalidRatio <= 0 || g.rnd.Float64() >= g.cfg.InvalidRatio {
+		return order, nil, ""
+	}
+	kind = g.pick(invalidKinds)
+	return nil, g.corrupt(order, kind), kind
+}
+
+func (g *Generator) order() *db.FullOrder {
+	uid := g.id(19)
+	track := "WB" + strings.ToUpper(g.id(11))
+	locale := g.pick(g.cfg.Locales)
+	pl := places[locale]
+	if pl == nil {
+		pl = places["en"]
+	}
+	p := pl[g.rnd.Intn(len(pl))]
+	currency := g.pick(g.cfg.Currencies)
+	created := time.Now().UTC().Truncate(time.Second)
+	if g.cfg.Spread > 0 {
+		created = created.Add(-time.Duration(g.rnd.Int63n(int64(g.cfg.Spread))))
+	}
+	name := g.pick(firstNames) + " " + g.pick(lastNames)
+
+	o := &db.FullOrder{
+		Orders: db.Orders{
+			OrderUID:        uid,
+			TrackNumber:     track,
+			Entry:           "WBIL",
+			Locale:          locale,
+			CustomerID:      "cust" + g.id(6),
+			DeliveryService: g.pick(deliveryServices),
+			Shardkey:        fmt.Sprint(g.rnd.Intn(10)),
+			SmID:            int32(g.rnd.Intn(100)),
+			DateCreated:     created,
+			OofShard:        fmt.Sprint(g.rnd.Intn(3)),
+		},
+		Delivery: db.Delivery{
+			OrderUID: uid,
+			Name:     name,
+			Phone:    p.phone + fmt.Sprintf("%010d", g.rnd.Int63n(1e10)),
+			Zip:      p.zip,
+			City:     p.city,
+			Address:  fmt.Sprintf("%s %d", g.pick(streets), 1+g.rnd.Intn(150)),
+			Region:   p.region,
+			Email:    strings.ToLower(strings.ReplaceAll(name, " ", ".")) + "@example.com",
+		},
+		Payment: db.Payment{
+			OrderUID:    uid,
+			Transaction: uid,
+			Currency:    currency,
+			Provider:    g.pick(providers),
+			PaymentDT:   created.Add(time.Duration(g.rnd.Intn(600)) * time.Second).Unix(),
+			Bank:        g.pick(banks),
+		},
+	}
+
+	rate := usdRates[currency]
+	if rate == 0 {
+		rate = 1
+	}
+	// цены в минимальных единицах валюты: от 5 до 300 долларов
+	price := func(usdMin, usdMax float64) db.Money {
+		major := (usdMin + g.rnd.Float64()*(usdMax-usdMin)) * rate
+		return db.NewMoney(int64(major*float64(pow10(db.CurrencyScale(currency)))), currency)
+	}
+
+	n := g.cfg.MinItems
+	if g.cfg.MaxItems > g.cfg.MinItems {
+		n += g.rnd.Intn(g.cfg.MaxItems - g.cfg.MinItems + 1)
+	}
+	goods := db.NewMoney(0, currency)
+	for i := 0; i < n; i++ {
+		prod := products[g.rnd.Intn(len(products))]
+		itemPrice := price(5, 300)
+		sale := int32(g.rnd.Intn(6) * 10)
+		total := db.NewMoney(itemPrice.Minor*int64(100-sale)/100, currency)
+		o.Items = append(o.Items, db.Item{
+			OrderUID:    uid,
+			ChrtID:      g.seq*100 + int64(i),
+			TrackNumber: track,
+			Price:       itemPrice,
+			Rid:         g.id(20),
+			Name:        prod.name,
+			Sale:        sale,
+			Size:        g.pick(sizes),
+			TotalPrice:  total,
+			NmID:        1000000 + g.rnd.Int63n(9000000),
+			Brand:       prod.brand,
+			Status:      202,
+		})
+		goods, _ = goods.Add(total)
+	}
+	o.Payment.GoodsTotal = goods
+	o.Payment.DeliveryCost = price(0, 15)
+	o.Payment.CustomFee = db.NewMoney(0, currency)
+	o.Payment.Amount, _ = goods.Add(o.Payment.DeliveryCost)
+	return o
+}
+
+// corrupt портит заказ так, чтобы консьюмер отклонил его с ошибкой нужного вида
+func (g *Generator) corrupt(o *db.FullOrder, kind string) []byte {
+	data, _ := json.Marshal(o)
+	var doc map[string]any
+	_ = json.Unmarshal(data, &doc)
+	payment := doc["payment"].(map[string]any)
+	switch kind {
+	case "syntax":
+		return data[:len(data)/2]
+	case "missing_field":
+		delete(doc["orders"].(map[string]any), "order_uid")
+	case "type_mismatch":
+		payment["payment_dt"] = "yesterday"
+	case "precision":
+		payment["amount"] = json.Number("10.12345")
+	case "totals":
+		payment["amount"] = json.Number(db.NewMoney(o.Payment.Amount.Minor+1, o.Payment.Currency).String())
+	}
+	data, _ = json.Marshal(doc)
+	return data
+}
+
+func pow10(n int) int64 {
+	p := int64(1)
+	for i := 0; i < n; i++ {
+		p *= 10
+	}
+	return p
+}
@@ -0,0 +1,237 @@
+// Продюсер тестовых заказов: генерирует случайные заказы и отправляет их в кафку с заданной скоростью
+//
+//	go run ./producer -count 1000 -rate 200 -currencies RUB,USD -invalid 0.05
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"wb/codec"
+	kafka "wb/kafka"
+)
+
+const (
+	progressInterval = 5 * time.Second
+	latencySamples   = 100000 // сколько задержек хранится для перцентилей (reservoir sampling)
+)
+
+// deliveryStats задержки доставки и ошибки, обновляются из горутины delivery report
+type deliveryStats struct {
+	sent, delivered, failed, invalid atomic.Int64
+
+	mu        sync.Mutex
+	latencies []time.Duration
+	seen      int64
+	rnd       *rand.Rand
+	errors    map[string]int
+}
+
+func newDeliveryStats() *deliveryStats {
+	return &deliveryStats{rnd: rand.New(rand.NewSource(1)), errors: make(map[string]int)}
+}
+
+func (s *deliveryStats) done(start time.Time, err error) {
+	latency := time.Since(start)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.failed.Add(1)
+		s.errors[err.Error()]++
+		return
+	}
+	s.delivered.Add(1)
+	s.seen++
+	if len(s.latencies) < latencySamples {
+		s.latencies = append(s.latencies, latency)
+	} else if i := s.rnd.Int63n(s.seen); i < latencySamples {
+		s.latencies[i] = latency
+	}
+}
+
+func (s *deliveryStats) percentiles() (p50, p95, p99, maxLatency time.Duration) {
+	s.mu.Lock()
+	sorted := append([]time.Duration(nil), s.latencies...)
+	s.mu.Unlock()
+	if len(sorted) == 0 {
+		return
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	at := func(q float64) time.Duration { return sorted[int(q*float64(len(sorted)-1))] }
+	return at(0.5), at(0.95), at(0.99), sorted[len(sorted)-1]
+}
+
+func (s *deliveryStats) report(prefix string, elapsed time.Duration) {
+	p50, p95, p99, maxLatency := s.percentiles()
+	log.Printf("%s: sent %d (invalid %d), delivered %d, failed %d, %.0f msg/s, latency p50 %s p95 %s p99 %s max %s",
+		prefix, s.sent.Load(), s.invalid.Load(), s.delivered.Load(), s.failed.Load(),
+		float64(s.sent.Load())/elapsed.Seconds(), p50, p95, p99, maxLatency)
+}
+
+func splitList(v string) []string {
+	var out []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func main() {
+	brokers := flag.String("broker", "", "адрес кафки, по умолчанию KAFKA_BROKER или kafka:9092 (защита соединения — из KAFKA_*)")
+	topic := flag.String("topic", "orders", "топик для заказов")
+	count := flag.Int("count", 1, "сколько сообщений отправить, 0 — до Ctrl+C")
+	rate := flag.Float64("rate", 0, "сообщений в секунду, 0 — отправить все сразу (burst)")
+	seed := flag.Int64("seed", 0, "seed генератора, 0 — случайный (печатается в лог для повтора)")
+	minItems := flag.Int("min-items", 1, "минимум товаров в заказе")
+	maxItems := flag.Int("max-items", 3, "максимум товаров в заказе")
+	currencies := flag.String("currencies", "RUB,USD", "валюты через запятую")
+	locales := flag.String("locales", "ru,en", "локали через запятую: ru, en, kz, de")
+	invalidRatio := flag.Float64("invalid", 0, "доля битых сообщений, 0..1")
+	spread := flag.Duration("spread", 0, "разброс date_created в прошлое, например 720h для заказов за месяц")
+	format := flag.String("format", "json", "json или protobuf")
+	registryURL := flag.String("schema-registry", "", "schema registry для protobuf, пусто — локальный в памяти")
+	printOnly := flag.Bool("print", false, "не отправлять, а печатать сообщения в stdout")
+	flag.Parse()
+
+	if *minItems < 0 || *maxItems < *minItems {
+		log.Fatalf("bad item counts: min %d, max %d", *minItems, *maxItems)
+	}
+	if *invalidRatio < 0 || *invalidRatio > 1 {
+		log.Fatalf("-invalid must be between 0 and 1")
+	}
+	if *format != string(codec.FormatJSON) && *format != string(codec.FormatProtobuf) {
+		log.Fatalf("unknown format %q, expected json or protobuf", *format)
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	log.Printf("seed %d", *seed)
+
+	gen := NewGenerator(*seed, GenConfig{
+		MinItems:     *minItems,
+		MaxItems:     *maxItems,
+		Currencies:   splitList(*currencies),
+		Locales:      splitList(*locales),
+		InvalidRatio: *invalidRatio,
+		Spread:       *spread,
+	})
+	// без адреса registry id схемы совпадет с сервисом, только если и он работает на локальном registry
+	var registry codec.Registry = codec.NewMemoryRegistry()
+	if *registryURL != "" {
+		registry = codec.NewHTTPRegistry(*registryURL)
+	}
+	encoder := codec.NewEncoder(registry, codec.Format(*format))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var producer *kafka.Producer
+	if !*printOnly {
+		cfg, err := kafka.ConfigFromEnv("kafka:9092")
+		if err != nil {
+			log.Fatalf("Kafka config: %v", err)
+		}
+		if *brokers != "" {
+			cfg.Brokers = *brokers
+		}
+		if producer, err = kafka.NewProducer(cfg); err != nil {
+			log.Fatalf("Kafka producer failed: %v", err)
+		}
+	}
+
+	stats := newDeliveryStats()
+	start := time.Now()
+	progress := time.NewTicker(progressInterval)
+	defer progress.Stop()
+
+	for i := 0; *count == 0 || i < *count; i++ {
+		// равномерная скорость: i-е сообщение уходит не раньше start + i/rate
+		if *rate > 0 {
+			if wait := time.Until(start.Add(time.Duration(float64(i) / *rate * float64(time.Second)))); wait > 0 {
+				select {
+				case <-time.After(wait):
+				case <-ctx.Done():
+				}
+			}
+		}
+		select {
+		case <-ctx.Done():
+			log.Println("interrupted")
+			*count = i
+		case <-progress.C:
+			stats.report("progress", time.Since(start))
+		default:
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		order, invalid, kind := gen.Next()
+		var (
+			key, value []byte
+			headers    map[string]string
+			err        error
+		)
+		if invalid != nil {
+			stats.invalid.Add(1)
+			value, headers = invalid, map[string]string{codec.HeaderContentType: codec.ContentTypeJSON, "invalid": kind}
+		} else {
+			key = []byte(order.Orders.OrderUID)
+			if value, headers, err = encoder.EncodeOrder(ctx, order); err != nil {
+				log.Fatalf("encode order: %v", err)
+			}
+		}
+
+		if *printOnly {
+			if invalid != nil || *format == string(codec.FormatJSON) {
+				fmt.Println(string(value))
+			} else {
+				out, _ := json.Marshal(order)
+				fmt.Println(string(out))
+			}
+			stats.sent.Add(1)
+			continue
+		}
+
+		sentAt := time.Now()
+		for {
+			err = producer.PublishAsync(*topic, key, value, headers, func(err error) { stats.done(sentAt, err) })
+			if !kafka.IsQueueFull(err) {
+				break
+			}
+			// локальная очередь librdkafka переполнена, ждем, пока уйдет часть сообщений
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err != nil {
+			stats.done(sentAt, err)
+		}
+		stats.sent.Add(1)
+	}
+
+	if producer != nil {
+		producer.Close() // Flush: ждем delivery report по всему, что ушло в очередь
+	}
+	stats.report("done", time.Since(start))
+	stats.mu.Lock()
+	for msg, n := range stats.errors {
+		log.Printf("error x%d: %s", n, msg)
+	}
+	stats.mu.Unlock()
+	if stats.failed.Load() > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"wb/auth"
+	"wb/ratelimit"
+
+	"github.com/gin-gonic/gin"
+)
+
+// лимиты по умолчанию, запросов в секунду:подряд; лимит по ip общий для всех клиентов за одним адресом,
+// поэтому он мягче на маршрутах, куда ходят с ключом
+var (
+	defaultIPLimits = []ratelimit.Rule{
+		{Prefix: "/", Rate: 20, Burst: 50},
+		{Prefix: "/order/", Rate: 10, Burst: 30},
+		{Prefix: "/orders/export", Rate: 0.2, Burst: 3},
+		{Prefix: "/static/", Rate: 0},
+	}
+	defaultKeyLimits = []ratelimit.Rule{
+		{Prefix: "/", Rate: 20, Burst: 50},
+		{Prefix: "/order/", Rate: 5, Burst: 20},
+		{Prefix: "/orders/export", Rate: 0.1, Burst: 2},
+	}
+)
+
+// abuseFromEnv блокировка перебора: ABUSE_WINDOW окно подсчета (1m), ABUSE_MIN_REQUESTS минимум запросов
+// в окне (20), ABUSE_404_RATIO доля 404 (0.5), ABUSE_BLOCK время блокировки (15m, 0 — не блокировать)
+func abuseFromEnv() (ratelimit.DetectorConfig, error) {
+	cfg := ratelimit.DetectorConfig{
+		Window:      envDuration("ABUSE_WINDOW", time.Minute),
+		MinRequests: 20,
+		Ratio:       0.5,
+		Block:       envDuration("ABUSE_BLOCK", 15*time.Minute),
+	}
+	if v := os.Getenv("ABUSE_MIN_REQUESTS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return cfg, fmt.Errorf("ABUSE_MIN_REQUESTS: expected positive number, got %q", v)
+		}
+		cfg.MinRequests = n
+	}
+	if v := os.Getenv("ABUSE_404_RATIO"); v != "" {
+		r, err := strconv.ParseFloat(v, 64)
+		if err != nil || r <= 0 || r > 1 {
+			return cfg, fmt.Errorf("ABUSE_404_RATIO: expected (0, 1], got %q", v)
+		}
+		cfg.Ratio = r
+	}
+	return cfg, nil
+}
+
+// rateLimitRules правила по умолчанию с переопределениями из переменной name
+func rateLimitRules(name string, defaults []ratelimit.Rule) ([]ratelimit.Rule, error) {
+	rules, err := ratelimit.ParseRules(os.Getenv(name))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return append(append([]ratelimit.Rule(nil), defaults...), rules...), nil
+}
+
+// rateLimiters ограничение по ip клиента (RATE_LIMITS_IP) ставится до аутентификации и отсекает в том числе
+// подбор ключей, ограничение по ключу или субъекту токена (RATE_LIMITS_KEY) — после нее
+func rateLimiters() (byIP, byKey *ratelimit.Guard, err error) {
+	abuse, err := abuseFromEnv()
+	if err != nil {
+		return nil, nil, err
+	}
+	ipRules, err := rateLimitRules("RATE_LIMITS_IP", defaultIPLimits)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyRules, err := rateLimitRules("RATE_LIMITS_KEY", defaultKeyLimits)
+	if err != nil {
+		return nil, nil, err
+	}
+	byIP = ratelimit.New("ip", ipRules, ratelimit.NewDetector(abuse), func(c *gin.Context) string {
+		return "ip:" + c.ClientIP()
+	})
+	byKey = ratelimit.New("key", keyRules, ratelimit.NewDetector(abuse), func(c *gin.Context) string {
+		if p := auth.FromContext(c); p != nil {
+			return p.Subject
+		}
+		return ""
+	})
+	return byIP, byKey, nil
+}
+
+// setTrustedProxies адрес клиента берется из X-Forwarded-For только за прокси из TRUSTED_PROXIES
+// (адреса или подсети через запятую), иначе клиент мог бы подставить любой ip и обойти лимиты
+func setTrustedProxies(router *gin.Engine) error {
+	var proxies []string
+	for _, p := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			proxies = append(proxies, p)
+		}
+	}
+	if err := router.SetTrustedProxies(proxies); err != nil {
+		return fmt.Errorf("TRUSTED_PROXIES: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package ratelimit
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DetectorConfig клиент блокируется на Block, если за окно Window он сделал не меньше MinRequests запросов
+// и доля ответов 404 среди них не меньше Ratio; Block 0 — обнаружение выключено
+type DetectorConfig struct {
+	Window      time.Duration
+	MinRequests int
+	Ratio       float64
+	Block       time.Duration
+}
+
+type client struct {
+	windowStart  time.Time
+	requests     int
+	notFound     int
+	blockedUntil time.Time
+}
+
+// Detector счетчики 404 по клиентам в фиксированных окнах
+type Detector struct {
+	cfg DetectorConfig
+
+	mu        sync.Mutex
+	clients   map[string]*client
+	lastSweep time.Time
+}
+
+func NewDetector(cfg DetectorConfig) *Detector {
+	return &Detector{cfg: cfg, clients: make(map[string]*client)}
+}
+
+func (d *Detector) enabled() bool {
+	return d != nil && d.cfg.Block > 0 && d.cfg.Window > 0
+}
+
+// Blocked сколько еще клиент заблокирован, 0 — не заблокирован
+func (d *Detector) Blocked(key string, now time.Time) time.Duration {
+	if !d.enabled() {
+		return 0
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if c, ok := d.clients[key]; ok && now.Before(c.blockedUntil) {
+		return c.blockedUntil.Sub(now)
+	}
+	return 0
+}
+
+// Observe учитывает ответ клиенту; true — клиент только что заблокирован
+func (d *Detector) Observe(key string, status int, now time.Time) bool {
+	if !d.enabled() {
+		return false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if now.Sub(d.lastSweep) > d.cfg.Window {
+		d.sweep(now)
+	}
+	c, ok := d.clients[key]
+	if !ok {
+		c = &client{windowStart: now}
+		d.clients[key] = c
+	}
+	if now.Sub(c.windowStart) >= d.cfg.Window {
+		c.windowStart, c.requests, c.notFound = now, 0, 0
+	}
+	c.requests++
+	if status == http.StatusNotFound {
+		c.notFound++
+	}
+	if now.Before(c.blockedUntil) || c.requests < d.cfg.MinRequests ||
+		float64(c.notFound) < d.cfg.Ratio*float64(c.requests) {
+		return false
+	}
+	c.blockedUntil = now.Add(d.cfg.Block)
+	c.windowStart, c.requests, c.notFound = now, 0, 0
+	return true
+}
+
+// sweep удаляет клиентов с истекшим окном и без блокировки
+func (d *Detector) sweep(now time.Time) {
+	d.lastSweep = now
+	for key, c := range d.clients {
+		if now.Sub(c.windowStart) >= d.cfg.Window && !now.Before(c.blockedUntil) {
+			delete(d.clients, key)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package ratelimit
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestDetectorThreshold(t *testing.T) {
+	cfg := DetectorConfig{Window: 10 * time.Second, MinRequests: 4, Ratio: 0.5, Block: time.Minute}
+	tests := []struct {
+		name     string
+		statuses []int
+		want     bool // блокируется на последнем ответе
+	}{
+		{"below min requests", []int{404, 404, 404}, false},
+		{"min requests all 404", []int{404, 404, 404, 404}, true},
+		{"ratio reached", []int{200, 404, 200, 404}, true},
+		{"below ratio", []int{200, 200, 404, 200, 404}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDetector(cfg)
+			var blocked bool
+			for i, status := range tt.statuses {
+				blocked = d.Observe("a", status, t0.Add(time.Duration(i)*time.Second))
+				if blocked && i < len(tt.statuses)-1 {
+					t.Fatalf("blocked after %d responses", i+1)
+				}
+			}
+			if blocked != tt.want {
+				t.Errorf("blocked = %v, want %v", blocked, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectorBlockExpiry(t *testing.T) {
+	d := NewDetector(DetectorConfig{Window: 10 * time.Second, MinRequests: 2, Ratio: 1, Block: time.Minute})
+	d.Observe("a", http.StatusNotFound, t0)
+	if !d.Observe("a", http.StatusNotFound, t0.Add(time.Second)) {
+		t.Fatal("not blocked")
+	}
+	blockedAt := t0.Add(time.Second)
+	if wait := d.Blocked("a", blockedAt.Add(20*time.Second)); wait != 40*time.Second {
+		t.Errorf("Blocked = %s, want 40s", wait)
+	}
+	if wait := d.Blocked("b", blockedAt); wait != 0 {
+		t.Errorf("Blocked(other) = %s, want 0", wait)
+	}
+	// во время блокировки повторно не блокируется
+	for i := range 3 {
+		if d.Observe("a", http.StatusNotFound, blockedAt.Add(time.Duration(i)*time.Second)) {
+			t.Fatal("blocked again while blocked")
+		}
+	}
+	if wait := d.Blocked("a", blockedAt.Add(time.Minute)); wait != 0 {
+		t.Errorf("Blocked at expiry = %s, want 0", wait)
+	}
+	// после блокировки счет идет с нуля
+	after := blockedAt.Add(2 * time.Minute)
+	if d.Observe("a", http.StatusNotFound, after) {
+		t.Error("blocked on first 404 after expiry")
+	}
+	if !d.Observe("a", http.StatusNotFound, after.Add(time.Second)) {
+		t.Error("not blocked again after expiry")
+	}
+}
+
+func TestDetectorWindowReset(t *testing.T) {
+	d := NewDetector(DetectorConfig{Window: 10 * time.Second, MinRequests: 3, Ratio: 1, Block: time.Minute})
+	d.Observe("a", http.StatusNotFound, t0)
+	d.Observe("a", http.StatusNotFound, t0.Add(5*time.Second))
+	// третий 404 пришел в новом окне, счетчики прошлого окна не учитываются
+	if d.Observe("a", http.StatusNotFound, t0.Add(10*time.Second)) {
+		t.Error("blocked across windows")
+	}
+}
+
+func TestDetectorSweep(t *testing.T) {
+	d := NewDetector(DetectorConfig{Window: 10 * time.Second, MinRequests: 1, Ratio: 1, Block: time.Minute})
+	d.Observe("idle", http.StatusOK, t0)
+	d.Observe("bad", http.StatusNotFound, t0)
+	d.Observe("new", http.StatusOK, t0.Add(11*time.Second))
+	if _, ok := d.clients["idle"]; ok {
+		t.Error("idle client not swept")
+	}
+	if _, ok := d.clients["bad"]; !ok {
+		t.Error("blocked client swept")
+	}
+	d.Observe("new", http.StatusOK, t0.Add(2*time.Minute))
+	if _, ok := d.clients["bad"]; ok {
+		t.Error("client with expired block not swept")
+	}
+}
+
+func TestDetectorDisabled(t *testing.T) {
+	var nilDetector *Detector
+	for _, d := range []*Detector{nilDetector, NewDetector(DetectorConfig{Window: time.Second, MinRequests: 1, Ratio: 0})} {
+		if d.Observe("a", http.StatusNotFound, t0) || d.Blocked("a", t0) != 0 {
+			t.Error("disabled detector blocks")
+		}
+	}
+}
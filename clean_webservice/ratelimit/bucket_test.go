@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+var t0 = time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func TestLimiterAllow(t *testing.T) {
+	l := NewLimiter(2, 3)
+	steps := []struct {
+		at       time.Duration
+		key      string
+		want     bool
+		wantWait time.Duration
+	}{
+		// полная корзина: burst запросов подряд, дальше ждать токен 1/rate
+		{0, "a", true, 0},
+		{0, "a", true, 0},
+		{0, "a", true, 0},
+		{0, "a", false, 500 * time.Millisecond},
+		{0, "b", true, 0}, // у другого клиента своя корзина
+		// за 250ms набралось полтокена
+		{250 * time.Millisecond, "a", false, 250 * time.Millisecond},
+		{500 * time.Millisecond, "a", true, 0},
+		{500 * time.Millisecond, "a", false, 500 * time.Millisecond},
+		// за долгую паузу корзина наполняется только до burst
+		{10 * time.Second, "a", true, 0},
+		{10 * time.Second, "a", true, 0},
+		{10 * time.Second, "a", true, 0},
+		{10 * time.Second, "a", false, 500 * time.Millisecond},
+	}
+	for i, s := range steps {
+		ok, wait := l.Allow(s.key, t0.Add(s.at))
+		if ok != s.want || wait != s.wantWait {
+			t.Errorf("step %d: Allow(%q, +%s) = %v, %s, want %v, %s", i, s.key, s.at, ok, wait, s.want, s.wantWait)
+		}
+	}
+}
+
+func TestLimiterSlowRate(t *testing.T) {
+	l := NewLimiter(0.1, 0) // burst меньше 1 поднимается до 1
+	if ok, _ := l.Allow("a", t0); !ok {
+		t.Fatal("first request rejected")
+	}
+	if ok, wait := l.Allow("a", t0.Add(time.Second)); ok || wait != 9*time.Second {
+		t.Errorf("Allow = %v, %s, want false, 9s", ok, wait)
+	}
+	if ok, _ := l.Allow("a", t0.Add(10*time.Second)); !ok {
+		t.Error("request after refill rejected")
+	}
+}
+
+func TestLimiterSweep(t *testing.T) {
+	l := NewLimiter(1, 10)
+	l.Allow("idle", t0)
+	for range 10 {
+		l.Allow("busy", t0.Add(sweepInterval))
+	}
+	// idle наполнился за минуту и выкидывается, busy пуст и остается
+	l.Allow("new", t0.Add(sweepInterval+2*time.Second))
+	if _, ok := l.buckets["idle"]; ok {
+		t.Error("full bucket not swept")
+	}
+	if _, ok := l.buckets["busy"]; !ok {
+		t.Error("empty bucket swept")
+	}
+	if ok, wait := l.Allow("busy", t0.Add(sweepInterval+2*time.Second)); !ok || wait != 0 {
+		t.Errorf("busy after 2s = %v, %s, want allowed", ok, wait)
+	}
+}
@@ -0,0 +1,128 @@
+package ratelimit
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"wb/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Rule ограничение маршрутов с префиксом Prefix: Rate запросов в секунду и до Burst подряд,
+// Rate 0 — без ограничения
+type Rule struct {
+	Prefix string
+	Rate   float64
+	Burst  int
+}
+
+// ParseRules разбирает "/order/=5:20;/orders/export=0.1:3;/static/=0"
+func ParseRules(v string) ([]Rule, error) {
+	var rules []Rule
+	for _, part := range strings.Split(v, ";") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		prefix, limit, ok := strings.Cut(part, "=")
+		prefix = strings.TrimSpace(prefix)
+		if !ok || !strings.HasPrefix(prefix, "/") {
+			return nil, fmt.Errorf("expected /prefix=rate:burst, got %q", part)
+		}
+		rateStr, burstStr, _ := strings.Cut(strings.TrimSpace(limit), ":")
+		rate, err := strconv.ParseFloat(rateStr, 64)
+		if err != nil || rate < 0 {
+			return nil, fmt.Errorf("bad rate in %q", part)
+		}
+		burst := int(math.Ceil(rate))
+		if burstStr != "" {
+			if burst, err = strconv.Atoi(burstStr); err != nil || burst < 1 {
+				return nil, fmt.Errorf("bad burst in %q", part)
+			}
+		}
+		rules = append(rules, Rule{Prefix: prefix, Rate: rate, Burst: burst})
+	}
+	return rules, nil
+}
+
+// KeyFunc ключ клиента запроса, пусто — запрос не ограничивается
+type KeyFunc func(c *gin.Context) string
+
+// Guard ограничивает запросы клиентов по правилам маршрутов и блокирует клиентов с большой долей 404
+type Guard struct {
+	name     string
+	rules    map[string]*Limiter
+	detector *Detector
+	key      KeyFunc
+	now      func() time.Time
+}
+
+// New правило с тем же префиксом, что у более раннего, заменяет его; detector nil — без блокировок
+func New(name string, rules []Rule, detector *Detector, key KeyFunc) *Guard {
+	g := &Guard{name: name, rules: make(map[string]*Limiter), detector: detector, key: key, now: time.Now}
+	for _, r := range rules {
+		if r.Rate > 0 {
+			g.rules[r.Prefix] = NewLimiter(r.Rate, r.Burst)
+		} else {
+			g.rules[r.Prefix] = nil
+		}
+	}
+	return g
+}
+
+// limiter корзины правила с самым длинным подходящим префиксом, nil — маршрут не ограничен
+func (g *Guard) limiter(path string) *Limiter {
+	var (
+		best    *Limiter
+		bestLen = -1
+	)
+	for prefix, l := range g.rules {
+		if strings.HasPrefix(path, prefix) && len(prefix) > bestLen {
+			best, bestLen = l, len(prefix)
+		}
+	}
+	return best
+}
+
+// Handler отвечает 429 с Retry-After заблокированному клиенту и клиенту, исчерпавшему корзину маршрута,
+// после ответа учитывает его статус для обнаружения перебора
+func (g *Guard) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := g.key(c)
+		if key == "" {
+			c.Next()
+			return
+		}
+		now := g.now()
+		if wait := g.detector.Blocked(key, now); wait > 0 {
+			g.reject(c, "blocked", wait)
+			return
+		}
+		path := c.FullPath()
+		if path == "" {
+			path = "/"
+		}
+		if l := g.limiter(path); l != nil {
+			if ok, wait := l.Allow(key, now); !ok {
+				g.reject(c, "rate", wait)
+				return
+			}
+		}
+		c.Next()
+		if g.detector.Observe(key, c.Writer.Status(), now) {
+			log.Printf("Rate limit: %s blocked for %s, too many 404", key, g.detector.cfg.Block)
+			metrics.Inc(fmt.Sprintf(`http_clients_blocked_total{by=%q}`, g.name))
+		}
+	}
+}
+
+func (g *Guard) reject(c *gin.Context, reason string, wait time.Duration) {
+	metrics.Inc(fmt.Sprintf(`http_rate_limited_total{by=%q,reason=%q}`, g.name, reason))
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests"})
+}
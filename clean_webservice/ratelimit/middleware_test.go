@@ -0,0 +1,105 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseRules(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []Rule
+		wantErr bool
+	}{
+		{in: "", want: nil},
+		{in: " /order/ = 5:20 ; /orders/export=0.1:3;/static/=0;",
+			want: []Rule{{"/order/", 5, 20}, {"/orders/export", 0.1, 3}, {"/static/", 0, 0}}},
+		{in: "/order/=2.5", want: []Rule{{"/order/", 2.5, 3}}}, // burst по умолчанию — rate вверх
+		{in: "order=5:20", wantErr: true},
+		{in: "/order/", wantErr: true},
+		{in: "/order/=fast", wantErr: true},
+		{in: "/order/=-1", wantErr: true},
+		{in: "/order/=5:0", wantErr: true},
+		{in: "/order/=5:x", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRules(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseRules(%q) error = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseRules(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestGuardHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	now := t0
+	g := New("test", []Rule{
+		{Prefix: "/", Rate: 0.4, Burst: 1},
+		{Prefix: "/order/", Rate: 2, Burst: 2},
+		{Prefix: "/metrics", Rate: 0},
+	}, NewDetector(DetectorConfig{Window: time.Minute, MinRequests: 3, Ratio: 1, Block: 90 * time.Second}),
+		func(c *gin.Context) string { return c.GetHeader("X-Client") })
+	g.now = func() time.Time { return now }
+	router := gin.New()
+	router.Use(g.Handler())
+	router.GET("/order/:order_uid", func(c *gin.Context) {
+		if c.Param("order_uid") == "missing" {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+	router.GET("/metrics", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/admin/audit", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	get := func(path, client string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if client != "" {
+			req.Header.Set("X-Client", client)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	expect := func(w *httptest.ResponseRecorder, status int, retryAfter string) {
+		t.Helper()
+		if w.Code != status || w.Header().Get("Retry-After") != retryAfter {
+			t.Errorf("status %d Retry-After %q, want %d %q", w.Code, w.Header().Get("Retry-After"), status, retryAfter)
+		}
+	}
+
+	// правило с самым длинным префиксом, Retry-After — секунды до токена вверх
+	expect(get("/order/1", "a"), 200, "")
+	expect(get("/order/1", "a"), 200, "")
+	expect(get("/order/1", "a"), 429, "1")
+	expect(get("/admin/audit", "a"), 200, "")
+	expect(get("/admin/audit", "a"), 429, "3")
+	for range 5 {
+		expect(get("/metrics", "a"), 200, "")
+	}
+	// без ключа клиента запрос не ограничивается
+	for range 5 {
+		expect(get("/order/1", ""), 200, "")
+	}
+
+	// перебор несуществующих заказов: блокировка на 90s на всех маршрутах
+	now = now.Add(time.Hour)
+	expect(get("/order/missing", "b"), 404, "")
+	expect(get("/order/missing", "b"), 404, "")
+	now = now.Add(time.Second)
+	expect(get("/order/missing", "b"), 404, "")
+	expect(get("/metrics", "b"), 429, "90")
+	now = now.Add(89500 * time.Millisecond)
+	expect(get("/metrics", "b"), 429, "1")
+	now = now.Add(500 * time.Millisecond)
+	expect(get("/order/1", "b"), 200, "")
+}
@@ -0,0 +1,108 @@
+package rates
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HTTPProvider берет курсы у внешнего сервиса: GET {baseURL}/rates?date=2025-01-01
+// ответ {"base": "USD", "date": "2025-01-01", "rates": {"RUB": "98.5"}}; курсы дня кешируются, они не меняются
+type HTTPProvider struct {
+	baseURL string
+	client  *http.Client
+	mu      sync.RWMutex
+	cache   map[string]dayRates
+}
+
+type dayRates struct {
+	Base  string            `json:"base"`
+	Date  string            `json:"date"`
+	Rates map[string]string `json:"rates"`
+}
+
+func NewHTTPProvider(baseURL string) *HTTPProvider {
+	return &HTTPProvider{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  &http.Client{Timeout: 5 * time.Second},
+		cache:   make(map[string]dayRates),
+	}
+}
+
+func (p *HTTPProvider) Rate(ctx context.Context, from, to string, at time.Time) (*big.Rat, error) {
+	if strings.EqualFold(from, to) {
+		return big.NewRat(1, 1), nil
+	}
+	day := at.UTC().Format(dateLayout)
+	d, err := p.day(ctx, day)
+	if err != nil {
+		return nil, err
+	}
+	r, ok := crossRate(d.Base, d.Rates, from, to)
+	if !ok {
+		return nil, fmt.Errorf("%s->%s on %s: %w", from, to, day, ErrRateNotFound)
+	}
+	return r, nil
+}
+
+func (p *HTTPProvider) day(ctx context.Context, day string) (dayRates, error) {
+	p.mu.RLock()
+	d, ok := p.cache[day]
+	p.mu.RUnlock()
+	if ok {
+		return d, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+"/rates?date="+url.QueryEscape(day), nil)
+	if err != nil {
+		return dayRates{}, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return dayRates{}, fmt.Errorf("fetch rates for %s: %w", day, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return dayRates{}, fmt.Errorf("rates for %s: %w", day, ErrRateNotFound)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return dayRates{}, fmt.Errorf("fetch rates for %s: %s", day, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&d); err != nil {
+		return dayRates{}, fmt.Errorf("decode rates for %s: %w", day, err)
+	}
+	p.mu.Lock()
+	p.cache[day] = d
+	p.mu.Unlock()
+	return d, nil
+}
+
+// NewHandler локальная замена сервиса курсов поверх файла: отдает тот же api, что ждет HTTPProvider
+func NewHandler(p *StaticProvider) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /rates", func(w http.ResponseWriter, r *http.Request) {
+		at := time.Now()
+		if v := r.URL.Query().Get("date"); v != "" {
+			t, err := time.Parse(dateLayout, v)
+			if err != nil {
+				http.Error(w, "bad date", http.StatusBadRequest)
+				return
+			}
+			at = t
+		}
+		day, rates, ok := p.Day(at)
+		if !ok {
+			http.Error(w, "rates not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(dayRates{Base: p.base, Date: day, Rates: rates})
+	})
+	return mux
+}
@@ -0,0 +1,96 @@
+package rates
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	db "wb/postgresql"
+)
+
+// ErrRateNotFound нет курса для пары валют на эту дату (или на любую более раннюю)
+var ErrRateNotFound = errors.New("exchange rate not found")
+
+// Provider источник курсов валют
+// Rate возвращает, сколько единиц to стоит одна единица from на дату at (берется последний курс не позже at)
+type Provider interface {
+	Rate(ctx context.Context, from, to string, at time.Time) (*big.Rat, error)
+}
+
+// Table курсы к базовой валюте по дням, общий формат для файла и http api:
+// {"base": "USD", "rates": {"2025-01-01": {"RUB": "98.5", "EUR": "0.96"}}}
+type Table struct {
+	Base  string                       `json:"base"`
+	Rates map[string]map[string]string `json:"rates"`
+}
+
+const dateLayout = "2006-01-02"
+
+// Convert переводит сумму в другую валюту по курсу с округлением до минимальных единиц (половина — от нуля)
+func Convert(m db.Money, to string, rate *big.Rat) (db.Money, error) {
+	toScale := db.CurrencyScale(to)
+	v := new(big.Rat).SetFrac(big.NewInt(m.Minor), pow10(m.Scale))
+	v.Mul(v, rate)
+	v.Mul(v, new(big.Rat).SetInt(pow10(toScale)))
+
+	// округление: целая часть от (|num| * 2 + den) / (2 * den)
+	num := new(big.Int).Abs(v.Num())
+	den := v.Denom()
+	num.Mul(num, big.NewInt(2)).Add(num, den)
+	num.Quo(num, new(big.Int).Mul(den, big.NewInt(2)))
+	if v.Sign() < 0 {
+		num.Neg(num)
+	}
+	if !num.IsInt64() {
+		return db.Money{}, fmt.Errorf("convert %s %s to %s: %w", m, m.Currency, to, db.ErrMoneyOverflow)
+	}
+	return db.Money{Minor: num.Int64(), Scale: toScale, Currency: to}, nil
+}
+
+// ConvertAt берет курс у провайдера на дату и переводит сумму, валюта суммы берется из m.Currency
+func ConvertAt(ctx context.Context, p Provider, m db.Money, to string, at time.Time) (db.Money, *big.Rat, error) {
+	rate, err := p.Rate(ctx, m.Currency, to, at)
+	if err != nil {
+		return db.Money{}, nil, err
+	}
+	converted, err := Convert(m, to, rate)
+	if err != nil {
+		return db.Money{}, nil, err
+	}
+	return converted, rate, nil
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// crossRate курс from->to через базовую валюту таблицы одного дня
+func crossRate(base string, day map[string]string, from, to string) (*big.Rat, bool) {
+	toBase := func(currency string) (*big.Rat, bool) {
+		if strings.EqualFold(currency, base) {
+			return big.NewRat(1, 1), true
+		}
+		s, ok := day[strings.ToUpper(currency)]
+		if !ok {
+			return nil, false
+		}
+		r, ok := new(big.Rat).SetString(s)
+		if !ok || r.Sign() <= 0 {
+			return nil, false
+		}
+		return r, true
+	}
+	fromRate, ok := toBase(from)
+	if !ok {
+		return nil, false
+	}
+	toRate, ok := toBase(to)
+	if !ok {
+		return nil, false
+	}
+	// в таблице 1 base = X currency, значит 1 from = toRate / fromRate to
+	return new(big.Rat).Quo(toRate, fromRate), true
+}
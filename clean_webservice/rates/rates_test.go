@@ -0,0 +1,199 @@
+package rates
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	db "wb/postgresql"
+)
+
+var testTable = Table{Base: "usd", Rates: map[string]map[string]string{
+	"2025-01-01": {"RUB": "100", "EUR": "0.8", "JPY": "150", "KWD": "0.3"},
+	"2025-02-01": {"rub": "90", "EUR": "0.9"},
+	"2025-03-01": {"RUB": "80"},
+}}
+
+func day(s string) time.Time {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func ratString(r *big.Rat) string {
+	if r == nil {
+		return "<nil>"
+	}
+	return r.RatString()
+}
+
+func TestStaticRate(t *testing.T) {
+	p, err := NewStaticProviderFromTable(testTable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		from, to string
+		at       string
+		want     string // пусто — курса нет
+	}{
+		{"exact day", "USD", "RUB", "2025-02-01T00:00:00Z", "90"},
+		{"nearest earlier day", "USD", "RUB", "2025-02-20T15:00:00Z", "90"},
+		{"last day before at", "USD", "RUB", "2025-01-31T23:59:59Z", "100"},
+		{"after last day", "USD", "RUB", "2026-01-01T00:00:00Z", "80"},
+		{"day in utc", "USD", "RUB", "2025-02-01T01:00:00+03:00", "100"},
+		{"to base", "RUB", "USD", "2025-02-01T00:00:00Z", "1/90"},
+		{"cross rate", "EUR", "RUB", "2025-02-05T00:00:00Z", "100"},
+		{"currency missing that day", "USD", "EUR", "2025-03-10T00:00:00Z", "9/10"},
+		{"lower case", "usd", "jpy", "2025-03-10T00:00:00Z", "150"},
+		{"same currency", "GBP", "gbp", "2024-01-01T00:00:00Z", "1"},
+		{"before first day", "USD", "RUB", "2024-12-31T23:59:59Z", ""},
+		{"unknown currency", "USD", "GBP", "2025-03-01T00:00:00Z", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := p.Rate(context.Background(), tt.from, tt.to, day(tt.at))
+			if tt.want == "" {
+				if !errors.Is(err, ErrRateNotFound) || r != nil {
+					t.Errorf("Rate = %s, %v, want ErrRateNotFound", ratString(r), err)
+				}
+				return
+			}
+			if err != nil || r.RatString() != tt.want {
+				t.Errorf("Rate = %s, %v, want %s", ratString(r), err, tt.want)
+			}
+		})
+	}
+}
+
+func TestStaticProviderFile(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name, data string
+		ok         bool
+	}{
+		{"ok", `{"base": "USD", "rates": {"2025-01-01": {"RUB": "98.5"}}}`, true},
+		{"no base", `{"rates": {"2025-01-01": {"RUB": "98.5"}}}`, false},
+		{"bad date", `{"base": "USD", "rates": {"01.01.2025": {"RUB": "98.5"}}}`, false},
+		{"zero rate", `{"base": "USD", "rates": {"2025-01-01": {"RUB": "0"}}}`, false},
+		{"not a number", `{"base": "USD", "rates": {"2025-01-01": {"RUB": "n/a"}}}`, false},
+		{"broken json", `{"base":`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name+".json")
+			if err := os.WriteFile(path, []byte(tt.data), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := NewStaticProvider(path); (err == nil) != tt.ok {
+				t.Errorf("NewStaticProvider error = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+	// файл из репозитория, его читает docker-compose
+	if _, err := NewStaticProvider("rates.json"); err != nil {
+		t.Errorf("rates.json: %v", err)
+	}
+}
+
+func TestHTTPProvider(t *testing.T) {
+	static, err := NewStaticProviderFromTable(testTable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var requests atomic.Int32
+	handler := NewHandler(static)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		handler.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	p := NewHTTPProvider(srv.URL + "/")
+	ctx := context.Background()
+
+	r, err := p.Rate(ctx, "USD", "RUB", day("2025-02-20T10:00:00Z"))
+	if err != nil || r.RatString() != "90" {
+		t.Fatalf("Rate = %s, %v, want 90 from the nearest earlier day", ratString(r), err)
+	}
+	if r, err := p.Rate(ctx, "EUR", "RUB", day("2025-02-20T18:00:00Z")); err != nil || r.RatString() != "100" {
+		t.Errorf("cross Rate = %s, %v, want 100", ratString(r), err)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("%d requests for one day, want 1 (cached)", n)
+	}
+	if r, err := p.Rate(ctx, "USD", "GBP", day("2025-02-20T00:00:00Z")); !errors.Is(err, ErrRateNotFound) {
+		t.Errorf("Rate(GBP) = %s, %v, want ErrRateNotFound", ratString(r), err)
+	}
+	if r, err := p.Rate(ctx, "USD", "RUB", day("2024-06-01T00:00:00Z")); !errors.Is(err, ErrRateNotFound) {
+		t.Errorf("Rate before first day = %s, %v, want ErrRateNotFound", ratString(r), err)
+	}
+
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer down.Close()
+	r, err = NewHTTPProvider(down.URL).Rate(ctx, "USD", "RUB", day("2025-02-20T00:00:00Z"))
+	if err == nil || errors.Is(err, ErrRateNotFound) || r != nil {
+		t.Errorf("Rate from failing service = %s, %v, want service error", ratString(r), err)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		name string
+		m    db.Money
+		to   string
+		rate *big.Rat
+		want db.Money
+	}{
+		{"usd to rub", db.NewMoney(1817, "USD"), "RUB", big.NewRat(9852, 100), db.NewMoney(179011, "RUB")},
+		{"usd to jpy drops minor units", db.NewMoney(1050, "USD"), "JPY", big.NewRat(150, 1), db.NewMoney(1575, "JPY")},
+		{"jpy to usd adds minor units", db.NewMoney(1575, "JPY"), "USD", big.NewRat(1, 150), db.NewMoney(1050, "USD")},
+		{"usd to kwd three digits", db.NewMoney(1001, "USD"), "KWD", big.NewRat(3, 10), db.NewMoney(3003, "KWD")},
+		{"kwd to jpy", db.NewMoney(1, "KWD"), "JPY", big.NewRat(500, 1), db.NewMoney(1, "JPY")},
+		{"half rounds away from zero", db.NewMoney(1, "USD"), "JPY", big.NewRat(50, 1), db.NewMoney(1, "JPY")},
+		{"negative half", db.NewMoney(-1, "USD"), "JPY", big.NewRat(50, 1), db.NewMoney(-1, "JPY")},
+		{"below half", db.NewMoney(1, "USD"), "JPY", big.NewRat(49, 1), db.NewMoney(0, "JPY")},
+		{"scale from message", db.Money{Minor: 18175, Scale: 3, Currency: "USD"}, "RUB", big.NewRat(100, 1),
+			db.NewMoney(181750, "RUB")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Convert(tt.m, tt.to, tt.rate)
+			if err != nil || got != tt.want {
+				t.Errorf("Convert(%s %s) = %+v, %v, want %+v", tt.m, tt.m.Currency, got, err, tt.want)
+			}
+		})
+	}
+	if _, err := Convert(db.NewMoney(1<<62, "JPY"), "USD", big.NewRat(1000, 1)); !errors.Is(err, db.ErrMoneyOverflow) {
+		t.Errorf("Convert overflow = %v, want ErrMoneyOverflow", err)
+	}
+}
+
+func TestConvertAt(t *testing.T) {
+	p, err := NewStaticProviderFromTable(testTable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	// курс берется на дату платежа, а не текущий
+	paid := time.Unix(1738800000, 0) // 2025-02-06
+	got, rate, err := ConvertAt(ctx, p, db.NewMoney(1000, "USD"), "RUB", paid)
+	if err != nil || got != db.NewMoney(90000, "RUB") || rate.RatString() != "90" {
+		t.Errorf("ConvertAt = %+v, %v, %v, want 900.00 RUB at 90", got, ratString(rate), err)
+	}
+	got, rate, err = ConvertAt(ctx, p, db.NewMoney(1000, "USD"), "GBP", paid)
+	if !errors.Is(err, ErrRateNotFound) || got != (db.Money{}) || rate != nil {
+		t.Errorf("ConvertAt without rate = %+v, %v, %v, want ErrRateNotFound and no amount", got, ratString(rate), err)
+	}
+}
@@ -0,0 +1,86 @@
+package rates
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// StaticProvider курсы из json файла, загружаются один раз при старте
+type StaticProvider struct {
+	base  string
+	days  []string // отсортированные даты, для поиска последнего курса не позже нужной даты
+	rates map[string]map[string]string
+}
+
+// NewStaticProvider читает таблицу курсов из файла в формате Table
+func NewStaticProvider(path string) (*StaticProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read rates file: %w", err)
+	}
+	var t Table
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("parse rates file %s: %w", path, err)
+	}
+	return NewStaticProviderFromTable(t)
+}
+
+func NewStaticProviderFromTable(t Table) (*StaticProvider, error) {
+	if t.Base == "" {
+		return nil, fmt.Errorf("rates table: empty base currency")
+	}
+	p := &StaticProvider{base: strings.ToUpper(t.Base), rates: make(map[string]map[string]string)}
+	for day, rates := range t.Rates {
+		if _, err := time.Parse(dateLayout, day); err != nil {
+			return nil, fmt.Errorf("rates table: bad date %q", day)
+		}
+		normalized := make(map[string]string, len(rates))
+		for currency, rate := range rates {
+			if r, ok := new(big.Rat).SetString(rate); !ok || r.Sign() <= 0 {
+				return nil, fmt.Errorf("rates table: bad rate %s=%q on %s", currency, rate, day)
+			}
+			normalized[strings.ToUpper(currency)] = rate
+		}
+		p.rates[day] = normalized
+		p.days = append(p.days, day)
+	}
+	sort.Strings(p.days)
+	return p, nil
+}
+
+// Rate курс на последний день не позже at, в котором есть обе валюты
+func (p *StaticProvider) Rate(_ context.Context, from, to string, at time.Time) (*big.Rat, error) {
+	if strings.EqualFold(from, to) {
+		return big.NewRat(1, 1), nil
+	}
+	day := at.UTC().Format(dateLayout)
+	i := sort.SearchStrings(p.days, day)
+	if i == len(p.days) || p.days[i] != day {
+		i-- // нет курса ровно на дату, берем предыдущий день
+	}
+	for ; i >= 0; i-- {
+		if r, ok := crossRate(p.base, p.rates[p.days[i]], from, to); ok {
+			return r, nil
+		}
+	}
+	return nil, fmt.Errorf("%s->%s on %s: %w", from, to, day, ErrRateNotFound)
+}
+
+// Day таблица курсов одного дня (последнего не позже at), нужна http stand-in серверу
+func (p *StaticProvider) Day(at time.Time) (string, map[string]string, bool) {
+	day := at.UTC().Format(dateLayout)
+	i := sort.SearchStrings(p.days, day)
+	if i == len(p.days) || p.days[i] != day {
+		i--
+	}
+	if i < 0 {
+		return "", nil, false
+	}
+	return p.days[i], p.rates[p.days[i]], true
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	db "wb/postgresql"
+	"wb/rates"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultBaseCurrency = "USD"
+	defaultRatesFile    = "rates/rates.json"
+	reportTimeout       = 30 * time.Second
+	reportDateLayout    = "2006-01-02"
+)
+
+// newRatesProvider курсы берутся из RATES_URL, если он задан, иначе из файла RATES_FILE
+func newRatesProvider() (rates.Provider, error) {
+	if url := os.Getenv("RATES_URL"); url != "" {
+		log.Printf("Exchange rates from %s", url)
+		return rates.NewHTTPProvider(url), nil
+	}
+	path := os.Getenv("RATES_FILE")
+	if path == "" {
+		path = defaultRatesFile
+	}
+	log.Printf("Exchange rates from file %s", path)
+	return rates.NewStaticProvider(path)
+}
+
+// reportParams base, from и to из query: ?base=EUR&from=2025-01-01&to=2025-02-01
+func reportParams(c *gin.Context) (base string, from, to time.Time, err error) {
+	base = strings.ToUpper(c.DefaultQuery("base", defaultBaseCurrency))
+	from, to, err = dateRange(c)
+	return base, from, to, err
+}
+
+// dateRange период из query from/to в формате YYYY-MM-DD, to не включается
+// по умолчанию последние 30 дней
+func dateRange(c *gin.Context) (from, to time.Time, err error) {
+	to = time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 1)
+	from = to.AddDate(0, 0, -30)
+	if v := c.Query("from"); v != "" {
+		if from, err = time.Parse(reportDateLayout, v); err != nil {
+			return time.Time{}, time.Time{}, errors.New("bad from date, expected YYYY-MM-DD")
+		}
+	}
+	if v := c.Query("to"); v != "" {
+		if to, err = time.Parse(reportDateLayout, v); err != nil {
+			return time.Time{}, time.Time{}, errors.New("bad to date, expected YYYY-MM-DD")
+		}
+	}
+	if !to.After(from) {
+		return time.Time{}, time.Time{}, errors.New("to must be after from")
+	}
+	return from, to, nil
+}
+
+type (
+	// currencyTotal выручка в одной валюте и она же в базовой
+	currencyTotal struct {
+		Currency  string   `json:"currency"`
+		Orders    int      `json:"orders"`
+		Amount    db.Money `json:"amount"`
+		Converted db.Money `json:"amount_base"`
+	}
+	// convertedOrder сумма заказа по курсу на дату платежа
+	convertedOrder struct {
+		OrderUID  string    `json:"order_uid"`
+		PaymentDT time.Time `json:"payment_dt"`
+		Currency  string    `json:"currency"`
+		Amount    db.Money  `json:"amount"`
+		Rate      string    `json:"rate,omitempty"`
+		Converted *db.Money `json:"amount_base,omitempty"`
+		Error     string    `json:"error,omitempty"`
+	}
+)
+
+// registerReportRoutes отчеты с пересчетом сумм заказов в базовую валюту по курсу на день payment_dt
+func registerReportRoutes(router *gin.Engine, provider rates.Provider) {
+	// локальная замена сервиса курсов: RATES_URL=http://localhost:8081 у другого экземпляра
+	if static, ok := provider.(*rates.StaticProvider); ok {
+		router.GET("/rates", gin.WrapH(rates.NewHandler(static)))
+	}
+
+	router.GET("/reports/revenue", func(c *gin.Context) {
+		base, from, to, err := reportParams(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), reportTimeout)
+		defer cancel()
+
+		total := db.NewMoney(0, base)
+		byCurrency := make(map[string]*currencyTotal)
+		var orders, missing int
+		err = db.ForEachPayment(ctx, requestTenant(c), from, to, 0, func(p db.PaymentRow) error {
+			converted, _, err := rates.ConvertAt(ctx, provider, p.Amount, base, p.PaymentDT)
+			if errors.Is(err, rates.ErrRateNotFound) {
+				missing++
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			ct, ok := byCurrency[p.Amount.Currency]
+			if !ok {
+				ct = &currencyTotal{Currency: p.Amount.Currency,
+					Amount: db.NewMoney(0, p.Amount.Currency), Converted: db.NewMoney(0, base)}
+				byCurrency[p.Amount.Currency] = ct
+			}
+			if ct.Amount, err = ct.Amount.Add(p.Amount); err != nil {
+				return err
+			}
+			if ct.Converted, err = ct.Converted.Add(converted); err != nil {
+				return err
+			}
+			if total, err = total.Add(converted); err != nil {
+				return err
+			}
+			ct.Orders++
+			orders++
+			return nil
+		})
+		if err != nil {
+			log.Printf("revenue report: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build report"})
+			return
+		}
+
+		currencies := make([]*currencyTotal, 0, len(byCurrency))
+		for _, ct := range byCurrency {
+			currencies = append(currencies, ct)
+		}
+		sort.Slice(currencies, func(i, j int) bool { return currencies[i].Currency < currencies[j].Currency })
+		c.JSON(http.StatusOK, gin.H{
+			"base":                base,
+			"from":                from.Format(reportDateLayout),
+			"to":                  to.Format(reportDateLayout),
+			"orders":              orders,
+			"total":               total,
+			"by_currency":         currencies,
+			"orders_without_rate": missing,
+		})
+	})
+
+	router.GET("/reports/orders", func(c *gin.Context) {
+		base, from, to, err := reportParams(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+		if err != nil || limit <= 0 || limit > 1000 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 1000"})
+			return
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), reportTimeout)
+		defer cancel()
+
+		result := []convertedOrder{}
+		err = db.ForEachPayment(ctx, requestTenant(c), from, to, limit, func(p db.PaymentRow) error {
+			o := convertedOrder{OrderUID: p.OrderUID, PaymentDT: p.PaymentDT, Currency: p.Amount.Currency, Amount: p.Amount}
+			converted, rate, err := rates.ConvertAt(ctx, provider, p.Amount, base, p.PaymentDT)
+			switch {
+			case errors.Is(err, rates.ErrRateNotFound):
+				o.Error = err.Error()
+			case err != nil:
+				return err
+			default:
+				o.Rate = rate.FloatString(6)
+				o.Converted = &converted
+			}
+			result = append(result, o)
+			return nil
+		})
+		if err != nil {
+			log.Printf("orders report: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build report"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"base": base, "orders": result})
+	})
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"wb/metrics"
+	db "wb/postgresql"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultStatsRefreshInterval = 5 * time.Minute
+
+// statsRefreshInterval период пересчета витрин из STATS_REFRESH_INTERVAL (например 1m), по умолчанию 5 минут
+func statsRefreshInterval() time.Duration {
+	if v := os.Getenv("STATS_REFRESH_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err == nil && d > 0 {
+			return d
+		}
+		log.Printf("Warning: bad STATS_REFRESH_INTERVAL %q, using %s", v, defaultStatsRefreshInterval)
+	}
+	return defaultStatsRefreshInterval
+}
+
+// runStatsRefresher пересчитывает витрины статистики сразу при старте и дальше по расписанию
+func runStatsRefresher(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		refreshStats(ctx)
+		select {
+		case <-ctx.Done():
+			log.Println("Stats refresher stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func refreshStats(ctx context.Context) {
+	start := time.Now()
+	refreshCtx, cancel := context.WithTimeout(ctx, reportTimeout)
+	err := db.RefreshStats(refreshCtx)
+	cancel()
+	if err != nil {
+		log.Printf("Stats refresh error: %v", err)
+		metrics.Inc(`stats_refresh_total{result="error"}`)
+		return
+	}
+	metrics.Inc(`stats_refresh_total{result="ok"}`)
+	metrics.Set("stats_refresh_duration_ms", time.Since(start).Milliseconds())
+}
+
+// registerStatsRoutes GET /stats — итоги за период, GET /stats/:dimension — с группировкой
+// по day, week, delivery_service, provider, bank, region или brand
+func registerStatsRoutes(router *gin.Engine) {
+	handler := func(c *gin.Context) {
+		dimension := c.Param("dimension")
+		if dimension == "" {
+			dimension = "total"
+		}
+		from, to, err := dateRange(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx, cancel := context.WithTimeout(c.Request.Context(), dbTimeout)
+		defer cancel()
+		rows, refreshedAt, err := db.GetStats(ctx, requestTenant(c), dimension, from, to)
+		if errors.Is(err, db.ErrUnknownDimension) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Unknown stats dimension"})
+			return
+		}
+		if err != nil {
+			log.Printf("get stats: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load stats"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"group_by":     dimension,
+			"from":         from.Format(reportDateLayout),
+			"to":           to.Format(reportDateLayout),
+			"refreshed_at": refreshedAt,
+			"rows":         rows,
+		})
+	}
+	router.GET("/stats", handler)
+	router.GET("/stats/:dimension", handler)
+}
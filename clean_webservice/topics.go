@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"wb/kafka"
+
+	"github.com/gin-gonic/gin"
+)
+
+// обработчики сообщений, на которые TOPIC_ROUTES направляет топики
+const (
+	handlerOrders        = "orders"
+	handlerStatus        = "status"
+	handlerCancellations = "cancellations"
+)
+
+// handlerNames порядок запуска консьюмеров
+var handlerNames = []string{handlerOrders, handlerStatus, handlerCancellations}
+
+// handlerGroup группа консьюмера обработчика: у каждого своя, чтобы ребаланс и оффсеты одной подписки
+// не задевали другие; заказы остаются в исходной группе consumerGroup и не теряют закоммиченные оффсеты
+func handlerGroup(handler string) string {
+	if handler == handlerOrders {
+		return consumerGroup
+	}
+	return consumerGroup + "-" + handler
+}
+
+const cancellationTopicName = "order-cancellations"
+
+const (
+	// tenantRequestHeader заголовок http запроса, которым admin выбирает арендатора
+	tenantRequestHeader = "X-Tenant"
+	// tenantContextKey арендатор запроса в gin.Context, его выставляет authConfig.scopeTenant
+	tenantContextKey = "tenant"
+)
+
+// errTenantConflict заголовок сообщения называет не того арендатора, что топик
+var errTenantConflict = errors.New("tenant header conflicts with topic")
+
+// topicRoutes топики по обработчикам из TOPIC_ROUTES: "orders=orders,^orders\..+$=orders,order-status=status";
+// слева имя топика или регулярное выражение с ^, справа обработчик. Каждый обработчик читает свои топики
+// отдельным консьюмером, один топик не должен попадать в два обработчика
+func topicRoutes() (map[string][]string, error) {
+	v := os.Getenv("TOPIC_ROUTES")
+	if v == "" {
+		v = topicName + "=" + handlerOrders + "," + statusTopicName + "=" + handlerStatus + "," +
+			cancellationTopicName + "=" + handlerCancellations
+	}
+	routes := make(map[string][]string)
+	seen := make(map[string]string)
+	for _, route := range strings.Split(v, ",") {
+		if route = strings.TrimSpace(route); route == "" {
+			continue
+		}
+		topic, handler, ok := strings.Cut(route, "=")
+		topic, handler = strings.TrimSpace(topic), strings.TrimSpace(handler)
+		if !ok || topic == "" {
+			return nil, fmt.Errorf("TOPIC_ROUTES: expected topic=handler, got %q", route)
+		}
+		switch handler {
+		case handlerOrders, handlerStatus, handlerCancellations:
+		default:
+			return nil, fmt.Errorf("TOPIC_ROUTES: unknown handler %q, expected orders, status or cancellations", handler)
+		}
+		if prev, ok := seen[topic]; ok {
+			return nil, fmt.Errorf("TOPIC_ROUTES: topic %q routed to both %s and %s", topic, prev, handler)
+		}
+		seen[topic] = handler
+		routes[handler] = append(routes[handler], topic)
+	}
+	if len(routes) == 0 {
+		return nil, fmt.Errorf("TOPIC_ROUTES: no routes")
+	}
+	return routes, nil
+}
+
+// routedTopics топики маршрутов, заданные именем: их сервис создает при старте
+func routedTopics(routes map[string][]string) []string {
+	var topics []string
+	for _, handler := range handlerNames {
+		for _, t := range routes[handler] {
+			if !strings.HasPrefix(t, "^") {
+				topics = append(topics, t)
+			}
+		}
+	}
+	return topics
+}
+
+// tenantResolver определяет арендатора сообщения: первая группа регулярного выражения TENANT_TOPIC_PATTERN
+// по имени топика, для топиков вне шаблона — заголовок TENANT_HEADER; ничего не задано — сообщение без арендатора
+type tenantResolver struct {
+	header string
+	topic  *regexp.Regexp
+}
+
+// tenants настройки арендаторов, заполняются при старте из окружения
+var tenants tenantResolver
+
+func newTenantResolver() (tenantResolver, error) {
+	r := tenantResolver{header: os.Getenv("TENANT_HEADER")}
+	if v := os.Getenv("TENANT_TOPIC_PATTERN"); v != "" {
+		re, err := regexp.Compile(v)
+		if err != nil {
+			return r, fmt.Errorf("TENANT_TOPIC_PATTERN: %w", err)
+		}
+		if re.NumSubexp() < 1 {
+			return r, fmt.Errorf("TENANT_TOPIC_PATTERN: %q has no capture group for tenant", v)
+		}
+		r.topic = re
+	}
+	return r, nil
+}
+
+// enabled разделены ли заказы по арендаторам
+func (r tenantResolver) enabled() bool {
+	return r.header != "" || r.topic != nil
+}
+
+// Resolve арендатор сообщения. Права на топик выдаются по арендатору, поэтому арендатор из имени топика главный:
+// заголовок с другим арендатором — errTenantConflict, а не запись в чужие заказы
+func (r tenantResolver) Resolve(msg kafka.Message) (string, error) {
+	var header string
+	if r.header != "" {
+		header = strings.TrimSpace(msg.Headers[r.header])
+	}
+	if r.topic != nil {
+		if m := r.topic.FindStringSubmatch(msg.Topic); m != nil {
+			if header != "" && header != m[1] {
+				return "", fmt.Errorf("%w: header %s=%q, topic %s", errTenantConflict, r.header, header, msg.Topic)
+			}
+			return m[1], nil
+		}
+	}
+	return header, nil
+}
+
+// requestTenant арендатор http запроса, выставленный authConfig.scopeTenant; пустой — заказы без арендатора
+func requestTenant(c *gin.Context) string {
+	return c.GetString(tenantContextKey)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"wb/auth"
+	"wb/kafka"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestTenantResolve(t *testing.T) {
+	r := tenantResolver{header: "x-tenant", topic: regexp.MustCompile(`^orders\.(.+)$`)}
+	tests := []struct {
+		name    string
+		topic   string
+		header  string
+		want    string
+		wantErr error
+	}{
+		{name: "topic", topic: "orders.acme", want: "acme"},
+		{name: "same header", topic: "orders.acme", header: "acme", want: "acme"},
+		{name: "conflicting header", topic: "orders.acme", header: "globex", wantErr: errTenantConflict},
+		{name: "header outside pattern", topic: "orders", header: "globex", want: "globex"},
+		{name: "nothing", topic: "orders"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := kafka.Message{Topic: tt.topic, Headers: map[string]string{}}
+			if tt.header != "" {
+				msg.Headers["x-tenant"] = tt.header
+			}
+			got, err := r.Resolve(msg)
+			if !errors.Is(err, tt.wantErr) || got != tt.want {
+				t.Errorf("Resolve = %q, %v, want %q, %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestScopeTenant(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	keys, err := auth.ParseAPIKeys("bound=support@acme,unbound=support,admin=admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newRouter := func(cfg authConfig) *gin.Engine {
+		router := gin.New()
+		cfg.authenticate(router)
+		cfg.authorize(router)
+		cfg.scopeTenant(router)
+		router.GET("/order/:order_uid", func(c *gin.Context) { c.String(http.StatusOK, requestTenant(c)) })
+		router.GET("/metrics", func(c *gin.Context) { c.String(http.StatusOK, requestTenant(c)) })
+		return router
+	}
+	cfg := authConfig{authenticators: []auth.Authenticator{keys}, policy: auth.NewPolicy(defaultRouteRoles...)}
+
+	tests := []struct {
+		name        string
+		multiTenant bool
+		disabled    bool
+		path        string
+		key         string
+		header      string
+		wantStatus  int
+		wantTenant  string
+	}{
+		{name: "bound key", multiTenant: true, path: "/order/1", key: "bound", wantStatus: 200, wantTenant: "acme"},
+		{name: "bound key ignores header", multiTenant: true, path: "/order/1", key: "bound", header: "globex",
+			wantStatus: 200, wantTenant: "acme"},
+		{name: "unbound key", multiTenant: true, path: "/order/1", key: "unbound", header: "acme", wantStatus: 403},
+		{name: "unbound key single tenant", path: "/order/1", key: "unbound", header: "acme", wantStatus: 200},
+		{name: "unbound key public route", multiTenant: true, path: "/metrics", key: "unbound", wantStatus: 200},
+		{name: "admin selects tenant", multiTenant: true, path: "/order/1", key: "admin", header: "globex",
+			wantStatus: 200, wantTenant: "globex"},
+		{name: "anonymous", multiTenant: true, path: "/order/1", header: "acme", wantStatus: 401},
+		{name: "anonymous public route", multiTenant: true, path: "/metrics", header: "acme", wantStatus: 200},
+		{name: "auth disabled", multiTenant: true, disabled: true, path: "/order/1", header: "acme",
+			wantStatus: 200, wantTenant: "acme"},
+	}
+	defer func(prev tenantResolver) { tenants = prev }(tenants)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tenants = tenantResolver{}
+			if tt.multiTenant {
+				tenants.header = "x-tenant"
+			}
+			c := cfg
+			c.disabled = tt.disabled
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.key != "" {
+				req.Header.Set(auth.APIKeyHeader, tt.key)
+			}
+			if tt.header != "" {
+				req.Header.Set(tenantRequestHeader, tt.header)
+			}
+			w := httptest.NewRecorder()
+			newRouter(c).ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusOK && w.Body.String() != tt.wantTenant {
+				t.Errorf("tenant = %q, want %q", w.Body.String(), tt.wantTenant)
+			}
+		})
+	}
+}